@@ -21,7 +21,10 @@ var clusterAddExternalWorkerCmd = &cobra.Command{
 An external server must meet the following requirements:
 	- ubuntu 20.04
 	- a unique hostname, that doesn't collide with an existing node name
-	- accessible with the same SSH key as used for the cluster`,
+	- accessible with the same SSH key as used for the cluster
+
+If the server is behind a NAT, forward a UDP port to the wireguard port of the server and pass the public address
+and port with --wireguard-endpoint. The server keeps its connections to the other nodes open with keepalive packets.`,
 	PreRunE: func(cmd *cobra.Command, args []string) error {
 		name, err := cmd.Flags().GetString("name")
 		if err != nil {
@@ -44,6 +47,12 @@ An external server must meet the following requirements:
 			return errors.New("IP address cannot be empty")
 		}
 
+		if endpoint, _ := cmd.Flags().GetString("wireguard-endpoint"); endpoint != "" {
+			if err := clustermanager.ValidateWireguardEndpoint(endpoint); err != nil {
+				return err
+			}
+		}
+
 		if len(cluster.Nodes) == 0 {
 			return errors.New("your cluster has no nodes, no idea how this was possible")
 		}
@@ -81,6 +90,7 @@ An external server must meet the following requirements:
 	Run: func(cmd *cobra.Command, args []string) {
 		name, _ := cmd.Flags().GetString("name")
 		ipAddress, _ := cmd.Flags().GetString("ip")
+		wireGuardEndpoint, _ := cmd.Flags().GetString("wireguard-endpoint")
 		_, cluster := AppConf.Config.FindClusterByName(name)
 		var sshKeyName string
 
@@ -100,8 +110,9 @@ An external server must meet the following requirements:
 		}
 
 		externalNode := clustermanager.Node{
-			IPAddress:  ipAddress,
-			SSHKeyName: sshKeyName,
+			IPAddress:         ipAddress,
+			SSHKeyName:        sshKeyName,
+			WireGuardEndpoint: wireGuardEndpoint,
 		}
 
 		sshClient := AppConf.SSHClient
@@ -110,24 +121,18 @@ An external server must meet the following requirements:
 		FatalOnError(err)
 		externalNode.Name = hostname
 
-		cidrPrefix, err := clustermanager.PrivateIPPrefix(cluster.NodeCIDR)
-		if err != nil {
-			log.Fatal(err)
-		}
+		ipam, err := clustermanager.NewClusterIPAM(*cluster)
+		FatalOnError(err)
 
-		// render internal IP address
-		nextNode := 21
-	outer:
-		for {
-			for _, node := range cluster.Nodes {
-				if node.PrivateIPAddress == fmt.Sprintf("%s.%d", cidrPrefix, nextNode) {
-					nextNode++
-					continue outer
-				}
-			}
-			break
+		externalNode.PrivateIPAddress, err = ipam.Allocate(externalNode.Name)
+		FatalOnError(err)
+		cluster.IPAllocations = ipam.Allocations()
+
+		// the public IPv6 address of external servers is unknown, so they connect to their peers over IPv4
+		if clustermanager.IsDualStack(*cluster) {
+			externalNode.PrivateIPv6Address, err = clustermanager.OverlayIPv6Address(cluster.NodeIPv6CIDR, externalNode.PrivateIPAddress)
+			FatalOnError(err)
 		}
-		externalNode.PrivateIPAddress = fmt.Sprintf("%s.%d", cidrPrefix, nextNode)
 		coordinator := pkg.NewProgressCoordinator()
 		hetznerProvider := hetzner.NewHetznerProvider(AppConf.Context, AppConf.Client, *cluster, AppConf.CurrentContext.Token)
 		clusterManager := clustermanager.NewClusterManagerFromCluster(*cluster, hetznerProvider, sshClient, coordinator)
@@ -148,9 +153,11 @@ An external server must meet the following requirements:
 		// Is needed to the right wireguard config is created including the new nodes
 		clusterManager.AppendNodes(nodes)
 
-		// re-generate network encryption
+		// add the new nodes to the encrypted network, existing nodes keep their keys. The key pairs of the new nodes
+		// are only known to the cluster manager
 		err = clusterManager.SetupEncryptedNetwork()
 		FatalOnError(err)
+		*cluster = clusterManager.Cluster()
 		saveCluster(cluster)
 
 		// all work on the already existing nodes is completed by now
@@ -177,4 +184,5 @@ func init() {
 
 	clusterAddExternalWorkerCmd.Flags().StringP("name", "n", "", "Name of the cluster to add the workers to")
 	clusterAddExternalWorkerCmd.Flags().StringP("ip", "i", "", "The IP address of the external node")
+	clusterAddExternalWorkerCmd.Flags().String("wireguard-endpoint", "", "The <host>:<port> the other nodes reach wireguard of the external node on, if it is behind a NAT")
 }
@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/xetys/hetzner-kube/pkg"
+	"github.com/xetys/hetzner-kube/pkg/clustermanager"
+	"github.com/xetys/hetzner-kube/pkg/hetzner"
+)
+
+// clusterAddMasterCmd represents the clusterAddMaster command
+var clusterAddMasterCmd = &cobra.Command{
+	Use:   "add-master",
+	Short: "add master nodes to a HA cluster",
+	Long: `Adds n nodes as master nodes to the control plane of a HA cluster.
+
+If etcd is running on the master nodes, the new masters also join the etcd cluster. Afterwards the
+master load balancer is redeployed on all nodes.`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		name, err := cmd.Flags().GetString("name")
+		if err != nil {
+			return nil
+		}
+
+		if name == "" {
+			return errors.New("flag --name is required")
+		}
+
+		idx, cluster := AppConf.Config.FindClusterByName(name)
+
+		if idx == -1 {
+			return fmt.Errorf("cluster '%s' not found", name)
+		}
+
+		if !cluster.HaEnabled {
+			return errors.New("masters can only be added to clusters created with --ha-enabled")
+		}
+
+		if masterServerType, _ := cmd.Flags().GetString("master-server-type"); masterServerType == "" {
+			return errors.New("flag --master-server-type is required")
+		}
+
+		if nodes, _ := cmd.Flags().GetInt("nodes"); nodes < 1 {
+			return fmt.Errorf("at least 1 master node must be added. %d was provided", nodes)
+		}
+
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		nodeCount, _ := cmd.Flags().GetInt("nodes")
+		name, _ := cmd.Flags().GetString("name")
+		_, cluster := AppConf.Config.FindClusterByName(name)
+		masterServerType, _ := cmd.Flags().GetString("master-server-type")
+		datacenters, _ := cmd.Flags().GetStringSlice("datacenters")
+		var sshKeyName string
+
+		maxNo := 0
+		for _, node := range cluster.Nodes {
+			if node.IsMaster {
+				sshKeyName = node.SSHKeyName
+
+				nameParts := strings.Split(node.Name, "-")
+				no, _ := strconv.Atoi(nameParts[len(nameParts)-1])
+
+				if no > maxNo {
+					maxNo = no
+				}
+			}
+		}
+
+		if sshKeyName == "" {
+			log.Fatal("master not found")
+		}
+
+		coordinator := pkg.NewProgressCoordinator()
+		hetznerProvider := hetzner.NewHetznerProvider(AppConf.Context, AppConf.Client, *cluster, AppConf.CurrentContext.Token)
+		clusterManager := clustermanager.NewClusterManagerFromCluster(*cluster, hetznerProvider, AppConf.SSHClient, coordinator)
+		err := AppConf.SSHClient.(*clustermanager.SSHCommunicator).CapturePassphrase(sshKeyName)
+		FatalOnError(err)
+
+		nodes, err := hetznerProvider.CreateMasterNodes(sshKeyName, masterServerType, datacenters, nodeCount, maxNo, !cluster.IsolatedEtcd)
+		FatalOnError(err)
+
+		cluster.Nodes = append(cluster.Nodes, nodes...)
+		cluster.IPAllocations = hetznerProvider.GetCluster().IPAllocations
+		saveCluster(cluster)
+
+		// Is needed to the right wireguard config is created including the new nodes
+		clusterManager.AppendNodes(nodes)
+
+		log.Println("sleep for 30s...")
+		time.Sleep(30 * time.Second)
+
+		// only the new nodes get a progress bar, as the existing nodes get reconfigured at the very end
+		for _, node := range nodes {
+			coordinator.StartProgress(node.Name, computeAddMasterSteps(cluster))
+		}
+
+		err = clusterManager.ProvisionNodes(nodes)
+		FatalOnError(err)
+
+		// add the new nodes to the encrypted network, existing nodes keep their keys
+		err = clusterManager.SetupEncryptedNetwork()
+		FatalOnError(err)
+		*cluster = clusterManager.Cluster()
+		saveCluster(cluster)
+
+		err = clusterManager.AddMasters(nodes)
+		FatalOnError(err)
+
+		for _, node := range nodes {
+			coordinator.CompleteProgress(node.Name)
+		}
+
+		coordinator.Wait()
+		log.Println("masters added successfully")
+	},
+}
+
+func computeAddMasterSteps(cluster *clustermanager.Cluster) int {
+	provisionSteps := 8
+	netWorkSetupSteps := 2
+	etcdSteps := 5
+	joinSteps := 5
+	loadBalancerSteps := 2
+
+	steps := provisionSteps + netWorkSetupSteps + joinSteps + loadBalancerSteps
+	if !cluster.IsolatedEtcd {
+		steps += etcdSteps
+	}
+
+	return steps + 6
+}
+
+func init() {
+	clusterCmd.AddCommand(clusterAddMasterCmd)
+
+	clusterAddMasterCmd.Flags().StringP("name", "", "", "Name of the cluster to add the masters to")
+	clusterAddMasterCmd.Flags().String("master-server-type", "cx11", "Server type used of masters")
+	clusterAddMasterCmd.Flags().IntP("nodes", "n", 1, "Number of master nodes to add")
+	clusterAddMasterCmd.Flags().StringSlice("datacenters", []string{"fsn1-dc8", "nbg1-dc3", "hel1-dc2", "fsn1-dc14"}, "Can be used to filter datacenters by their name")
+}
@@ -105,6 +105,7 @@ You can specify the worker server type as in cluster create.`,
 		existingNodes := cluster.Nodes
 
 		cluster.Nodes = append(cluster.Nodes, nodes...)
+		cluster.IPAllocations = hetznerProvider.GetCluster().IPAllocations
 		saveCluster(cluster)
 
 		// Is needed to the right wireguard config is created including the new nodes
@@ -117,9 +118,11 @@ You can specify the worker server type as in cluster create.`,
 		err = clusterManager.ProvisionNodes(nodes)
 		FatalOnError(err)
 
-		// re-generate network encryption
+		// add the new nodes to the encrypted network, existing nodes keep their keys. The key pairs of the new nodes
+		// are only known to the cluster manager
 		err = clusterManager.SetupEncryptedNetwork()
 		FatalOnError(err)
+		*cluster = clusterManager.Cluster()
 		saveCluster(cluster)
 
 		// all work on the already existing nodes is completed by now
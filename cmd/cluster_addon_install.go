@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"errors"
 	"log"
 
 	"github.com/spf13/cobra"
@@ -11,9 +12,16 @@ import (
 
 // clusterAddonInstallCmd represents the clusterAddonInstall command
 var clusterAddonInstallCmd = &cobra.Command{
-	Use:     "install",
-	Short:   "installs an addon to a cluster",
-	PreRunE: validateAddonSubCommand,
+	Use:   "install <ADDON NAME> [ADDON ARGS...]",
+	Short: "installs an addon to a cluster",
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			return errors.New("addon name expected")
+		}
+
+		// additional arguments are passed to the addon
+		return validateAddonSubCommand(cmd, args[:1])
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		name, _ := cmd.Flags().GetString("name")
 		addonName := args[0]
@@ -30,7 +38,7 @@ var clusterAddonInstallCmd = &cobra.Command{
 		FatalOnError(err)
 
 		addon := addonService.GetAddon(addonName)
-		addon.Install()
+		addon.Install(args[1:]...)
 
 		log.Printf("addon %s successfully installed", addonName)
 	},
@@ -0,0 +1,15 @@
+package cmd
+
+import "github.com/spf13/cobra"
+
+var certsCmd = &cobra.Command{
+	Use:   "certs",
+	Short: "a subcommand for managing the kubernetes certificates of a cluster",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Usage()
+	},
+}
+
+func init() {
+	clusterCmd.AddCommand(certsCmd)
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/xetys/hetzner-kube/pkg/clustermanager"
+	"github.com/xetys/hetzner-kube/pkg/hetzner"
+)
+
+// certsCheckCmd represents the cluster certs check command
+var certsCheckCmd = &cobra.Command{
+	Use:   "check <CLUSTER NAME>",
+	Short: "reports the expiry of the kubernetes certificates",
+	Long: `Runs "kubeadm certs check-expiration" on all masters and reports the expiry of every certificate per node.
+
+Certificates expiring within --warn-within are reported as warning, expired certificates as critical. The exit code
+is 0 if all certificates are valid, 1 on warnings and 2 on expired or unreadable certificates.`,
+	Args:    cobra.ExactArgs(1),
+	PreRunE: validateClusterInArgumentExists,
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+		warnWithin, _ := cmd.Flags().GetDuration("warn-within")
+		_, cluster := AppConf.Config.FindClusterByName(args[0])
+
+		provider := hetzner.NewHetznerProvider(AppConf.Context, AppConf.Client, *cluster, AppConf.CurrentContext.Token)
+		masterNode, err := provider.GetMasterNode()
+		FatalOnError(err)
+
+		err = AppConf.SSHClient.(*clustermanager.SSHCommunicator).CapturePassphrase(masterNode.SSHKeyName)
+		FatalOnError(err)
+
+		clusterManager := clustermanager.NewClusterManagerFromCluster(*cluster, provider, AppConf.SSHClient, logEventService{})
+		nodeCertificates := clusterManager.CheckCertificates()
+
+		now := time.Now()
+		results := []clustermanager.CheckResult{}
+		var earliest *clustermanager.CertificateExpiry
+		for _, node := range nodeCertificates {
+			if node.Error != "" {
+				results = append(results, clustermanager.CheckResult{Node: node.Node, Check: "certificates", Status: clustermanager.StatusCritical, Message: node.Error})
+				continue
+			}
+
+			for i, certificate := range node.Certificates {
+				results = append(results, clustermanager.CheckResult{
+					Node:    node.Node,
+					Check:   certificate.Name,
+					Status:  clustermanager.CertificateStatus(certificate, now, warnWithin),
+					Message: certificate.Expires.Format(time.RFC3339),
+				})
+
+				if earliest == nil || certificate.Expires.Before(earliest.Expires) {
+					earliest = &node.Certificates[i]
+				}
+			}
+		}
+		status := clustermanager.OverallStatus(results)
+
+		if output == "json" {
+			reportJSON, err := json.MarshalIndent(struct {
+				Cluster string                            `json:"cluster"`
+				Status  clustermanager.CheckStatus        `json:"status"`
+				Nodes   []clustermanager.NodeCertificates `json:"nodes"`
+			}{cluster.Name, status, nodeCertificates}, "", "    ")
+			FatalOnError(err)
+			fmt.Println(string(reportJSON))
+		} else {
+			tw := new(tabwriter.Writer)
+			tw.Init(os.Stdout, 0, 8, 2, '\t', 0)
+			fmt.Fprintln(tw, "NODE\tCERTIFICATE\tEXPIRES\tSTATUS")
+
+			for _, result := range results {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s", result.Node, result.Check, result.Message, result.Status)
+				fmt.Fprintln(tw)
+			}
+
+			tw.Flush()
+			fmt.Println()
+			if earliest != nil {
+				fmt.Printf("the first certificate (%s) expires in %d days\n", earliest.Name, int(earliest.Expires.Sub(now).Hours()/24))
+			}
+			fmt.Printf("cluster '%s' certificate status: %s\n", cluster.Name, status)
+		}
+
+		switch status {
+		case clustermanager.StatusWarning:
+			os.Exit(1)
+		case clustermanager.StatusCritical:
+			os.Exit(2)
+		}
+	},
+}
+
+func init() {
+	certsCmd.AddCommand(certsCheckCmd)
+
+	certsCheckCmd.Flags().StringP("output", "o", "table", "output format, either table or json")
+	certsCheckCmd.Flags().Duration("warn-within", 30*24*time.Hour, "warn about certificates expiring within this duration")
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/spf13/cobra"
+	"github.com/xetys/hetzner-kube/pkg/clustermanager"
+	"github.com/xetys/hetzner-kube/pkg/hetzner"
+)
+
+// certsRenewCmd represents the cluster certs renew command
+var certsRenewCmd = &cobra.Command{
+	Use:   "renew <CLUSTER NAME>",
+	Short: "renews the kubernetes certificates on all masters",
+	Long: `Renews all certificates managed by kubeadm on one master after another.
+
+The api server, controller manager and scheduler are restarted to load the new certificates, and /root/.kube/config
+is refreshed. The next master is renewed once the api server of the previous one is healthy again. The certificate
+authorities are not renewed.
+
+The client certificate in the local kubeconfig is renewed as well, so it must be fetched again with
+"hetzner-kube cluster kubeconfig" afterwards.`,
+	Args:    cobra.ExactArgs(1),
+	PreRunE: validateClusterInArgumentExists,
+	Run: func(cmd *cobra.Command, args []string) {
+		_, cluster := AppConf.Config.FindClusterByName(args[0])
+
+		provider := hetzner.NewHetznerProvider(AppConf.Context, AppConf.Client, *cluster, AppConf.CurrentContext.Token)
+		masterNode, err := provider.GetMasterNode()
+		FatalOnError(err)
+
+		err = AppConf.SSHClient.(*clustermanager.SSHCommunicator).CapturePassphrase(masterNode.SSHKeyName)
+		FatalOnError(err)
+
+		clusterManager := clustermanager.NewClusterManagerFromCluster(*cluster, provider, AppConf.SSHClient, logEventService{})
+		FatalOnError(clusterManager.RenewCertificates())
+
+		log.Printf("certificates of cluster '%s' renewed", cluster.Name)
+		fmt.Printf("the local kubeconfig still contains the old client certificate, run 'hetzner-kube cluster kubeconfig %s --force' to update it\n", cluster.Name)
+	},
+}
+
+func init() {
+	certsCmd.AddCommand(certsRenewCmd)
+}
@@ -0,0 +1,15 @@
+package cmd
+
+import "github.com/spf13/cobra"
+
+var configureCmd = &cobra.Command{
+	Use:   "configure",
+	Short: "a subcommand for changing the configuration of an existing cluster",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Usage()
+	},
+}
+
+func init() {
+	clusterCmd.AddCommand(configureCmd)
+}
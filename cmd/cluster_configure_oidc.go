@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+
+	"github.com/spf13/cobra"
+	"github.com/xetys/hetzner-kube/pkg/clustermanager"
+	"github.com/xetys/hetzner-kube/pkg/hetzner"
+)
+
+// configureOIDCCmd represents the cluster configure oidc command
+var configureOIDCCmd = &cobra.Command{
+	Use:   "oidc <CLUSTER NAME>",
+	Short: "configures the authentication with an OIDC provider",
+	Long: `Configures the api servers to authenticate users with the ID tokens of an OIDC provider, or disables it
+with --disable.
+
+The settings are added to the kubeadm configuration, and the api servers are generated again by kubeadm on one master
+after another. The next master is updated once the api server of the previous one is healthy again. The settings are
+saved also if a master fails, so running the command again continues with the same configuration.
+
+Example: hetzner-kube cluster configure oidc my-cluster --issuer-url https://accounts.example.com --client-id kubernetes --groups-claim groups`,
+	Args: cobra.ExactArgs(1),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if idx, _ := AppConf.Config.FindClusterByName(args[0]); idx == -1 {
+			return fmt.Errorf("cluster '%s' not found", args[0])
+		}
+
+		if disable, _ := cmd.Flags().GetBool("disable"); disable {
+			return nil
+		}
+
+		settings, err := oidcSettingsFromFlags(cmd, "")
+		if err != nil {
+			return err
+		}
+
+		if !settings.Enabled() {
+			return fmt.Errorf("flag --issuer-url is required")
+		}
+
+		return clustermanager.ValidateOIDCSettings(settings)
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		_, cluster := AppConf.Config.FindClusterByName(args[0])
+
+		settings := clustermanager.OIDCSettings{}
+		if disable, _ := cmd.Flags().GetBool("disable"); !disable {
+			var err error
+			settings, err = oidcSettingsFromFlags(cmd, "")
+			FatalOnError(err)
+		}
+
+		provider := hetzner.NewHetznerProvider(AppConf.Context, AppConf.Client, *cluster, AppConf.CurrentContext.Token)
+		masterNode, err := provider.GetMasterNode()
+		FatalOnError(err)
+
+		err = AppConf.SSHClient.(*clustermanager.SSHCommunicator).CapturePassphrase(masterNode.SSHKeyName)
+		FatalOnError(err)
+
+		clusterManager := clustermanager.NewClusterManagerFromCluster(*cluster, provider, AppConf.SSHClient, logEventService{})
+		err = clusterManager.ConfigureOIDC(settings)
+
+		// the kubeadm configuration may already contain the settings, so they are saved also after a failure
+		*cluster = clusterManager.Cluster()
+		saveCluster(cluster)
+		FatalOnError(err)
+
+		if settings.Enabled() {
+			log.Printf("OIDC authentication with '%s' configured", settings.IssuerURL)
+		} else {
+			log.Println("OIDC authentication disabled")
+		}
+	},
+}
+
+// oidcSettingsFromFlags reads the OIDC settings from the flags with the given prefix. The CA is read from the file
+// passed as CA file
+func oidcSettingsFromFlags(cmd *cobra.Command, prefix string) (clustermanager.OIDCSettings, error) {
+	issuerURL, _ := cmd.Flags().GetString(prefix + "issuer-url")
+	clientID, _ := cmd.Flags().GetString(prefix + "client-id")
+	usernameClaim, _ := cmd.Flags().GetString(prefix + "username-claim")
+	groupsClaim, _ := cmd.Flags().GetString(prefix + "groups-claim")
+	settings := clustermanager.OIDCSettings{
+		IssuerURL:     issuerURL,
+		ClientID:      clientID,
+		UsernameClaim: usernameClaim,
+		GroupsClaim:   groupsClaim,
+	}
+
+	if caFile, _ := cmd.Flags().GetString(prefix + "ca-file"); caFile != "" {
+		ca, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return settings, fmt.Errorf("unable to read OIDC CA: %v", err)
+		}
+		settings.CA = string(ca)
+	}
+
+	return settings, nil
+}
+
+func init() {
+	configureCmd.AddCommand(configureOIDCCmd)
+
+	configureOIDCCmd.Flags().String("issuer-url", "", "URL of the OIDC provider, must be https")
+	configureOIDCCmd.Flags().String("client-id", "", "client ID all tokens must be issued for")
+	configureOIDCCmd.Flags().String("username-claim", "", "claim used as user name, sub if empty")
+	configureOIDCCmd.Flags().String("groups-claim", "", "claim used as groups of the user")
+	configureOIDCCmd.Flags().String("ca-file", "", "CA file of the OIDC provider, if it is not signed by a public CA")
+	configureOIDCCmd.Flags().Bool("disable", false, "disables the OIDC authentication")
+}
@@ -5,9 +5,11 @@ import (
 	"fmt"
 	"github.com/hetznercloud/hcloud-go/hcloud"
 	"github.com/xetys/hetzner-kube/pkg/phases"
+	"io/ioutil"
 	"log"
 	"net"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -69,24 +71,60 @@ func RunClusterCreate(cmd *cobra.Command, args []string) {
 	datacenters, _ := cmd.Flags().GetStringSlice("datacenters")
 	nodeCidr, _ := cmd.Flags().GetString("node-cidr")
 	cloudInit, _ := cmd.Flags().GetString("cloud-init")
+	kubernetesVersion, _ := cmd.Flags().GetString("kubernetes-version")
+	containerRuntime, _ := cmd.Flags().GetString("container-runtime")
+	cni, _ := cmd.Flags().GetString("cni")
+	podCidr, _ := cmd.Flags().GetString("pod-cidr")
+	serviceCidr, _ := cmd.Flags().GetString("service-cidr")
+	dnsDomain, _ := cmd.Flags().GetString("dns-domain")
+	ipFamily, _ := cmd.Flags().GetString("ip-family")
+	wireGuard := wireGuardSettingsFromFlags(cmd)
+	oidc, err := oidcSettingsFromFlags(cmd, "oidc-")
+	FatalOnError(err)
+
+	kubeadmPatches, err := kubeadmPatchesFromFlags(cmd)
+	FatalOnError(err)
+
+	audit := clustermanager.AuditSettings{}
+	if enableAudit, _ := cmd.Flags().GetBool("audit"); enableAudit {
+		audit, err = auditSettingsFromFlags(cmd, "audit-")
+		FatalOnError(err)
+	}
+
+	secretsEncryption := clustermanager.SecretsEncryptionSettings{}
+	if encryptSecrets, _ := cmd.Flags().GetBool("encrypt-secrets"); encryptSecrets {
+		secretsEncryption.Provider, _ = cmd.Flags().GetString("encryption-provider")
+		key, err := clustermanager.GenerateEncryptionKey()
+		FatalOnError(err)
+		secretsEncryption.Keys = []clustermanager.EncryptionKey{key}
+	}
+
+	var nodeIPv6Cidr, podIPv6Cidr, serviceIPv6Cidr string
+	if ipFamily == clustermanager.IPFamilyDualStack {
+		nodeIPv6Cidr, _ = cmd.Flags().GetString("node-ipv6-cidr")
+		podIPv6Cidr, _ = cmd.Flags().GetString("pod-ipv6-cidr")
+		serviceIPv6Cidr, _ = cmd.Flags().GetString("service-ipv6-cidr")
+	}
 
 	hetznerProvider := hetzner.NewHetznerProvider(AppConf.Context, AppConf.Client, clustermanager.Cluster{
 		Name:          clusterName,
 		NodeCIDR:      nodeCidr,
 		CloudInitFile: cloudInit,
+		IPFamily:      ipFamily,
+		NodeIPv6CIDR:  nodeIPv6Cidr,
 	}, AppConf.CurrentContext.Token)
 
 	sshClient := clustermanager.NewSSHCommunicator(AppConf.Config.SSHKeys, debug)
-	err := sshClient.(*clustermanager.SSHCommunicator).CapturePassphrase(sshKeyName)
+	err = sshClient.(*clustermanager.SSHCommunicator).CapturePassphrase(sshKeyName)
 	FatalOnError(err)
 
 	if haEnabled && isolatedEtcd {
-		if _, err := hetznerProvider.CreateEtcdNodes(sshKeyName, masterServerType, datacenters, etcdCount); err != nil {
+		if _, err := hetznerProvider.CreateEtcdNodes(sshKeyName, masterServerType, datacenters, etcdCount, 0); err != nil {
 			log.Println(err)
 		}
 	}
 
-	if _, err := hetznerProvider.CreateMasterNodes(sshKeyName, masterServerType, datacenters, masterCount, !isolatedEtcd); err != nil {
+	if _, err := hetznerProvider.CreateMasterNodes(sshKeyName, masterServerType, datacenters, masterCount, 0, !isolatedEtcd); err != nil {
 		log.Println(err)
 	}
 
@@ -103,7 +141,29 @@ func RunClusterCreate(cmd *cobra.Command, args []string) {
 
 	coordinator := pkg.NewProgressCoordinator()
 
-	clusterManager := clustermanager.NewClusterManager(hetznerProvider, sshClient, coordinator, clusterName, haEnabled, isolatedEtcd, cloudInit)
+	clusterManager := clustermanager.NewClusterManagerFromCluster(clustermanager.Cluster{
+		Name:              clusterName,
+		Nodes:             hetznerProvider.GetAllNodes(),
+		HaEnabled:         haEnabled,
+		IsolatedEtcd:      isolatedEtcd,
+		CloudInitFile:     cloudInit,
+		KubernetesVersion: kubernetesVersion,
+		ContainerRuntime:  containerRuntime,
+		CNI:               cni,
+		PodCIDR:           podCidr,
+		ServiceCIDR:       serviceCidr,
+		DNSDomain:         dnsDomain,
+		IPAllocations:     hetznerProvider.GetCluster().IPAllocations,
+		IPFamily:          ipFamily,
+		NodeIPv6CIDR:      nodeIPv6Cidr,
+		PodIPv6CIDR:       podIPv6Cidr,
+		ServiceIPv6CIDR:   serviceIPv6Cidr,
+		WireGuard:         wireGuard,
+		OIDC:              oidc,
+		SecretsEncryption: secretsEncryption,
+		Audit:             audit,
+		KubeadmPatches:    kubeadmPatches,
+	}, hetznerProvider, sshClient, coordinator)
 	cluster := clusterManager.Cluster()
 	saveCluster(&cluster)
 	renderProgressBars(&cluster, coordinator)
@@ -117,6 +177,8 @@ func RunClusterCreate(cmd *cobra.Command, args []string) {
 	phaseChain.AddPhase(phases.NewSetupHighAvailabilityPhase(clusterManager))
 	phaseChain.AddPhase(phases.NewInstallWorkersPhase(clusterManager))
 	phaseChain.SetAfterRun(func() {
+		// the phases add state like the wireguard keys to the cluster manager
+		cluster = clusterManager.Cluster()
 		saveCluster(&cluster)
 	})
 
@@ -217,12 +279,93 @@ func validateClusterCreateFlags(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	nodeCidr, _ := cmd.Flags().GetString("node-cidr")
+	podCidr, _ := cmd.Flags().GetString("pod-cidr")
+	serviceCidr, _ := cmd.Flags().GetString("service-cidr")
+	if err := clustermanager.ValidateNetworks(nodeCidr, podCidr, serviceCidr); err != nil {
+		return err
+	}
+
+	if dnsDomain, _ := cmd.Flags().GetString("dns-domain"); dnsDomain != "" {
+		if err := clustermanager.ValidateDNSDomain(dnsDomain); err != nil {
+			return err
+		}
+	}
+
 	if cloudInit, _ = cmd.Flags().GetString("cloud-init"); cloudInit != "" {
 		if _, err := os.Stat(cloudInit); os.IsNotExist(err) {
 			return errors.New("cloud-init file not found")
 		}
 	}
 
+	containerRuntime, _ := cmd.Flags().GetString("container-runtime")
+	if !isValidContainerRuntime(containerRuntime) {
+		return fmt.Errorf("unsupported container runtime '%s', must be one of %s", containerRuntime, strings.Join(clustermanager.ContainerRuntimes, ", "))
+	}
+
+	kubernetesVersion, _ := cmd.Flags().GetString("kubernetes-version")
+	if err := clustermanager.ValidateKubernetesVersion(kubernetesVersion, containerRuntime); err != nil {
+		return err
+	}
+
+	cniName, _ := cmd.Flags().GetString("cni")
+	cni, err := clustermanager.GetCNI(cniName)
+	if err != nil {
+		return err
+	}
+
+	ipFamily, _ := cmd.Flags().GetString("ip-family")
+	if err := clustermanager.ValidateIPFamily(ipFamily); err != nil {
+		return err
+	}
+
+	if ipFamily == clustermanager.IPFamilyDualStack {
+		if !cni.SupportsDualStack() {
+			return fmt.Errorf("CNI '%s' does not support dual-stack clusters", cni.Name())
+		}
+
+		nodeIPv6Cidr, _ := cmd.Flags().GetString("node-ipv6-cidr")
+		podIPv6Cidr, _ := cmd.Flags().GetString("pod-ipv6-cidr")
+		serviceIPv6Cidr, _ := cmd.Flags().GetString("service-ipv6-cidr")
+		if err := clustermanager.ValidateIPv6Networks(nodeIPv6Cidr, podIPv6Cidr, serviceIPv6Cidr); err != nil {
+			return err
+		}
+	}
+
+	if err := clustermanager.ValidateWireGuardSettings(wireGuardSettingsFromFlags(cmd)); err != nil {
+		return err
+	}
+
+	oidc, err := oidcSettingsFromFlags(cmd, "oidc-")
+	if err != nil {
+		return err
+	}
+
+	if err := clustermanager.ValidateOIDCSettings(oidc); err != nil {
+		return err
+	}
+
+	if enableAudit, _ := cmd.Flags().GetBool("audit"); enableAudit {
+		audit, err := auditSettingsFromFlags(cmd, "audit-")
+		if err != nil {
+			return err
+		}
+
+		if err := clustermanager.ValidateAuditSettings(audit); err != nil {
+			return err
+		}
+	}
+
+	if _, err := kubeadmPatchesFromFlags(cmd); err != nil {
+		return err
+	}
+
+	if provider, _ := cmd.Flags().GetString("encryption-provider"); provider != "" {
+		if err := clustermanager.ValidateEncryptionProvider(provider); err != nil {
+			return err
+		}
+	}
+
 	if _, err := AppConf.Config.FindSSHKeyByName(sshKey); err != nil {
 		return fmt.Errorf("SSH key '%s' not found", sshKey)
 	}
@@ -257,6 +400,16 @@ func validateClusterCreateFlags(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+func isValidContainerRuntime(containerRuntime string) bool {
+	for _, supported := range clustermanager.ContainerRuntimes {
+		if containerRuntime == supported {
+			return true
+		}
+	}
+
+	return false
+}
+
 func init() {
 	clusterCmd.AddCommand(clusterCreateCmd)
 
@@ -271,6 +424,33 @@ func init() {
 	clusterCreateCmd.Flags().IntP("worker-count", "w", 1, "Number of worker nodes for the cluster")
 	clusterCreateCmd.Flags().StringP("cloud-init", "", "", "Cloud-init file for server preconfiguration")
 	clusterCreateCmd.Flags().StringP("node-cidr", "", "10.0.1.0/24", "the CIDR for the nodes wireguard IPs")
+	clusterCreateCmd.Flags().String("pod-cidr", clustermanager.DefaultPodCIDR, "the CIDR the pod IPs are allocated from")
+	clusterCreateCmd.Flags().String("service-cidr", clustermanager.DefaultServiceCIDR, "the CIDR the service IPs are allocated from")
+	clusterCreateCmd.Flags().String("dns-domain", clustermanager.DefaultDNSDomain, "the DNS domain of the services in the cluster")
+	clusterCreateCmd.Flags().String("ip-family", clustermanager.IPFamilyIPv4, "IP family of the cluster, either ipv4 or dual-stack")
+	clusterCreateCmd.Flags().String("node-ipv6-cidr", clustermanager.DefaultNodeIPv6CIDR, "the IPv6 CIDR for the nodes wireguard IPs of dual-stack clusters")
+	clusterCreateCmd.Flags().String("pod-ipv6-cidr", clustermanager.DefaultPodIPv6CIDR, "the IPv6 CIDR the pod IPs of dual-stack clusters are allocated from")
+	clusterCreateCmd.Flags().String("service-ipv6-cidr", clustermanager.DefaultServiceIPv6CIDR, "the IPv6 CIDR the service IPs of dual-stack clusters are allocated from")
+	clusterCreateCmd.Flags().Int("wireguard-port", clustermanager.DefaultWireguardPort, "the port wireguard listens on")
+	clusterCreateCmd.Flags().Int("wireguard-mtu", 0, "the MTU of the wireguard interfaces, between 1280 and 1500, 0 to derive it from the public interface")
+	clusterCreateCmd.Flags().Int("wireguard-keepalive", 0, "the keepalive interval in seconds between all nodes, 0 to send keepalives from nodes behind a NAT only")
+	clusterCreateCmd.Flags().String("oidc-issuer-url", "", "URL of the OIDC provider users are authenticated with, must be https")
+	clusterCreateCmd.Flags().String("oidc-client-id", "", "client ID all OIDC tokens must be issued for")
+	clusterCreateCmd.Flags().String("oidc-username-claim", "", "OIDC claim used as user name, sub if empty")
+	clusterCreateCmd.Flags().String("oidc-groups-claim", "", "OIDC claim used as groups of the user")
+	clusterCreateCmd.Flags().String("oidc-ca-file", "", "CA file of the OIDC provider, if it is not signed by a public CA")
+	clusterCreateCmd.Flags().Bool("encrypt-secrets", false, "encrypts secrets in etcd with a random key")
+	clusterCreateCmd.Flags().String("encryption-provider", clustermanager.EncryptionProviderAESCBC, "provider secrets are encrypted with, either aescbc or secretbox")
+	clusterCreateCmd.Flags().Bool("audit", false, "enables the audit log of the api servers")
+	clusterCreateCmd.Flags().String("audit-policy-file", "", "audit policy file, a default policy is used if empty")
+	clusterCreateCmd.Flags().String("audit-webhook-config-file", "", "kubeconfig of a webhook the audit events are sent to")
+	clusterCreateCmd.Flags().Int("audit-log-max-age", clustermanager.DefaultAuditLogMaxAge, "days old audit logs are kept")
+	clusterCreateCmd.Flags().Int("audit-log-max-backup", clustermanager.DefaultAuditLogMaxBackup, "number of old audit logs which are kept")
+	clusterCreateCmd.Flags().Int("audit-log-max-size", clustermanager.DefaultAuditLogMaxSize, "size in megabytes the audit log is rotated at")
+	clusterCreateCmd.Flags().String("kubeadm-patch", "", "file with merge or JSON patches of the kubeadm configuration, one YAML document per kind")
+	clusterCreateCmd.Flags().String("cni", clustermanager.DefaultCNI, "Network plugin, one of "+strings.Join(clustermanager.CNINames(), ", "))
+	clusterCreateCmd.Flags().String("container-runtime", clustermanager.ContainerRuntimeDocker, "Container runtime of the nodes, either docker or containerd")
+	clusterCreateCmd.Flags().String("kubernetes-version", clustermanager.DefaultKubernetesVersion, "Kubernetes version of the cluster, 1.24 and newer require containerd")
 
 	// get default datacenters
 	dcs := []string{}
@@ -291,3 +471,37 @@ func init() {
 
 	clusterCreateCmd.Flags().StringSlice("datacenters", dcs, "Can be used to filter datacenters by their name")
 }
+
+// wireGuardSettingsFromFlags reads the settings of the encrypted network from the flags of the create command
+func wireGuardSettingsFromFlags(cmd *cobra.Command) clustermanager.WireGuardSettings {
+	port, _ := cmd.Flags().GetInt("wireguard-port")
+	mtu, _ := cmd.Flags().GetInt("wireguard-mtu")
+	keepalive, _ := cmd.Flags().GetInt("wireguard-keepalive")
+
+	return clustermanager.WireGuardSettings{
+		Port:                port,
+		MTU:                 mtu,
+		PersistentKeepalive: keepalive,
+	}
+}
+
+// kubeadmPatchesFromFlags reads the kubeadm patches from the file passed to the create command, and checks that they
+// can be applied to all masters
+func kubeadmPatchesFromFlags(cmd *cobra.Command) (string, error) {
+	patchFile, _ := cmd.Flags().GetString("kubeadm-patch")
+	if patchFile == "" {
+		return "", nil
+	}
+
+	patches, err := ioutil.ReadFile(patchFile)
+	if err != nil {
+		return "", fmt.Errorf("unable to read kubeadm patch: %v", err)
+	}
+
+	haEnabled, _ := cmd.Flags().GetBool("ha-enabled")
+	if err := clustermanager.ValidateKubeadmPatches(string(patches), haEnabled); err != nil {
+		return "", err
+	}
+
+	return string(patches), nil
+}
@@ -63,4 +63,81 @@ func TestClusterCmdValidate(t *testing.T) {
 	if err == nil {
 		t.Error("no errors occurred with a senseless node CIDR, but should")
 	}
+
+	cmd.ParseFlags([]string{"cluster", "create", "--ha-enabled", "--ssh-key", "test", "--node-cidr", "10.0.1.0/24", "--container-runtime", "rkt"})
+	err = validateClusterCreateFlags(cmd, []string{})
+
+	if err == nil {
+		t.Error("no errors occurred with an unsupported container runtime, but should")
+	}
+
+	cmd.ParseFlags([]string{"cluster", "create", "--ha-enabled", "--ssh-key", "test", "--container-runtime", "containerd", "--cni", "weave"})
+	err = validateClusterCreateFlags(cmd, []string{})
+
+	if err == nil {
+		t.Error("no errors occurred with an unsupported CNI, but should")
+	}
+
+	cmd.ParseFlags([]string{"cluster", "create", "--ha-enabled", "--ssh-key", "test", "--cni", "canal", "--pod-cidr", "10.0.0.0/8"})
+	err = validateClusterCreateFlags(cmd, []string{})
+
+	if err == nil {
+		t.Error("no errors occurred with a pod CIDR overlapping the node CIDR, but should")
+	}
+
+	cmd.ParseFlags([]string{"cluster", "create", "--ha-enabled", "--ssh-key", "test", "--pod-cidr", "10.244.0.0/16", "--dns-domain", "Cluster_Local"})
+	err = validateClusterCreateFlags(cmd, []string{})
+
+	if err == nil {
+		t.Error("no errors occurred with an invalid DNS domain, but should")
+	}
+
+	cmd.ParseFlags([]string{"cluster", "create", "--ha-enabled", "--ssh-key", "test", "--dns-domain", "cluster.local", "--ip-family", "ipv6"})
+	err = validateClusterCreateFlags(cmd, []string{})
+
+	if err == nil {
+		t.Error("no errors occurred with an IPv6-only cluster, but should")
+	}
+
+	cmd.ParseFlags([]string{"cluster", "create", "--ha-enabled", "--ssh-key", "test", "--ip-family", "dual-stack", "--cni", "canal"})
+	err = validateClusterCreateFlags(cmd, []string{})
+
+	if err == nil {
+		t.Error("no errors occurred with a dual-stack cluster using canal, but should")
+	}
+
+	cmd.ParseFlags([]string{"cluster", "create", "--ha-enabled", "--ssh-key", "test", "--ip-family", "dual-stack", "--cni", "calico", "--worker-count", "1", "--master-count", "3", "--isolated-etcd=false", "--etcd-count", "3"})
+	err = validateClusterCreateFlags(cmd, []string{})
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	cmd.ParseFlags([]string{"cluster", "create", "--ha-enabled", "--ssh-key", "test", "--ip-family", "ipv4", "--oidc-issuer-url", "http://accounts.example.com", "--oidc-client-id", "kubernetes"})
+	err = validateClusterCreateFlags(cmd, []string{})
+
+	if err == nil {
+		t.Error("no errors occurred with an OIDC issuer without https, but should")
+	}
+
+	cmd.ParseFlags([]string{"cluster", "create", "--ha-enabled", "--ssh-key", "test", "--oidc-issuer-url", "https://accounts.example.com", "--oidc-client-id", "kubernetes"})
+	err = validateClusterCreateFlags(cmd, []string{})
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	cmd.ParseFlags([]string{"cluster", "create", "--ha-enabled", "--ssh-key", "test", "--encrypt-secrets", "--encryption-provider", "aesgcm"})
+	err = validateClusterCreateFlags(cmd, []string{})
+
+	if err == nil {
+		t.Error("no errors occurred with an unsupported encryption provider, but should")
+	}
+
+	cmd.ParseFlags([]string{"cluster", "create", "--ha-enabled", "--ssh-key", "test", "--encryption-provider", "aescbc", "--audit", "--audit-log-max-age", "-1"})
+	err = validateClusterCreateFlags(cmd, []string{})
+
+	if err == nil {
+		t.Error("no errors occurred with a negative audit log age, but should")
+	}
 }
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/xetys/hetzner-kube/pkg/clustermanager"
+)
+
+var etcdMemberCmd = &cobra.Command{
+	Use:   "member",
+	Short: "manages the members of an etcd cluster",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Usage()
+	},
+}
+
+var etcdMemberListCmd = &cobra.Command{
+	Use:     "list <CLUSTER_NAME>",
+	Aliases: []string{"ls"},
+	Short:   "lists the members of the etcd cluster and their health",
+	Args:    cobra.ExactArgs(1),
+	PreRunE: validateEtcdMemberCmd(false),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		etcdManager := getEtcdManager(cmd, args)
+		if err := captureEtcdPassphrase(args[0]); err != nil {
+			return err
+		}
+
+		members, err := etcdManager.ListMembers()
+		if err != nil {
+			return err
+		}
+
+		health, err := etcdManager.MemberHealth()
+		if err != nil {
+			return err
+		}
+
+		tw := new(tabwriter.Writer)
+		tw.Init(os.Stdout, 0, 8, 2, '\t', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tSTATUS\tHEALTH\tPEER URLS\tCLIENT URLS")
+
+		for _, member := range members {
+			status := "unstarted"
+			if member.Started {
+				status = "started"
+			}
+
+			memberHealth := "unhealthy"
+			if health[member.Name] {
+				memberHealth = "healthy"
+			}
+
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s", member.ID, member.Name, status, memberHealth, member.PeerURLs, member.ClientURLs)
+			fmt.Fprintln(tw)
+		}
+
+		tw.Flush()
+		return nil
+	},
+}
+
+// validateEtcdMemberCmd checks if the cluster exists and runs an etcd cluster, which is managed by hetzner-kube.
+// If isolatedOnly is true, membership changes are only allowed for clusters with an isolated etcd
+func validateEtcdMemberCmd(isolatedOnly bool) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		err := validateClusterInArgumentExists(cmd, args)
+		if err != nil {
+			return err
+		}
+
+		_, cluster := AppConf.Config.FindClusterByName(args[0])
+		if !cluster.HaEnabled {
+			return errors.New("the cluster has no etcd cluster managed by hetzner-kube")
+		}
+
+		if isolatedOnly && !cluster.IsolatedEtcd {
+			return errors.New("etcd runs on the master nodes, use add-master and remove-master instead")
+		}
+
+		return nil
+	}
+}
+
+// captureEtcdPassphrase captures the passphrase of the SSH key used for the etcd nodes of a cluster
+func captureEtcdPassphrase(clusterName string) error {
+	_, cluster := AppConf.Config.FindClusterByName(clusterName)
+	for _, node := range cluster.Nodes {
+		if node.IsEtcd {
+			return AppConf.SSHClient.(*clustermanager.SSHCommunicator).CapturePassphrase(node.SSHKeyName)
+		}
+	}
+
+	return errors.New("no etcd node found")
+}
+
+func init() {
+	etcdCmd.AddCommand(etcdMemberCmd)
+	etcdMemberCmd.AddCommand(etcdMemberListCmd)
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/xetys/hetzner-kube/pkg"
+	"github.com/xetys/hetzner-kube/pkg/clustermanager"
+	"github.com/xetys/hetzner-kube/pkg/hetzner"
+)
+
+var etcdMemberAddCmd = &cobra.Command{
+	Use:   "add <CLUSTER_NAME>",
+	Short: "adds new nodes to an isolated etcd cluster",
+	Long: `Creates new etcd nodes and adds them one by one as members to the running etcd cluster.
+
+Afterwards the etcd endpoints of all api servers are updated. The command refuses to add a member,
+if the etcd cluster would lose its quorum while the new member is starting.`,
+	Args:    cobra.ExactArgs(1),
+	PreRunE: validateEtcdMemberCmd(true),
+	Run: func(cmd *cobra.Command, args []string) {
+		nodeCount, _ := cmd.Flags().GetInt("nodes")
+		serverType, _ := cmd.Flags().GetString("server-type")
+		datacenters, _ := cmd.Flags().GetStringSlice("datacenters")
+		_, cluster := AppConf.Config.FindClusterByName(args[0])
+
+		var sshKeyName string
+		maxNo := 0
+		for _, node := range cluster.Nodes {
+			if node.IsEtcd {
+				sshKeyName = node.SSHKeyName
+
+				nameParts := strings.Split(node.Name, "-")
+				no, _ := strconv.Atoi(nameParts[len(nameParts)-1])
+
+				if no > maxNo {
+					maxNo = no
+				}
+			}
+		}
+
+		err := captureEtcdPassphrase(cluster.Name)
+		FatalOnError(err)
+
+		coordinator := pkg.NewProgressCoordinator()
+		hetznerProvider := hetzner.NewHetznerProvider(AppConf.Context, AppConf.Client, *cluster, AppConf.CurrentContext.Token)
+		clusterManager := clustermanager.NewClusterManagerFromCluster(*cluster, hetznerProvider, AppConf.SSHClient, coordinator)
+
+		err = clustermanager.NewEtcdManager(hetznerProvider, AppConf.SSHClient).CheckAddMember()
+		FatalOnError(err)
+
+		nodes, err := hetznerProvider.CreateEtcdNodes(sshKeyName, serverType, datacenters, nodeCount, maxNo)
+		FatalOnError(err)
+
+		cluster.Nodes = append(cluster.Nodes, nodes...)
+		cluster.IPAllocations = hetznerProvider.GetCluster().IPAllocations
+		saveCluster(cluster)
+
+		// Is needed to the right wireguard config is created including the new nodes
+		clusterManager.AppendNodes(nodes)
+
+		log.Println("sleep for 30s...")
+		time.Sleep(30 * time.Second)
+
+		// only the new nodes get a progress bar, existing nodes are just reconfigured
+		provisionSteps := 8
+		netWorkSetupSteps := 2
+		etcdSteps := 5
+		for _, node := range nodes {
+			coordinator.StartProgress(node.Name, provisionSteps+netWorkSetupSteps+etcdSteps+6)
+		}
+
+		err = clusterManager.ProvisionNodes(nodes)
+		FatalOnError(err)
+
+		err = clusterManager.SetupEncryptedNetwork()
+		FatalOnError(err)
+		*cluster = clusterManager.Cluster()
+		saveCluster(cluster)
+
+		err = clusterManager.AddEtcdNodes(nodes)
+		FatalOnError(err)
+
+		for _, node := range nodes {
+			coordinator.CompleteProgress(node.Name)
+		}
+
+		coordinator.Wait()
+		log.Println("etcd members added successfully")
+	},
+}
+
+func init() {
+	etcdMemberCmd.AddCommand(etcdMemberAddCmd)
+
+	etcdMemberAddCmd.Flags().IntP("nodes", "n", 1, "Number of etcd nodes to add")
+	etcdMemberAddCmd.Flags().String("server-type", "cx11", "Server type used for the etcd nodes")
+	etcdMemberAddCmd.Flags().StringSlice("datacenters", []string{"fsn1-dc8", "nbg1-dc3", "hel1-dc2", "fsn1-dc14"}, "Can be used to filter datacenters by their name")
+}
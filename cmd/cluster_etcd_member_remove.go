@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/spf13/cobra"
+	"github.com/xetys/hetzner-kube/pkg"
+	"github.com/xetys/hetzner-kube/pkg/clustermanager"
+	"github.com/xetys/hetzner-kube/pkg/hetzner"
+)
+
+var etcdMemberRemoveCmd = &cobra.Command{
+	Use:   "remove <CLUSTER_NAME>",
+	Short: "removes a node from an isolated etcd cluster",
+	Long: `Removes a member from the running etcd cluster and deletes its server.
+
+The etcd endpoints of all api servers are updated first, so they stop using the member before it is removed.
+The command refuses to remove a member, if the etcd cluster would lose its quorum.`,
+	Args: cobra.ExactArgs(1),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := validateEtcdMemberCmd(true)(cmd, args); err != nil {
+			return err
+		}
+
+		nodeName, _ := cmd.Flags().GetString("node")
+		if nodeName == "" {
+			return errors.New("flag --node is required")
+		}
+
+		_, cluster := AppConf.Config.FindClusterByName(args[0])
+		for _, node := range cluster.Nodes {
+			if node.Name == nodeName && node.IsEtcd {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("etcd node '%s' not found", nodeName)
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		nodeName, _ := cmd.Flags().GetString("node")
+		_, cluster := AppConf.Config.FindClusterByName(args[0])
+
+		var etcdNode clustermanager.Node
+		for _, node := range cluster.Nodes {
+			if node.Name == nodeName {
+				etcdNode = node
+			}
+		}
+
+		err := captureEtcdPassphrase(cluster.Name)
+		FatalOnError(err)
+
+		coordinator := pkg.NewProgressCoordinator()
+		hetznerProvider := hetzner.NewHetznerProvider(AppConf.Context, AppConf.Client, *cluster, AppConf.CurrentContext.Token)
+		clusterManager := clustermanager.NewClusterManagerFromCluster(*cluster, hetznerProvider, AppConf.SSHClient, coordinator)
+
+		err = clusterManager.RemoveEtcdNodeFromCluster(etcdNode)
+		FatalOnError(err)
+
+		// the member already left etcd, so it is removed from the configuration even if the server cannot be deleted
+		*cluster = clusterManager.Cluster()
+		saveCluster(cluster)
+
+		// delete actual server
+		server, _, err := AppConf.Client.Server.Get(AppConf.Context, etcdNode.Name)
+		FatalOnError(err)
+
+		if server != nil {
+			_, err = AppConf.Client.Server.Delete(AppConf.Context, server)
+			FatalOnError(err)
+
+			log.Printf("server '%s' deleted", etcdNode.Name)
+		} else {
+			log.Printf("server '%s' was already deleted", etcdNode.Name)
+		}
+
+		log.Println("etcd member removed successfully")
+	},
+}
+
+func init() {
+	etcdMemberCmd.AddCommand(etcdMemberRemoveCmd)
+
+	etcdMemberRemoveCmd.Flags().StringP("node", "", "", "The name of the etcd node to remove")
+}
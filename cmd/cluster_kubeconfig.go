@@ -7,7 +7,9 @@ import (
 	"log"
 	"os"
 	"os/user"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/xetys/hetzner-kube/pkg/clustermanager"
@@ -18,12 +20,17 @@ import (
 var clusterKubeconfigCmd = &cobra.Command{
 	Use:   "kubeconfig <CLUSTER NAME>",
 	Short: "setups the kubeconfig for the local machine",
-	Long: `fetches the kubeconfig (e.g. for usage with kubectl) and saves it to ~/.kube/config, or prints it.
+	Long: `fetches the kubeconfig (e.g. for usage with kubectl) and merges it into ~/.kube/config, or prints it.
 
-Example 1: hetzner-kube cluster kubeconfig -n my-cluster # installs the kubeconfig of the cluster "my-cluster"
-Example 2: hetzner-kube cluster kubeconfig -n my-cluster -b # saves the existing before installing
-Example 3: hetzner-kube cluster kubeconfig -n my-cluster -p # prints the contents of kubeconfig to console
-Example 4: hetzner-kube cluster kubeconfig -n my-cluster -p > my-conf.yaml # prints the contents of kubeconfig into a custom file
+The cluster, user and context are named like the cluster, and replace existing entries with the same name. Other
+clusters in ~/.kube/config are kept.
+
+Example 1: hetzner-kube cluster kubeconfig my-cluster # merges the kubeconfig of the cluster "my-cluster"
+Example 2: hetzner-kube cluster kubeconfig my-cluster -s # merges the kubeconfig and switches to its context
+Example 3: hetzner-kube cluster kubeconfig my-cluster -b # saves the existing config with a timestamp before merging
+Example 4: hetzner-kube cluster kubeconfig my-cluster -p # prints the contents of kubeconfig to console
+Example 5: hetzner-kube cluster kubeconfig my-cluster -p > my-conf.yaml # prints the contents of kubeconfig into a custom file
+Example 6: hetzner-kube cluster kubeconfig my-cluster --remove # removes the cluster from ~/.kube/config
 	`,
 	Args:    cobra.ExactArgs(1),
 	PreRunE: validateClusterInArgumentExists,
@@ -31,6 +38,30 @@ Example 4: hetzner-kube cluster kubeconfig -n my-cluster -p > my-conf.yaml # pri
 		name := args[0]
 		_, cluster := AppConf.Config.FindClusterByName(name)
 
+		printContent, _ := cmd.Flags().GetBool("print")
+		force, _ := cmd.Flags().GetBool("force")
+		backup, _ := cmd.Flags().GetBool("backup")
+		setCurrent, _ := cmd.Flags().GetBool("set-current")
+		remove, _ := cmd.Flags().GetBool("remove")
+
+		usr, _ := user.Current()
+		path := filepath.Join(usr.HomeDir, ".kube")
+		kubeconfigPath := filepath.Join(path, "config")
+
+		if remove {
+			existing, err := readKubeConfig(kubeconfigPath)
+			FatalOnError(err)
+
+			if !clustermanager.HasKubeConfigEntry(existing, cluster.Name) {
+				fmt.Printf("cluster '%s' is not configured in %s\n", cluster.Name, kubeconfigPath)
+				return
+			}
+
+			FatalOnError(writeKubeConfig(kubeconfigPath, clustermanager.RemoveFromKubeConfig(existing, cluster.Name), backup))
+			fmt.Println("kubeconfig removed")
+			return
+		}
+
 		provider := hetzner.NewHetznerProvider(AppConf.Context, AppConf.Client, *cluster, AppConf.CurrentContext.Token)
 		masterNode, err := provider.GetMasterNode()
 		FatalOnError(err)
@@ -38,52 +69,87 @@ Example 4: hetzner-kube cluster kubeconfig -n my-cluster -p > my-conf.yaml # pri
 		err = AppConf.SSHClient.(*clustermanager.SSHCommunicator).CapturePassphrase(masterNode.SSHKeyName)
 		FatalOnError(err)
 
-		kubeConfigContent, err := AppConf.SSHClient.RunCmd(*masterNode, "cat /etc/kubernetes/admin.conf")
-		// change the IP to public
-		kubeConfigContent = strings.Replace(kubeConfigContent, masterNode.PrivateIPAddress, masterNode.IPAddress, -1)
-
+		kubeConfig, err := fetchAdminKubeConfig(masterNode)
 		FatalOnError(err)
-
-		printContent, _ := cmd.Flags().GetBool("print")
-		force, _ := cmd.Flags().GetBool("force")
+		kubeConfig = clustermanager.RenameKubeConfig(kubeConfig, cluster.Name)
 
 		if printContent {
-			fmt.Println(kubeConfigContent)
-		} else {
-			fmt.Println("create file")
+			content, err := clustermanager.MarshalKubeConfig(kubeConfig)
+			FatalOnError(err)
+			fmt.Println(content)
+			return
+		}
 
-			usr, _ := user.Current()
-			dir := usr.HomeDir
-			path := fmt.Sprintf("%s/.kube", dir)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			FatalOnError(os.MkdirAll(path, 0700))
+		}
 
-			if _, err := os.Stat(path); os.IsNotExist(err) {
-				os.MkdirAll(path, 0755)
-			}
+		existing, err := readKubeConfig(kubeconfigPath)
+		FatalOnError(err)
 
-			// check if there already is an existing config
-			kubeconfigPath := fmt.Sprintf("%s/config", path)
-			if _, err := os.Stat(kubeconfigPath); !force && err == nil {
-				fmt.Println("There already exists a kubeconfig. Overwrite? (use -f to suppress this question) [yN]:")
-				r := bufio.NewReader(os.Stdin)
-				answer, err := r.ReadString('\n')
-				FatalOnError(err)
-				if !strings.ContainsAny(answer, "yY") {
-					log.Fatalln("aborted")
-				}
+		// check if the cluster is already configured
+		if !force && clustermanager.HasKubeConfigEntry(existing, cluster.Name) {
+			fmt.Printf("The cluster '%s' is already configured. Overwrite? (use -f to suppress this question) [yN]:\n", cluster.Name)
+			r := bufio.NewReader(os.Stdin)
+			answer, err := r.ReadString('\n')
+			FatalOnError(err)
+			if !strings.ContainsAny(answer, "yY") {
+				log.Fatalln("aborted")
 			}
+		}
 
-			ioutil.WriteFile(kubeconfigPath, []byte(kubeConfigContent), 0755)
+		FatalOnError(writeKubeConfig(kubeconfigPath, clustermanager.MergeKubeConfig(existing, kubeConfig, setCurrent), backup))
 
-			fmt.Println("kubeconfig configured")
-		}
+		fmt.Printf("kubeconfig configured, use it with 'kubectl --context %s'\n", cluster.Name)
 	},
 }
 
+// readKubeConfig reads a kubeconfig file, which results in an empty kubeconfig if it does not exist
+func readKubeConfig(path string) (clustermanager.KubeConfig, error) {
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return clustermanager.ParseKubeConfig("")
+	}
+
+	if err != nil {
+		return clustermanager.KubeConfig{}, err
+	}
+
+	return clustermanager.ParseKubeConfig(string(content))
+}
+
+// writeKubeConfig writes a kubeconfig file, which is only readable by the user as it contains credentials. If
+// requested, an existing file is copied to a file with a timestamp suffix before
+func writeKubeConfig(path string, config clustermanager.KubeConfig, backup bool) error {
+	content, err := clustermanager.MarshalKubeConfig(config)
+	if err != nil {
+		return err
+	}
+
+	if existing, err := ioutil.ReadFile(path); backup && err == nil {
+		backupPath := fmt.Sprintf("%s.%s.bak", path, time.Now().Format("20060102-150405"))
+		if err := ioutil.WriteFile(backupPath, existing, 0600); err != nil {
+			return fmt.Errorf("unable to back up kubeconfig: %v", err)
+		}
+
+		fmt.Printf("existing kubeconfig saved to %s\n", backupPath)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		return err
+	}
+
+	// WriteFile keeps the permissions of existing files
+	return os.Chmod(path, 0600)
+}
+
 func init() {
 	clusterCmd.AddCommand(clusterKubeconfigCmd)
 
 	clusterKubeconfigCmd.Flags().StringP("name", "n", "", "name of the cluster")
 	clusterKubeconfigCmd.Flags().BoolP("print", "p", false, "prints output to stdout")
-	clusterKubeconfigCmd.Flags().BoolP("backup", "b", false, "saves existing config")
-	clusterKubeconfigCmd.Flags().BoolP("force", "f", false, "don't ask to overwrite")
+	clusterKubeconfigCmd.Flags().BoolP("backup", "b", false, "saves the existing config with a timestamp suffix")
+	clusterKubeconfigCmd.Flags().BoolP("force", "f", false, "don't ask to overwrite the entries of the cluster")
+	clusterKubeconfigCmd.Flags().BoolP("set-current", "s", false, "switches the current context to the cluster")
+	clusterKubeconfigCmd.Flags().Bool("remove", false, "removes the cluster from the kubeconfig")
 }
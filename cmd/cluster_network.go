@@ -0,0 +1,15 @@
+package cmd
+
+import "github.com/spf13/cobra"
+
+var networkCmd = &cobra.Command{
+	Use:   "network",
+	Short: "a subcommand for managing the encrypted network of a cluster",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Usage()
+	},
+}
+
+func init() {
+	clusterCmd.AddCommand(networkCmd)
+}
@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/xetys/hetzner-kube/pkg/clustermanager"
+	"github.com/xetys/hetzner-kube/pkg/hetzner"
+)
+
+// networkCheckCmd represents the cluster network check command
+var networkCheckCmd = &cobra.Command{
+	Use:   "check <CLUSTER_NAME>",
+	Short: "diagnoses the wireguard mesh of a cluster",
+	Long: `Diagnoses the encrypted network of all nodes of a cluster in parallel:
+
+	- the key and port of the running wireguard interface
+	- missing, unknown and misconfigured peers, compared to the stored nodes
+	- missing and stale handshakes
+	- drift of /etc/wireguard/wg0.conf from the stored cluster configuration
+	- the route of the pod network over wg0, set up by overlay-route.service
+	- a connectivity matrix, pinging the private IP address of every peer from every node
+
+The exit code is 0 if all checks passed, 1 on warnings and 2 on failed checks.`,
+	Args: cobra.ExactArgs(1),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := validateClusterInArgumentExists(cmd, args); err != nil {
+			return err
+		}
+
+		return validateOutputFlag(cmd)
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+		_, cluster := AppConf.Config.FindClusterByName(args[0])
+
+		provider := hetzner.NewHetznerProvider(AppConf.Context, AppConf.Client, *cluster, AppConf.CurrentContext.Token)
+		masterNode, err := provider.GetMasterNode()
+		FatalOnError(err)
+		err = AppConf.SSHClient.(*clustermanager.SSHCommunicator).CapturePassphrase(masterNode.SSHKeyName)
+		FatalOnError(err)
+
+		report := clustermanager.NewNetworkChecker(AppConf.SSHClient, *cluster).Run()
+		status := clustermanager.OverallStatus(report.Results)
+
+		if output == "json" {
+			reportJSON, err := json.MarshalIndent(struct {
+				Cluster string                     `json:"cluster"`
+				Status  clustermanager.CheckStatus `json:"status"`
+				clustermanager.NetworkReport
+			}{cluster.Name, status, report}, "", "    ")
+			FatalOnError(err)
+			fmt.Println(string(reportJSON))
+		} else {
+			tw := new(tabwriter.Writer)
+			tw.Init(os.Stdout, 0, 8, 2, '\t', 0)
+			fmt.Fprintln(tw, "NODE\tCHECK\tSTATUS\tMESSAGE")
+
+			for _, result := range report.Results {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s", result.Node, result.Check, result.Status, result.Message)
+				fmt.Fprintln(tw)
+			}
+
+			tw.Flush()
+			fmt.Println()
+			printConnectivityMatrix(cluster.Nodes, report.Connectivity)
+			fmt.Printf("\ncluster '%s' network status: %s\n", cluster.Name, status)
+		}
+
+		switch status {
+		case clustermanager.StatusWarning:
+			os.Exit(1)
+		case clustermanager.StatusCritical:
+			os.Exit(2)
+		}
+	},
+}
+
+// printConnectivityMatrix prints whether the nodes in the rows can ping the nodes in the columns
+func printConnectivityMatrix(nodes []clustermanager.Node, connectivity map[string]map[string]bool) {
+	tw := new(tabwriter.Writer)
+	tw.Init(os.Stdout, 0, 8, 2, '\t', 0)
+
+	header := []string{"FROM \\ TO"}
+	for _, node := range nodes {
+		header = append(header, node.Name)
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+
+	for _, source := range nodes {
+		row := []string{source.Name}
+		for _, target := range nodes {
+			reachable, checked := connectivity[source.Name][target.Name]
+			switch {
+			case source.Name == target.Name:
+				row = append(row, "-")
+			case !checked:
+				row = append(row, "?")
+			case reachable:
+				row = append(row, "ok")
+			default:
+				row = append(row, "FAIL")
+			}
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+
+	tw.Flush()
+}
+
+func init() {
+	networkCmd.AddCommand(networkCheckCmd)
+
+	networkCheckCmd.Flags().StringP("output", "o", "table", "output format, either table or json")
+}
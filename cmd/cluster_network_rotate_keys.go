@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/xetys/hetzner-kube/pkg/clustermanager"
+	"github.com/xetys/hetzner-kube/pkg/hetzner"
+)
+
+// networkRotateKeysCmd represents the cluster network rotate-keys command
+var networkRotateKeysCmd = &cobra.Command{
+	Use:   "rotate-keys <CLUSTER NAME>",
+	Short: "rotates the wireguard keys of the nodes",
+	Long: `Rotates the wireguard keys of the nodes of a cluster, one node after another.
+
+The new public key of a node is added to all of its peers with "wg set", before the node switches to its new
+private key. Wireguard is not restarted, so only the connections of the rotated node are interrupted until the
+first handshake with the new key. The configuration files are updated as well, to keep the keys across restarts.
+
+If the new key cannot be added to all peers, or the node cannot switch to it, the old key is restored on the peers.
+Should that fail as well, "hetzner-kube cluster phase network-setup" applies the saved keys again.
+
+With --preshared-keys, new preshared keys are generated for all connections of a rotated node.`,
+	Args: cobra.ExactArgs(1),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		idx, cluster := AppConf.Config.FindClusterByName(args[0])
+		if idx == -1 {
+			return fmt.Errorf("cluster '%s' not found", args[0])
+		}
+
+		if nodeName, _ := cmd.Flags().GetString("node"); nodeName != "" {
+			for _, node := range cluster.Nodes {
+				if node.Name == nodeName {
+					return nil
+				}
+			}
+
+			return fmt.Errorf("node '%s' not found", nodeName)
+		}
+
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		nodeName, _ := cmd.Flags().GetString("node")
+		olderThan, _ := cmd.Flags().GetDuration("older-than")
+		presharedKeys, _ := cmd.Flags().GetBool("preshared-keys")
+		_, cluster := AppConf.Config.FindClusterByName(args[0])
+
+		provider := hetzner.NewHetznerProvider(AppConf.Context, AppConf.Client, *cluster, AppConf.CurrentContext.Token)
+		masterNode, err := provider.GetMasterNode()
+		FatalOnError(err)
+
+		err = AppConf.SSHClient.(*clustermanager.SSHCommunicator).CapturePassphrase(masterNode.SSHKeyName)
+		FatalOnError(err)
+
+		clusterManager := clustermanager.NewClusterManagerFromCluster(*cluster, provider, AppConf.SSHClient, logEventService{})
+
+		rotated := 0
+		for _, node := range cluster.Nodes {
+			if nodeName != "" && node.Name != nodeName {
+				continue
+			}
+
+			// keys of clusters created before the creation time was recorded are always rotated
+			createdAt := node.WireGuardKeyPair.CreatedAt
+			if olderThan > 0 && !createdAt.IsZero() && time.Since(createdAt) < olderThan {
+				log.Printf("%s: key is younger than %s, skipped", node.Name, olderThan)
+				continue
+			}
+
+			err := clusterManager.RotateNodeKeys(node, presharedKeys)
+
+			// the keys are saved after every node, as the running wireguard interfaces use them already. A rotation which
+			// fails before the node switched to its new key keeps the saved keys, as the old key is restored on the peers
+			*cluster = clusterManager.Cluster()
+			saveCluster(cluster)
+			FatalOnError(err)
+
+			rotated++
+		}
+
+		log.Printf("rotated the keys of %d nodes", rotated)
+	},
+}
+
+func init() {
+	networkCmd.AddCommand(networkRotateKeysCmd)
+
+	networkRotateKeysCmd.Flags().String("node", "", "Rotate the key of this node only")
+	networkRotateKeysCmd.Flags().Duration("older-than", 0, "Rotate only keys older than this duration, e.g. 720h")
+	networkRotateKeysCmd.Flags().Bool("preshared-keys", false, "Generate new preshared keys for the connections of the rotated nodes")
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/xetys/hetzner-kube/pkg/clustermanager"
+	"github.com/xetys/hetzner-kube/pkg/hetzner"
+)
+
+// clusterPatchCmd represents the cluster patch command
+var clusterPatchCmd = &cobra.Command{
+	Use:   "patch <CLUSTER NAME>",
+	Short: "installs OS updates on all nodes",
+	Long: `Installs OS updates on all nodes of a cluster, one node after another.
+
+Each node is cordoned and drained, its packages are upgraded while kubelet, kubeadm, kubectl and docker stay at
+their version, and it is rebooted if /var/run/reboot-required exists. Before the node is uncordoned, the command
+waits until all wireguard peers are connected and the node is ready again.
+
+Workers are patched first, at most --max-unavailable at a time. Isolated etcd nodes and masters follow one by
+one, as long as the etcd cluster keeps its quorum. The rollout stops at the first failure.`,
+	Args: cobra.ExactArgs(1),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if idx, _ := AppConf.Config.FindClusterByName(args[0]); idx == -1 {
+			return fmt.Errorf("cluster '%s' not found", args[0])
+		}
+
+		if maxUnavailable, _ := cmd.Flags().GetInt("max-unavailable"); maxUnavailable < 1 {
+			return errors.New("flag --max-unavailable must be at least 1")
+		}
+
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		maxUnavailable, _ := cmd.Flags().GetInt("max-unavailable")
+		_, cluster := AppConf.Config.FindClusterByName(args[0])
+
+		provider := hetzner.NewHetznerProvider(AppConf.Context, AppConf.Client, *cluster, AppConf.CurrentContext.Token)
+		masterNode, err := provider.GetMasterNode()
+		FatalOnError(err)
+
+		err = AppConf.SSHClient.(*clustermanager.SSHCommunicator).CapturePassphrase(masterNode.SSHKeyName)
+		FatalOnError(err)
+
+		clusterManager := clustermanager.NewClusterManagerFromCluster(*cluster, provider, AppConf.SSHClient, logEventService{})
+		results := clusterManager.PatchNodes(maxUnavailable)
+
+		tw := new(tabwriter.Writer)
+		tw.Init(os.Stdout, 0, 8, 2, '\t', 0)
+		fmt.Fprintln(tw, "NODE\tSTATUS\tUPGRADED\tREBOOTED\tDURATION\tERROR")
+
+		failed := false
+		for _, result := range results {
+			message := ""
+			if result.Err != nil {
+				failed = true
+				message = result.Err.Error()
+			}
+
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%t\t%s\t%s", result.Node, result.Status, result.Upgraded, result.Rebooted, result.Duration, message)
+			fmt.Fprintln(tw)
+		}
+
+		tw.Flush()
+
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	clusterCmd.AddCommand(clusterPatchCmd)
+
+	clusterPatchCmd.Flags().Int("max-unavailable", 1, "Maximum number of workers patched at the same time")
+}
@@ -44,15 +44,7 @@ func getCommonPhaseDependencies(steps int, cmd *cobra.Command, args []string) (c
 		coordinator.StartProgress(node.Name, steps)
 	}
 
-	clusterManager := clustermanager.NewClusterManager(
-		provider,
-		AppConf.SSHClient,
-		coordinator,
-		clusterName,
-		cluster.HaEnabled,
-		cluster.IsolatedEtcd,
-		cluster.CloudInitFile,
-	)
+	clusterManager := clustermanager.NewClusterManagerFromCluster(*cluster, provider, AppConf.SSHClient, coordinator)
 
 	return provider, clusterManager, coordinator
 }
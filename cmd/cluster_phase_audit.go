@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/spf13/cobra"
+	"github.com/xetys/hetzner-kube/pkg"
+	"github.com/xetys/hetzner-kube/pkg/clustermanager"
+	"github.com/xetys/hetzner-kube/pkg/hetzner"
+	phases "github.com/xetys/hetzner-kube/pkg/phases"
+)
+
+var auditPhaseCommand = &cobra.Command{
+	Use:   "audit <CLUSTER_NAME>",
+	Short: "configures the audit log of the api servers",
+	Long: `Writes the audit policy to all masters and configures the api servers to log the requests matching it, or
+disables the audit log with --disable.
+
+The api server manifest is generated again by kubeadm on one master after another. The next master is updated once
+the api server of the previous one is healthy again.
+
+Example: hetzner-kube cluster phase audit my-cluster --policy-file policy.yaml --log-max-age 7`,
+	Args: cobra.ExactArgs(1),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := validateClusterInArgumentExists(cmd, args); err != nil {
+			return err
+		}
+
+		settings, err := auditSettingsFromFlags(cmd, "")
+		if err != nil {
+			return err
+		}
+
+		return clustermanager.ValidateAuditSettings(settings)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, cluster := AppConf.Config.FindClusterByName(args[0])
+
+		settings := clustermanager.AuditSettings{}
+		if disable, _ := cmd.Flags().GetBool("disable"); !disable {
+			var err error
+			settings, err = auditSettingsFromFlags(cmd, "")
+			if err != nil {
+				return err
+			}
+		}
+
+		provider := hetzner.NewHetznerProvider(AppConf.Context, AppConf.Client, *cluster, AppConf.CurrentContext.Token)
+		masterNode, err := provider.GetMasterNode()
+		if err != nil {
+			return err
+		}
+		err = AppConf.SSHClient.(*clustermanager.SSHCommunicator).CapturePassphrase(masterNode.SSHKeyName)
+		if err != nil {
+			return err
+		}
+		coordinator := pkg.NewProgressCoordinator()
+
+		for _, node := range provider.GetMasterNodes() {
+			coordinator.StartProgress(node.Name, 4)
+		}
+
+		clusterManager := clustermanager.NewClusterManagerFromCluster(*cluster, provider, AppConf.SSHClient, coordinator)
+
+		phase := phases.NewAuditPhase(clusterManager, settings)
+
+		if phase.ShouldRun() {
+			err := phase.Run()
+			if err != nil {
+				return err
+			}
+		}
+
+		*cluster = clusterManager.Cluster()
+		saveCluster(cluster)
+
+		for _, node := range provider.GetMasterNodes() {
+			coordinator.AddEvent(node.Name, pkg.CompletedEvent)
+		}
+
+		coordinator.Wait()
+		return nil
+	},
+}
+
+// auditSettingsFromFlags reads enabled audit settings from the flags with the given prefix. The policy and webhook
+// configuration are read from the files passed
+func auditSettingsFromFlags(cmd *cobra.Command, prefix string) (clustermanager.AuditSettings, error) {
+	maxAge, _ := cmd.Flags().GetInt(prefix + "log-max-age")
+	maxBackup, _ := cmd.Flags().GetInt(prefix + "log-max-backup")
+	maxSize, _ := cmd.Flags().GetInt(prefix + "log-max-size")
+	settings := clustermanager.AuditSettings{
+		Enabled:   true,
+		MaxAge:    maxAge,
+		MaxBackup: maxBackup,
+		MaxSize:   maxSize,
+	}
+
+	if policyFile, _ := cmd.Flags().GetString(prefix + "policy-file"); policyFile != "" {
+		policy, err := ioutil.ReadFile(policyFile)
+		if err != nil {
+			return settings, fmt.Errorf("unable to read audit policy: %v", err)
+		}
+		settings.Policy = string(policy)
+	}
+
+	if webhookConfigFile, _ := cmd.Flags().GetString(prefix + "webhook-config-file"); webhookConfigFile != "" {
+		webhookConfig, err := ioutil.ReadFile(webhookConfigFile)
+		if err != nil {
+			return settings, fmt.Errorf("unable to read audit webhook configuration: %v", err)
+		}
+		settings.WebhookConfig = string(webhookConfig)
+	}
+
+	return settings, nil
+}
+
+func init() {
+	phaseCommand.AddCommand(auditPhaseCommand)
+
+	auditPhaseCommand.Flags().String("policy-file", "", "audit policy file, a default policy is used if empty")
+	auditPhaseCommand.Flags().String("webhook-config-file", "", "kubeconfig of a webhook the audit events are sent to")
+	auditPhaseCommand.Flags().Int("log-max-age", clustermanager.DefaultAuditLogMaxAge, "days old audit logs are kept")
+	auditPhaseCommand.Flags().Int("log-max-backup", clustermanager.DefaultAuditLogMaxBackup, "number of old audit logs which are kept")
+	auditPhaseCommand.Flags().Int("log-max-size", clustermanager.DefaultAuditLogMaxSize, "size in megabytes the audit log is rotated at")
+	auditPhaseCommand.Flags().Bool("disable", false, "disables the audit log")
+}
@@ -46,15 +46,7 @@ var installMastersPhaseCommand = &cobra.Command{
 			coordinator.StartProgress(node.Name, steps)
 		}
 
-		clusterManager := clustermanager.NewClusterManager(
-			provider,
-			AppConf.SSHClient,
-			coordinator,
-			clusterName,
-			cluster.HaEnabled,
-			cluster.IsolatedEtcd,
-			cluster.CloudInitFile,
-		)
+		clusterManager := clustermanager.NewClusterManagerFromCluster(*cluster, provider, AppConf.SSHClient, coordinator)
 		phase := phases.NewInstallMastersPhase(clusterManager, phaseOptions)
 
 		if phase.ShouldRun() {
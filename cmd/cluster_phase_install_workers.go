@@ -36,15 +36,7 @@ var installWorkersCommand = &cobra.Command{
 			coordinator.StartProgress(node.Name, steps)
 		}
 
-		clusterManager := clustermanager.NewClusterManager(
-			provider,
-			AppConf.SSHClient,
-			coordinator,
-			clusterName,
-			cluster.HaEnabled,
-			cluster.IsolatedEtcd,
-			cluster.CloudInitFile,
-		)
+		clusterManager := clustermanager.NewClusterManagerFromCluster(*cluster, provider, AppConf.SSHClient, coordinator)
 		phase := phases2.NewInstallWorkersPhase(clusterManager)
 
 		if phase.ShouldRun() {
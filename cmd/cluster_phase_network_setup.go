@@ -20,6 +20,11 @@ var networkSetupPhaseCommand = &cobra.Command{
 			return err
 		}
 
+		// nodes without a key pair got a new one
+		_, cluster := AppConf.Config.FindClusterByName(args[0])
+		*cluster = clusterManager.Cluster()
+		saveCluster(cluster)
+
 		for _, node := range provider.GetAllNodes() {
 			coordinator.AddEvent(node.Name, pkg.CompletedEvent)
 		}
@@ -9,7 +9,7 @@ import (
 
 var kubeRestartPhaseCommand = &cobra.Command{
 	Use:     "restart <CLUSTER_NAME>",
-	Short:   "restart kubelet and docker",
+	Short:   "restart kubelet and the container runtime",
 	Args:    cobra.ExactArgs(1),
 	PreRunE: validateClusterInArgumentExists,
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -26,7 +26,7 @@ var kubeRestartPhaseCommand = &cobra.Command{
 			return err
 		}
 
-		phase := phases.NewKubeRestartPhase(provider, AppConf.SSHClient)
+		phase := phases.NewKubeRestartPhase(provider, AppConf.SSHClient, cluster.ContainerRuntime)
 
 		return phase.Run()
 	},
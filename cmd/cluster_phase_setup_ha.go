@@ -38,15 +38,7 @@ var setupHAPhaseCommand = &cobra.Command{
 			coordinator.StartProgress(node.Name, steps)
 		}
 
-		clusterManager := clustermanager.NewClusterManager(
-			provider,
-			AppConf.SSHClient,
-			coordinator,
-			clusterName,
-			cluster.HaEnabled,
-			cluster.IsolatedEtcd,
-			cluster.CloudInitFile,
-		)
+		clusterManager := clustermanager.NewClusterManagerFromCluster(*cluster, provider, AppConf.SSHClient, coordinator)
 
 		phase := phases.NewSetupHighAvailabilityPhase(clusterManager)
 
@@ -61,10 +61,13 @@ var clusterRemoveExternalWorkerCmd = &cobra.Command{
 
 				log.Printf("deletion failed %s", err)
 				cluster.Nodes = append(cluster.Nodes[:idx], cluster.Nodes[idx+1:]...)
+				delete(cluster.IPAllocations, node.Name)
 				saveCluster(cluster)
 			}
 		}
 
+		updateWireguardPeers(cluster)
+
 		log.Println("node deleted successfully")
 	},
 }
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/spf13/cobra"
+	"github.com/xetys/hetzner-kube/pkg"
+	"github.com/xetys/hetzner-kube/pkg/clustermanager"
+	"github.com/xetys/hetzner-kube/pkg/hetzner"
+)
+
+// clusterRemoveMasterCmd represents the command for removing masters
+var clusterRemoveMasterCmd = &cobra.Command{
+	Use:   "remove-master",
+	Short: "remove a master from the control plane",
+	Long: `Removes a master node from the control plane of a HA cluster and deletes the server.
+
+If etcd is running on the master nodes, the node is removed from the etcd cluster as well. This command
+can also be used to replace a dead master, by removing it and adding a new one using add-master.`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		name, err := cmd.Flags().GetString("name")
+		if err != nil {
+			return nil
+		}
+
+		if name == "" {
+			return errors.New("flag --name is required")
+		}
+
+		idx, cluster := AppConf.Config.FindClusterByName(name)
+
+		if idx == -1 {
+			return fmt.Errorf("cluster '%s' not found", name)
+		}
+
+		if !cluster.HaEnabled {
+			return errors.New("masters can only be removed from clusters created with --ha-enabled")
+		}
+
+		masterName, _ := cmd.Flags().GetString("master")
+
+		if masterName == "" {
+			return errors.New("master name cannot be empty")
+		}
+
+		masterCount := 0
+		found := false
+		for _, node := range cluster.Nodes {
+			if node.IsMaster {
+				masterCount++
+				found = found || node.Name == masterName
+			}
+		}
+
+		if !found {
+			return errors.New("master not found")
+		}
+
+		if masterCount < 2 {
+			return errors.New("cannot remove the last master of a cluster")
+		}
+
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		name, _ := cmd.Flags().GetString("name")
+		masterName, _ := cmd.Flags().GetString("master")
+		_, cluster := AppConf.Config.FindClusterByName(name)
+
+		var masterNode clustermanager.Node
+		for _, node := range cluster.Nodes {
+			if node.Name == masterName {
+				masterNode = node
+			}
+		}
+
+		err := AppConf.SSHClient.(*clustermanager.SSHCommunicator).CapturePassphrase(masterNode.SSHKeyName)
+		FatalOnError(err)
+
+		coordinator := pkg.NewProgressCoordinator()
+		hetznerProvider := hetzner.NewHetznerProvider(AppConf.Context, AppConf.Client, *cluster, AppConf.CurrentContext.Token)
+		clusterManager := clustermanager.NewClusterManagerFromCluster(*cluster, hetznerProvider, AppConf.SSHClient, coordinator)
+
+		err = clusterManager.RemoveMaster(masterNode)
+		FatalOnError(err)
+
+		// the master already left etcd and kubernetes, so it is removed from the configuration even if the server
+		// cannot be deleted
+		*cluster = clusterManager.Cluster()
+		saveCluster(cluster)
+
+		// delete actual server
+		server, _, err := AppConf.Client.Server.Get(AppConf.Context, masterNode.Name)
+		FatalOnError(err)
+
+		if server != nil {
+			_, err = AppConf.Client.Server.Delete(AppConf.Context, server)
+			FatalOnError(err)
+
+			log.Printf("server '%s' deleted", masterNode.Name)
+		} else {
+			log.Printf("server '%s' was already deleted", masterNode.Name)
+		}
+
+		log.Println("master removed successfully")
+	},
+}
+
+func init() {
+	clusterCmd.AddCommand(clusterRemoveMasterCmd)
+
+	clusterRemoveMasterCmd.Flags().StringP("name", "", "", "Name of the cluster where to remove the master")
+	clusterRemoveMasterCmd.Flags().StringP("master", "m", "", "The name of the master to remove")
+}
@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/xetys/hetzner-kube/pkg/clustermanager"
+	"github.com/xetys/hetzner-kube/pkg/hetzner"
+)
+
+// clusterRepairCmd represents the cluster repair command
+var clusterRepairCmd = &cobra.Command{
+	Use:   "repair <CLUSTER NAME>",
+	Short: "replaces unhealthy worker nodes",
+	Long: `Detects workers which are not ready for longer than --threshold and replaces them. Workers whose readiness is unknown,
+as the api server is not available or they are not registered, are replaced if they are unreachable via SSH for
+--threshold.
+
+Each unhealthy worker is drained and deleted from kubernetes, its server is deleted and recreated with the same name
+and private IP. Afterwards the node is provisioned again, joins the encrypted network and the cluster. External workers
+are never repaired.
+
+With --watch the check is repeated every --interval until the command is stopped.`,
+	Args: cobra.ExactArgs(1),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if idx, _ := AppConf.Config.FindClusterByName(args[0]); idx == -1 {
+			return fmt.Errorf("cluster '%s' not found", args[0])
+		}
+
+		if maxRepairs, _ := cmd.Flags().GetInt("max-repairs"); maxRepairs < 1 {
+			return errors.New("flag --max-repairs must be at least 1")
+		}
+
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		watch, _ := cmd.Flags().GetBool("watch")
+		interval, _ := cmd.Flags().GetDuration("interval")
+		_, cluster := AppConf.Config.FindClusterByName(args[0])
+
+		for _, node := range cluster.Nodes {
+			if node.IsMaster {
+				err := AppConf.SSHClient.(*clustermanager.SSHCommunicator).CapturePassphrase(node.SSHKeyName)
+				FatalOnError(err)
+				break
+			}
+		}
+
+		for {
+			err := repairCluster(cmd, cluster)
+			if !watch {
+				FatalOnError(err)
+				return
+			}
+
+			if err != nil {
+				log.Printf("repair failed: %v", err)
+			}
+
+			time.Sleep(interval)
+		}
+	},
+}
+
+// repairCluster replaces up to --max-repairs unhealthy workers of the cluster
+func repairCluster(cmd *cobra.Command, cluster *clustermanager.Cluster) error {
+	threshold, _ := cmd.Flags().GetDuration("threshold")
+	maxRepairs, _ := cmd.Flags().GetInt("max-repairs")
+	datacenters, _ := cmd.Flags().GetStringSlice("datacenters")
+
+	hetznerProvider := hetzner.NewHetznerProvider(AppConf.Context, AppConf.Client, *cluster, AppConf.CurrentContext.Token)
+	clusterManager := clustermanager.NewClusterManagerFromCluster(*cluster, hetznerProvider, AppConf.SSHClient, logEventService{})
+
+	unhealthyNodes, err := clusterManager.UnhealthyWorkers(threshold)
+	if err != nil {
+		return err
+	}
+
+	if len(unhealthyNodes) == 0 {
+		log.Println("all workers are healthy")
+		return nil
+	}
+
+	if len(unhealthyNodes) > maxRepairs {
+		log.Printf("found %d unhealthy workers, repairing only %d of them", len(unhealthyNodes), maxRepairs)
+		unhealthyNodes = unhealthyNodes[:maxRepairs]
+	}
+
+	for _, unhealthy := range unhealthyNodes {
+		log.Printf("%s: %s, repairing", unhealthy.Node.Name, unhealthy.Reason)
+		if err := repairNode(clusterManager, hetznerProvider, unhealthy.Node, datacenters, cluster.HaEnabled); err != nil {
+			return fmt.Errorf("unable to repair node '%s': %v", unhealthy.Node.Name, err)
+		}
+
+		*cluster = clusterManager.Cluster()
+		saveCluster(cluster)
+		log.Printf("%s: repaired successfully", unhealthy.Node.Name)
+	}
+
+	return nil
+}
+
+// repairNode recreates the server of a worker and lets it join the cluster again
+func repairNode(clusterManager *clustermanager.Manager, hetznerProvider *hetzner.Provider, node clustermanager.Node, datacenters []string, haEnabled bool) error {
+	if err := clusterManager.DrainAndDeleteNode(node); err != nil {
+		log.Printf("%s: unable to delete node from kubernetes: %v", node.Name, err)
+	}
+
+	node, err := hetznerProvider.RecreateNode(node, datacenters)
+	if err != nil {
+		return err
+	}
+	clusterManager.ReplaceNode(node)
+
+	log.Printf("%s: waiting 30s for the server to boot...", node.Name)
+	time.Sleep(30 * time.Second)
+
+	nodes := []clustermanager.Node{node}
+	if err := clusterManager.ProvisionNodes(nodes); err != nil {
+		return err
+	}
+
+	// the new server has a new wireguard key, so all peers need a new configuration
+	if err := clusterManager.SetupEncryptedNetwork(); err != nil {
+		return err
+	}
+
+	if haEnabled {
+		if err := clusterManager.DeployLoadBalancer(nodes); err != nil {
+			return err
+		}
+	}
+
+	return clusterManager.InstallWorkers(nodes)
+}
+
+func init() {
+	clusterCmd.AddCommand(clusterRepairCmd)
+
+	clusterRepairCmd.Flags().Bool("watch", false, "Keep checking the cluster and repair workers continuously")
+	clusterRepairCmd.Flags().Duration("threshold", 5*time.Minute, "Time a worker must be not ready before it gets replaced")
+	clusterRepairCmd.Flags().Duration("interval", time.Minute, "Time between two checks in watch mode")
+	clusterRepairCmd.Flags().Int("max-repairs", 1, "Maximum number of workers replaced per check")
+	clusterRepairCmd.Flags().StringSlice("datacenters", []string{"fsn1-dc8", "nbg1-dc3", "hel1-dc2", "fsn1-dc14"}, "Datacenters used, if the server of a worker is already gone")
+}
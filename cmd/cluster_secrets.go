@@ -0,0 +1,15 @@
+package cmd
+
+import "github.com/spf13/cobra"
+
+var secretsCmd = &cobra.Command{
+	Use:   "secrets",
+	Short: "a subcommand for managing the encryption of secrets",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Usage()
+	},
+}
+
+func init() {
+	clusterCmd.AddCommand(secretsCmd)
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/spf13/cobra"
+	"github.com/xetys/hetzner-kube/pkg/clustermanager"
+	"github.com/xetys/hetzner-kube/pkg/hetzner"
+)
+
+// secretsRotateKeyCmd represents the cluster secrets rotate-key command
+var secretsRotateKeyCmd = &cobra.Command{
+	Use:   "rotate-key <CLUSTER NAME>",
+	Short: "rotates the key secrets are encrypted with",
+	Long: `Rotates the key secrets are encrypted with in etcd, without making any secret unreadable:
+
+	1. the new key is added to all api servers, so all of them can read secrets encrypted with it
+	2. the new key is used to encrypt secrets on all api servers
+	3. all secrets are written again, so they are encrypted with the new key
+	4. the old keys are removed from all api servers
+
+The api servers are updated one after another in every step. The cluster configuration is saved after every
+step, also if it fails, so the stored keys always contain the keys of the api servers.`,
+	Args: cobra.ExactArgs(1),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		idx, cluster := AppConf.Config.FindClusterByName(args[0])
+		if idx == -1 {
+			return fmt.Errorf("cluster '%s' not found", args[0])
+		}
+
+		if !cluster.SecretsEncryption.Enabled() {
+			return fmt.Errorf("secrets of cluster '%s' are not encrypted, create it with --encrypt-secrets", cluster.Name)
+		}
+
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		_, cluster := AppConf.Config.FindClusterByName(args[0])
+
+		provider := hetzner.NewHetznerProvider(AppConf.Context, AppConf.Client, *cluster, AppConf.CurrentContext.Token)
+		masterNode, err := provider.GetMasterNode()
+		FatalOnError(err)
+
+		err = AppConf.SSHClient.(*clustermanager.SSHCommunicator).CapturePassphrase(masterNode.SSHKeyName)
+		FatalOnError(err)
+
+		clusterManager := clustermanager.NewClusterManagerFromCluster(*cluster, provider, AppConf.SSHClient, logEventService{})
+		applyEncryption := func(keys []clustermanager.EncryptionKey) {
+			settings := clustermanager.SecretsEncryptionSettings{Provider: cluster.SecretsEncryption.Provider, Keys: keys}
+			err := clusterManager.ApplySecretsEncryption(settings)
+
+			// some api servers may already use the keys, so they are saved also after a failure
+			*cluster = clusterManager.Cluster()
+			saveCluster(cluster)
+			FatalOnError(err)
+		}
+
+		newKey, err := clustermanager.GenerateEncryptionKey()
+		FatalOnError(err)
+		oldKeys := cluster.SecretsEncryption.Keys
+
+		log.Printf("adding key %s", newKey.Name)
+		applyEncryption(append(append([]clustermanager.EncryptionKey{}, oldKeys...), newKey))
+
+		log.Printf("encrypting with key %s", newKey.Name)
+		applyEncryption(append([]clustermanager.EncryptionKey{newKey}, oldKeys...))
+
+		log.Println("rewriting all secrets")
+		FatalOnError(clusterManager.RewriteSecrets())
+
+		log.Println("removing the old keys")
+		applyEncryption([]clustermanager.EncryptionKey{newKey})
+
+		log.Printf("secrets of cluster '%s' are encrypted with key %s", cluster.Name, newKey.Name)
+	},
+}
+
+func init() {
+	secretsCmd.AddCommand(secretsRotateKeyCmd)
+}
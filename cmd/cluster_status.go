@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/xetys/hetzner-kube/pkg/clustermanager"
+	"github.com/xetys/hetzner-kube/pkg/hetzner"
+)
+
+// clusterStatusCmd represents the cluster status command
+var clusterStatusCmd = &cobra.Command{
+	Use:   "status <CLUSTER_NAME>",
+	Short: "checks the health of a cluster",
+	Long: `Checks the health of all nodes of a cluster in parallel:
+
+	- SSH reachability
+	- wireguard handshakes with all peers
+	- container runtime, kubelet and etcd services
+	- etcd endpoint health (HA clusters)
+	- kubernetes node readiness
+	- the master load balancer (HA clusters)
+
+Wireguard only does handshakes while there is traffic, so idle peers are pinged before a missing or stale
+handshake is reported.
+
+The exit code is suitable for monitoring: 0 if all checks passed, 1 on warnings and 2 on failed checks.`,
+	Args: cobra.ExactArgs(1),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := validateClusterInArgumentExists(cmd, args); err != nil {
+			return err
+		}
+
+		return validateOutputFlag(cmd)
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+		_, cluster := AppConf.Config.FindClusterByName(args[0])
+
+		provider := hetzner.NewHetznerProvider(AppConf.Context, AppConf.Client, *cluster, AppConf.CurrentContext.Token)
+		masterNode, err := provider.GetMasterNode()
+		FatalOnError(err)
+		err = AppConf.SSHClient.(*clustermanager.SSHCommunicator).CapturePassphrase(masterNode.SSHKeyName)
+		FatalOnError(err)
+
+		checker := clustermanager.NewStatusChecker(provider, AppConf.SSHClient, *cluster)
+		results := checker.Run()
+		status := clustermanager.OverallStatus(results)
+
+		if output == "json" {
+			report := struct {
+				Cluster string                       `json:"cluster"`
+				Status  clustermanager.CheckStatus   `json:"status"`
+				Checks  []clustermanager.CheckResult `json:"checks"`
+			}{cluster.Name, status, results}
+
+			reportJSON, err := json.MarshalIndent(report, "", "    ")
+			FatalOnError(err)
+			fmt.Println(string(reportJSON))
+		} else {
+			tw := new(tabwriter.Writer)
+			tw.Init(os.Stdout, 0, 8, 2, '\t', 0)
+			fmt.Fprintln(tw, "NODE\tCHECK\tSTATUS\tMESSAGE")
+
+			for _, result := range results {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s", result.Node, result.Check, result.Status, result.Message)
+				fmt.Fprintln(tw)
+			}
+
+			tw.Flush()
+			fmt.Printf("\ncluster '%s' status: %s\n", cluster.Name, status)
+		}
+
+		switch status {
+		case clustermanager.StatusWarning:
+			os.Exit(1)
+		case clustermanager.StatusCritical:
+			os.Exit(2)
+		}
+	},
+}
+
+func init() {
+	clusterCmd.AddCommand(clusterStatusCmd)
+
+	clusterStatusCmd.Flags().StringP("output", "o", "table", "output format, either table or json")
+}
@@ -0,0 +1,15 @@
+package cmd
+
+import "github.com/spf13/cobra"
+
+var userCmd = &cobra.Command{
+	Use:   "user",
+	Short: "a subcommand for managing the users of a cluster",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Usage()
+	},
+}
+
+func init() {
+	clusterCmd.AddCommand(userCmd)
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/xetys/hetzner-kube/pkg/clustermanager"
+	"github.com/xetys/hetzner-kube/pkg/hetzner"
+)
+
+// userAddCmd represents the cluster user add command
+var userAddCmd = &cobra.Command{
+	Use:   "add <CLUSTER NAME>",
+	Short: "issues a kubeconfig for a user",
+	Long: `Issues a client certificate for a user and prints a kubeconfig using it.
+
+The private key is generated locally, its certificate is signed with the cluster CA on the first master. The user
+is authenticated with its name and groups, and is only allowed what is bound to them by RBAC. With --role, the
+given cluster role (e.g. view, edit or admin) is bound to the user, in --namespace or cluster wide.
+
+Client certificates cannot be revoked before they expire, so keep --ttl short. Issuing a certificate for an
+existing user replaces the tracked certificate, but the old one stays valid until it expires.
+
+Example: hetzner-kube cluster user add my-cluster --user alice --group devs --ttl 720h --role edit --namespace dev > alice.conf`,
+	Args: cobra.ExactArgs(1),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if idx, _ := AppConf.Config.FindClusterByName(args[0]); idx == -1 {
+			return fmt.Errorf("cluster '%s' not found", args[0])
+		}
+
+		userName, _ := cmd.Flags().GetString("user")
+		if userName == "" {
+			return errors.New("flag --user is required")
+		}
+
+		if err := clustermanager.ValidateUserName(userName); err != nil {
+			return err
+		}
+
+		role, _ := cmd.Flags().GetString("role")
+		namespace, _ := cmd.Flags().GetString("namespace")
+		if err := clustermanager.ValidateUserRoleBinding(role, namespace); err != nil {
+			return err
+		}
+
+		if ttl, _ := cmd.Flags().GetDuration("ttl"); ttl <= 0 {
+			return errors.New("flag --ttl must be positive")
+		}
+
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		userName, _ := cmd.Flags().GetString("user")
+		groups, _ := cmd.Flags().GetStringSlice("group")
+		ttl, _ := cmd.Flags().GetDuration("ttl")
+		role, _ := cmd.Flags().GetString("role")
+		namespace, _ := cmd.Flags().GetString("namespace")
+		outputFile, _ := cmd.Flags().GetString("output-file")
+		_, cluster := AppConf.Config.FindClusterByName(args[0])
+
+		provider := hetzner.NewHetznerProvider(AppConf.Context, AppConf.Client, *cluster, AppConf.CurrentContext.Token)
+		masterNode, err := provider.GetMasterNode()
+		FatalOnError(err)
+
+		err = AppConf.SSHClient.(*clustermanager.SSHCommunicator).CapturePassphrase(masterNode.SSHKeyName)
+		FatalOnError(err)
+
+		adminConfig, err := fetchAdminKubeConfig(masterNode)
+		FatalOnError(err)
+
+		clusterManager := clustermanager.NewClusterManagerFromCluster(*cluster, provider, AppConf.SSHClient, logEventService{})
+		user, credentials, err := clusterManager.AddUser(clustermanager.ClusterUser{
+			Name:      userName,
+			Groups:    groups,
+			Role:      role,
+			Namespace: namespace,
+		}, ttl)
+		FatalOnError(err)
+
+		*cluster = clusterManager.Cluster()
+		saveCluster(cluster)
+
+		content, err := clustermanager.MarshalKubeConfig(clustermanager.UserKubeConfig(adminConfig, cluster.Name, user, credentials))
+		FatalOnError(err)
+
+		if outputFile != "" {
+			FatalOnError(ioutil.WriteFile(outputFile, []byte(content), 0600))
+		} else {
+			fmt.Println(content)
+		}
+
+		log.Printf("certificate of user '%s' issued, valid until %s", user.Name, user.Expires.Format(time.RFC3339))
+	},
+}
+
+func init() {
+	userCmd.AddCommand(userAddCmd)
+
+	userAddCmd.Flags().String("user", "", "name of the user")
+	userAddCmd.Flags().StringSlice("group", []string{}, "groups of the user, can be passed multiple times")
+	userAddCmd.Flags().Duration("ttl", 720*time.Hour, "validity of the certificate, rounded up to full days")
+	userAddCmd.Flags().String("role", "", "cluster role bound to the user, e.g. view, edit or admin")
+	userAddCmd.Flags().String("namespace", "", "namespace the role is bound in, and the default namespace of the kubeconfig")
+	userAddCmd.Flags().StringP("output-file", "f", "", "writes the kubeconfig to a file instead of printing it")
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// userListCmd represents the cluster user list command
+var userListCmd = &cobra.Command{
+	Use:     "list <CLUSTER NAME>",
+	Short:   "lists the users which were issued a certificate",
+	Args:    cobra.ExactArgs(1),
+	PreRunE: validateClusterInArgumentExists,
+	Run: func(cmd *cobra.Command, args []string) {
+		_, cluster := AppConf.Config.FindClusterByName(args[0])
+
+		tw := new(tabwriter.Writer)
+		tw.Init(os.Stdout, 0, 8, 2, '\t', 0)
+		fmt.Fprintln(tw, "NAME\tGROUPS\tROLE\tNAMESPACE\tSERIAL\tEXPIRES\tSTATUS")
+
+		now := time.Now()
+		for _, user := range cluster.Users {
+			status := "valid"
+			if !user.Expires.After(now) {
+				status = "expired"
+			}
+
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s", user.Name, strings.Join(user.Groups, ","), user.Role, user.Namespace, user.Serial, user.Expires.Format(time.RFC3339), status)
+			fmt.Fprintln(tw)
+		}
+
+		tw.Flush()
+	},
+}
+
+func init() {
+	userCmd.AddCommand(userListCmd)
+}
@@ -5,6 +5,9 @@ import (
 	"log"
 
 	"github.com/Pallinder/go-randomdata"
+	"github.com/spf13/cobra"
+	"github.com/xetys/hetzner-kube/pkg/clustermanager"
+	"github.com/xetys/hetzner-kube/pkg/hetzner"
 )
 
 func randomName() string {
@@ -17,3 +20,47 @@ func FatalOnError(err error) {
 		log.Fatal(err)
 	}
 }
+
+// fetchAdminKubeConfig reads the admin kubeconfig from a master. The server of admin.conf is only reachable on the
+// master, so it is replaced with the public IP of the master
+func fetchAdminKubeConfig(masterNode *clustermanager.Node) (clustermanager.KubeConfig, error) {
+	content, err := AppConf.SSHClient.RunCmd(*masterNode, "cat /etc/kubernetes/admin.conf")
+	if err != nil {
+		return clustermanager.KubeConfig{}, err
+	}
+
+	kubeConfig, err := clustermanager.ParseKubeConfig(content)
+	if err != nil {
+		return clustermanager.KubeConfig{}, err
+	}
+
+	return clustermanager.SetKubeConfigServer(kubeConfig, fmt.Sprintf("https://%s:6443", masterNode.IPAddress)), nil
+}
+
+// validateOutputFlag checks that the output format of a reporting command is table or json
+func validateOutputFlag(cmd *cobra.Command) error {
+	if output, _ := cmd.Flags().GetString("output"); output != "table" && output != "json" {
+		return fmt.Errorf("invalid output format '%s', must be table or json", output)
+	}
+
+	return nil
+}
+
+// logEventService is an event service which logs events instead of rendering progress bars, e.g. for unattended commands
+type logEventService struct{}
+
+// AddEvent logs the event for the given node
+func (logEventService) AddEvent(nodeName string, eventMessage string) {
+	log.Printf("%s: %s", nodeName, eventMessage)
+}
+
+// updateWireguardPeers applies the node list of the cluster to the running wireguard interfaces of its nodes, e.g.
+// after a node was removed
+func updateWireguardPeers(cluster *clustermanager.Cluster) {
+	hetznerProvider := hetzner.NewHetznerProvider(AppConf.Context, AppConf.Client, *cluster, AppConf.CurrentContext.Token)
+	clusterManager := clustermanager.NewClusterManagerFromCluster(*cluster, hetznerProvider, AppConf.SSHClient, logEventService{})
+	FatalOnError(clusterManager.SetupEncryptedNetwork())
+
+	*cluster = clusterManager.Cluster()
+	saveCluster(cluster)
+}
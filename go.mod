@@ -32,7 +32,7 @@ require (
 	golang.org/x/crypto v0.0.0-20180808211826-de0752318171
 	golang.org/x/sys v0.0.0-20180816055513-1c9583448a9c // indirect
 	golang.org/x/text v0.3.0 // indirect
-	gopkg.in/yaml.v2 v2.2.1 // indirect
+	gopkg.in/yaml.v2 v2.2.1
 )
 
 go 1.13
@@ -66,7 +66,9 @@ Environment="KUBELET_EXTRA_ARGS=--cloud-provider=external"
 		FatalOnError(err)
 	}
 
-	_, err := addon.communicator.RunCmd(*addon.masterNode, `kubectl -n kube-system patch ds canal --type json -p '[{"op":"add","path":"/spec/template/spec/tolerations/-","value":{"key":"node.cloudprovider.kubernetes.io/uninitialized","value":"true","effect":"NoSchedule"}}]'`)
+	cni, err := clustermanager.GetCNI(addon.provider.GetCluster().CNI)
+	FatalOnError(err)
+	_, err = addon.communicator.RunCmd(*addon.masterNode, fmt.Sprintf(`kubectl -n kube-system patch ds %s --type json -p '[{"op":"add","path":"/spec/template/spec/tolerations/-","value":{"key":"node.cloudprovider.kubernetes.io/uninitialized","value":"true","effect":"NoSchedule"}}]'`, cni.DaemonSet()))
 	FatalOnError(err)
 	_, err = addon.communicator.RunCmd(*addon.masterNode, fmt.Sprintf("kubectl -n kube-system create secret generic hcloud --from-literal=token=%s", addon.provider.Token()))
 	FatalOnError(err)
@@ -0,0 +1,175 @@
+package clustermanager
+
+import (
+	"fmt"
+	"strconv"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// auditConfigDir is the directory of the audit policy and webhook configuration on the masters
+	auditConfigDir = "/etc/kubernetes/audit"
+	// auditLogDir is the directory the api server writes the audit log to
+	auditLogDir = "/var/log/kubernetes/audit"
+)
+
+const (
+	// DefaultAuditLogMaxAge is the default number of days old audit logs are kept
+	DefaultAuditLogMaxAge = 30
+	// DefaultAuditLogMaxBackup is the default number of old audit logs which are kept
+	DefaultAuditLogMaxBackup = 10
+	// DefaultAuditLogMaxSize is the default size in megabytes an audit log is rotated at
+	DefaultAuditLogMaxSize = 100
+)
+
+// DefaultAuditPolicy logs the metadata of all requests to secrets, tokens and certificate signing requests, no health
+// checks and events, the request of reading requests and the request and response of all other requests
+const DefaultAuditPolicy = `apiVersion: audit.k8s.io/v1
+kind: Policy
+omitStages:
+  - RequestReceived
+rules:
+  # secrets, tokens and certificates must not end up in the audit log
+  - level: Metadata
+    resources:
+      - group: ""
+        resources: ["secrets", "configmaps", "serviceaccounts/token"]
+      - group: authentication.k8s.io
+      - group: certificates.k8s.io
+        resources: ["certificatesigningrequests"]
+  - level: None
+    nonResourceURLs: ["/healthz*", "/livez*", "/readyz*", "/version"]
+  - level: None
+    resources:
+      - group: ""
+        resources: ["events"]
+      - group: events.k8s.io
+        resources: ["events"]
+  - level: None
+    users: ["system:kube-proxy"]
+    verbs: ["watch"]
+  - level: Request
+    verbs: ["get", "list", "watch"]
+  - level: RequestResponse
+`
+
+// AuditSettings configure the audit log of the api servers
+type AuditSettings struct {
+	Enabled bool `json:"enabled"`
+	// Policy is the audit policy, DefaultAuditPolicy if empty
+	Policy string `json:"policy"`
+	// MaxAge is the number of days old audit logs are kept
+	MaxAge int `json:"max_age"`
+	// MaxBackup is the number of old audit logs which are kept
+	MaxBackup int `json:"max_backup"`
+	// MaxSize is the size in megabytes an audit log is rotated at
+	MaxSize int `json:"max_size"`
+	// WebhookConfig is a kubeconfig of a webhook the audit events are sent to in addition to the log
+	WebhookConfig string `json:"webhook_config"`
+}
+
+// PolicyOrDefault returns the configured audit policy or the default one
+func (settings AuditSettings) PolicyOrDefault() string {
+	if settings.Policy == "" {
+		return DefaultAuditPolicy
+	}
+
+	return settings.Policy
+}
+
+// ValidateAuditSettings checks that the policy is an audit policy, the webhook configuration is a kubeconfig and
+// the rotation settings are not negative
+func ValidateAuditSettings(settings AuditSettings) error {
+	if !settings.Enabled {
+		return nil
+	}
+
+	var policy struct {
+		APIVersion string        `yaml:"apiVersion"`
+		Kind       string        `yaml:"kind"`
+		Rules      []interface{} `yaml:"rules"`
+	}
+	if err := yaml.Unmarshal([]byte(settings.PolicyOrDefault()), &policy); err != nil {
+		return fmt.Errorf("unable to parse audit policy: %v", err)
+	}
+
+	if policy.Kind != "Policy" || len(policy.Rules) == 0 {
+		return fmt.Errorf("invalid audit policy, must be a Policy with at least one rule")
+	}
+
+	if settings.WebhookConfig != "" {
+		webhookConfig, err := ParseKubeConfig(settings.WebhookConfig)
+		if err != nil {
+			return fmt.Errorf("invalid audit webhook configuration: %v", err)
+		}
+
+		if len(webhookConfig.Clusters) == 0 {
+			return fmt.Errorf("invalid audit webhook configuration, it must contain a cluster")
+		}
+	}
+
+	if settings.MaxAge < 0 || settings.MaxBackup < 0 || settings.MaxSize < 0 {
+		return fmt.Errorf("audit log rotation settings must not be negative")
+	}
+
+	return nil
+}
+
+// AuditAPIServerArgs returns the arguments of the api server for the audit settings
+func AuditAPIServerArgs(settings AuditSettings) [][2]string {
+	if !settings.Enabled {
+		return nil
+	}
+
+	args := [][2]string{
+		{"audit-policy-file", auditConfigDir + "/policy.yaml"},
+		{"audit-log-path", auditLogDir + "/audit.log"},
+		{"audit-log-maxage", strconv.Itoa(settings.MaxAge)},
+		{"audit-log-maxbackup", strconv.Itoa(settings.MaxBackup)},
+		{"audit-log-maxsize", strconv.Itoa(settings.MaxSize)},
+	}
+
+	if settings.WebhookConfig != "" {
+		args = append(args, [2]string{"audit-webhook-config-file", auditConfigDir + "/webhook.yaml"})
+	}
+
+	return args
+}
+
+// writeAuditConfiguration places the audit policy and webhook configuration on a master, if auditing is enabled
+func (manager *Manager) writeAuditConfiguration(node Node) error {
+	if !manager.audit.Enabled {
+		return nil
+	}
+
+	if _, err := manager.nodeCommunicator.RunCmd(node, fmt.Sprintf("mkdir -p %s %s && chmod 700 %s", auditConfigDir, auditLogDir, auditLogDir)); err != nil {
+		return err
+	}
+
+	if err := manager.nodeCommunicator.WriteFile(node, auditConfigDir+"/policy.yaml", manager.audit.PolicyOrDefault(), OwnerRead); err != nil {
+		return err
+	}
+
+	if manager.audit.WebhookConfig == "" {
+		return nil
+	}
+
+	return manager.nodeCommunicator.WriteFile(node, auditConfigDir+"/webhook.yaml", manager.audit.WebhookConfig, OwnerRead)
+}
+
+// SetupAudit changes the audit settings of the api servers. The audit configuration is placed on all masters first,
+// then the control plane is updated one master after another, so the api servers mount the audit configuration and
+// log
+func (manager *Manager) SetupAudit(settings AuditSettings) error {
+	manager.audit = settings
+
+	for _, node := range manager.clusterProvider.GetMasterNodes() {
+		manager.eventService.AddEvent(node.Name, "write audit configuration")
+		if err := manager.writeAuditConfiguration(node); err != nil {
+			return err
+		}
+	}
+
+	return manager.UpdateControlPlane()
+}
@@ -0,0 +1,145 @@
+package clustermanager
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestValidateAuditSettings(t *testing.T) {
+	valid := []AuditSettings{
+		{},
+		{Enabled: true, MaxAge: 30, MaxBackup: 10, MaxSize: 100},
+		{Enabled: true, Policy: "apiVersion: audit.k8s.io/v1\nkind: Policy\nrules:\n  - level: Metadata\n"},
+		{Enabled: true, WebhookConfig: adminConf},
+	}
+	for _, settings := range valid {
+		if err := ValidateAuditSettings(settings); err != nil {
+			t.Errorf("expected audit settings %+v to be valid, got %v", settings, err)
+		}
+	}
+
+	invalid := []AuditSettings{
+		{Enabled: true, Policy: "apiVersion: v1\nkind: ConfigMap\n"},
+		{Enabled: true, Policy: "apiVersion: audit.k8s.io/v1\nkind: Policy\nrules: []\n"},
+		{Enabled: true, Policy: "kind: ["},
+		{Enabled: true, WebhookConfig: "apiVersion: v1\nkind: Config\n"},
+		{Enabled: true, MaxAge: -1},
+	}
+	for _, settings := range invalid {
+		if err := ValidateAuditSettings(settings); err == nil {
+			t.Errorf("expected audit settings %+v to be invalid", settings)
+		}
+	}
+}
+
+func TestDefaultAuditPolicyLogsOnlyMetadataOfCredentials(t *testing.T) {
+	var policy struct {
+		Rules []struct {
+			Level     string `yaml:"level"`
+			Resources []struct {
+				Group     string   `yaml:"group"`
+				Resources []string `yaml:"resources"`
+			} `yaml:"resources"`
+		} `yaml:"rules"`
+	}
+	if err := yaml.Unmarshal([]byte(DefaultAuditPolicy), &policy); err != nil {
+		t.Fatal(err)
+	}
+
+	// the level of a request is the one of the first rule matching its resource, rules without resources are
+	// skipped as they match by other attributes
+	levelOf := func(group string, resource string) string {
+		for _, rule := range policy.Rules {
+			for _, ruleResources := range rule.Resources {
+				if ruleResources.Group != group {
+					continue
+				}
+
+				if len(ruleResources.Resources) == 0 {
+					return rule.Level
+				}
+
+				for _, ruleResource := range ruleResources.Resources {
+					if ruleResource == resource {
+						return rule.Level
+					}
+				}
+			}
+		}
+
+		return ""
+	}
+
+	credentials := [][2]string{
+		{"", "secrets"},
+		{"", "configmaps"},
+		{"", "serviceaccounts/token"},
+		{"authentication.k8s.io", "tokenreviews"},
+		{"authentication.k8s.io", "tokenrequests"},
+		{"certificates.k8s.io", "certificatesigningrequests"},
+	}
+	for _, resource := range credentials {
+		if level := levelOf(resource[0], resource[1]); level != "Metadata" {
+			t.Errorf("expected requests to %s in group '%s' to be logged at level Metadata, got %s", resource[1], resource[0], level)
+		}
+	}
+}
+
+func TestAuditAPIServerArgs(t *testing.T) {
+	if args := AuditAPIServerArgs(AuditSettings{MaxAge: 30}); len(args) != 0 {
+		t.Errorf("expected no arguments for disabled auditing, got %v", args)
+	}
+
+	args := AuditAPIServerArgs(AuditSettings{Enabled: true, MaxAge: 7, MaxBackup: 3, MaxSize: 50, WebhookConfig: adminConf})
+	expected := [][2]string{
+		{"audit-policy-file", "/etc/kubernetes/audit/policy.yaml"},
+		{"audit-log-path", "/var/log/kubernetes/audit/audit.log"},
+		{"audit-log-maxage", "7"},
+		{"audit-log-maxbackup", "3"},
+		{"audit-log-maxsize", "50"},
+		{"audit-webhook-config-file", "/etc/kubernetes/audit/webhook.yaml"},
+	}
+	if len(args) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, args)
+	}
+
+	for i := range expected {
+		if args[i] != expected[i] {
+			t.Errorf("expected argument %v, got %v", expected[i], args[i])
+		}
+	}
+}
+
+func TestGenerateMasterConfigurationWithAudit(t *testing.T) {
+	nodes := []Node{
+		{Name: "node1", IPAddress: "1.1.1.1", PrivateIPAddress: "10.0.0.1"},
+	}
+	settings := AuditSettings{Enabled: true, MaxAge: 30, MaxBackup: 10, MaxSize: 100}
+
+	conf := GenerateMasterConfiguration(nodes[0], nodes, nil, Cluster{KubernetesVersion: "1.19.2", Audit: settings})
+
+	expected := `apiServer:
+  extraArgs:
+    audit-log-maxage: "30"
+    audit-log-maxbackup: "10"
+    audit-log-maxsize: "100"
+    audit-log-path: /var/log/kubernetes/audit/audit.log
+    audit-policy-file: /etc/kubernetes/audit/policy.yaml
+  extraVolumes:
+  - name: audit-config
+    hostPath: /etc/kubernetes/audit
+    mountPath: /etc/kubernetes/audit
+    readOnly: true
+    pathType: DirectoryOrCreate
+  - name: audit-log
+    hostPath: /var/log/kubernetes/audit
+    mountPath: /var/log/kubernetes/audit
+    readOnly: false
+    pathType: DirectoryOrCreate
+  certSANs:`
+	if !strings.Contains(conf, expected) {
+		t.Errorf("master config does not configure the audit log\n%s", conf)
+	}
+}
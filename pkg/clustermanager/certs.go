@@ -0,0 +1,166 @@
+package clustermanager
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// certificateExpiryLayout is the time format of 'kubeadm certs check-expiration'
+const certificateExpiryLayout = "Jan 02, 2006 15:04 MST"
+
+// certificateLinePattern matches a certificate or certificate authority in the output of
+// 'kubeadm certs check-expiration'. The column of the certificate authority is empty for authorities themselves
+var certificateLinePattern = regexp.MustCompile(`^(\S+)\s+(\w{3} \d{2}, \d{4} \d{2}:\d{2} \w+)\s+(\S+)\s+(?:(\S+)\s+)?(yes|no)$`)
+
+// apiServerTimeout is the time the api server of a master has to become healthy after it was restarted
+const apiServerTimeout = 5 * time.Minute
+
+// restartControlPlaneCommand restarts the api server, controller manager and scheduler of a master, as the kubelet
+// stops static pods whose manifest is removed and starts them again once it is back. The manifests are moved back
+// even if the command fails halfway. Etcd and the master load balancer keep running, the other components of HA
+// clusters reach the api servers through the load balancer
+const restartControlPlaneCommand = "trap 'mv /etc/kubernetes/manifests-restart/*.yaml /etc/kubernetes/manifests/ && " +
+	"rmdir /etc/kubernetes/manifests-restart' EXIT; mkdir -p /etc/kubernetes/manifests-restart && " +
+	"mv /etc/kubernetes/manifests/kube-apiserver.yaml /etc/kubernetes/manifests/kube-controller-manager.yaml " +
+	"/etc/kubernetes/manifests/kube-scheduler.yaml /etc/kubernetes/manifests-restart/ && sleep 20"
+
+// CertificateExpiry is the expiry of a certificate managed by kubeadm
+type CertificateExpiry struct {
+	Name                 string    `json:"name"`
+	Expires              time.Time `json:"expires"`
+	CertificateAuthority string    `json:"certificate_authority,omitempty"`
+	ExternallyManaged    bool      `json:"externally_managed"`
+}
+
+// NodeCertificates contains the certificates of a master, or the error reading them
+type NodeCertificates struct {
+	Node         string              `json:"node"`
+	Certificates []CertificateExpiry `json:"certificates"`
+	Error        string              `json:"error,omitempty"`
+}
+
+// kubeadmCertsCommand returns a 'kubeadm certs' command, which is 'kubeadm alpha certs' before kubernetes 1.20
+func kubeadmCertsCommand(arguments string) string {
+	return fmt.Sprintf("if kubeadm certs --help > /dev/null 2>&1; then kubeadm certs %s; else kubeadm alpha certs %s; fi", arguments, arguments)
+}
+
+// CheckCertificates reads the expiry of the kubeadm certificates on all masters in parallel
+func (manager *Manager) CheckCertificates() []NodeCertificates {
+	masterNodes := manager.clusterProvider.GetMasterNodes()
+	results := make([]NodeCertificates, len(masterNodes))
+
+	var wg sync.WaitGroup
+	for i, node := range masterNodes {
+		wg.Add(1)
+		go func(i int, node Node) {
+			defer wg.Done()
+			results[i] = NodeCertificates{Node: node.Name, Certificates: []CertificateExpiry{}}
+
+			out, err := manager.nodeCommunicator.RunCmd(node, kubeadmCertsCommand("check-expiration"))
+			if err != nil {
+				results[i].Error = err.Error()
+				return
+			}
+
+			results[i].Certificates = parseCertificateExpiration(out)
+		}(i, node)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// RenewCertificates renews all kubeadm certificates on one master after another. The static pods of the control
+// plane are restarted to load the new certificates, and the kubeconfig of root is refreshed. Before the next master
+// is renewed, the api server of the current one must be healthy again
+func (manager *Manager) RenewCertificates() error {
+	for _, node := range manager.clusterProvider.GetMasterNodes() {
+		manager.eventService.AddEvent(node.Name, "renew certificates")
+		if _, err := manager.nodeCommunicator.RunCmd(node, kubeadmCertsCommand("renew all")); err != nil {
+			return fmt.Errorf("unable to renew the certificates of '%s': %v", node.Name, err)
+		}
+
+		manager.eventService.AddEvent(node.Name, "restart control plane")
+		if _, err := manager.nodeCommunicator.RunCmd(node, restartControlPlaneCommand); err != nil {
+			return fmt.Errorf("unable to restart the control plane of '%s': %v", node.Name, err)
+		}
+
+		if err := manager.waitForAPIServer(node); err != nil {
+			return err
+		}
+
+		manager.eventService.AddEvent(node.Name, "configure kubectl")
+		if _, err := manager.nodeCommunicator.RunCmd(node, "cp /etc/kubernetes/admin.conf $HOME/.kube/config"); err != nil {
+			return err
+		}
+
+		manager.eventService.AddEvent(node.Name, "certificates renewed")
+	}
+
+	return nil
+}
+
+// waitForAPIServer waits until the api server of a master is healthy. The api server is asked directly, as the
+// server of admin.conf is the load balancer in HA clusters, which answers as long as any api server is healthy
+func (manager *Manager) waitForAPIServer(node Node) error {
+	manager.eventService.AddEvent(node.Name, "wait for api server")
+	err := waitUntil(apiServerTimeout, func() bool {
+		_, err := manager.nodeCommunicator.RunCmd(node, fmt.Sprintf("kubectl --kubeconfig /etc/kubernetes/admin.conf --server https://%s:6443 get --raw /healthz", node.PrivateIPAddress))
+		return err == nil
+	})
+	if err != nil {
+		return fmt.Errorf("api server of '%s' is not healthy: %v", node.Name, err)
+	}
+
+	return nil
+}
+
+// waitForAPIServerRestart waits until the api server of a master is healthy again, after its manifest was changed.
+// The kubelet needs up to 20 seconds to notice the change, so the old api server is not waited for
+func (manager *Manager) waitForAPIServerRestart(node Node) error {
+	time.Sleep(20 * time.Second)
+
+	return manager.waitForAPIServer(node)
+}
+
+// CertificateStatus returns the status of a certificate, which is critical once it expired, and a warning if it
+// expires within the given duration
+func CertificateStatus(certificate CertificateExpiry, now time.Time, warnWithin time.Duration) CheckStatus {
+	switch {
+	case !certificate.Expires.After(now):
+		return StatusCritical
+	case certificate.Expires.Before(now.Add(warnWithin)):
+		return StatusWarning
+	default:
+		return StatusOK
+	}
+}
+
+// parseCertificateExpiration parses the certificates and certificate authorities listed by
+// 'kubeadm certs check-expiration'
+func parseCertificateExpiration(out string) []CertificateExpiry {
+	certificates := []CertificateExpiry{}
+	for _, line := range strings.Split(out, "\n") {
+		match := certificateLinePattern.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			continue
+		}
+
+		expires, err := time.Parse(certificateExpiryLayout, match[2])
+		if err != nil {
+			continue
+		}
+
+		certificates = append(certificates, CertificateExpiry{
+			Name:                 match[1],
+			Expires:              expires,
+			CertificateAuthority: match[4],
+			ExternallyManaged:    match[5] == "yes",
+		})
+	}
+
+	return certificates
+}
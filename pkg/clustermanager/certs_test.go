@@ -0,0 +1,59 @@
+package clustermanager
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCertificateExpiration(t *testing.T) {
+	out := `[check-expiration] Reading configuration from the cluster...
+[check-expiration] FYI: You can look at this config file with 'kubectl -n kube-system get cm kubeadm-config -oyaml'
+
+CERTIFICATE                EXPIRES                  RESIDUAL TIME   CERTIFICATE AUTHORITY   EXTERNALLY MANAGED
+admin.conf                 Dec 30, 2020 23:36 UTC   364d                                    no
+apiserver                  Dec 30, 2020 23:36 UTC   364d            ca                      no
+apiserver-etcd-client      Jan 02, 2020 08:15 UTC   <invalid>       etcd-ca                 yes
+
+CERTIFICATE AUTHORITY   EXPIRES                  RESIDUAL TIME   EXTERNALLY MANAGED
+ca                      Dec 28, 2029 23:36 UTC   9y              no
+`
+
+	certificates := parseCertificateExpiration(out)
+	expected := []CertificateExpiry{
+		{Name: "admin.conf", Expires: time.Date(2020, 12, 30, 23, 36, 0, 0, time.UTC)},
+		{Name: "apiserver", Expires: time.Date(2020, 12, 30, 23, 36, 0, 0, time.UTC), CertificateAuthority: "ca"},
+		{Name: "apiserver-etcd-client", Expires: time.Date(2020, 1, 2, 8, 15, 0, 0, time.UTC), CertificateAuthority: "etcd-ca", ExternallyManaged: true},
+		{Name: "ca", Expires: time.Date(2029, 12, 28, 23, 36, 0, 0, time.UTC)},
+	}
+
+	if len(certificates) != len(expected) {
+		t.Fatalf("expected %d certificates, got %d: %+v", len(expected), len(certificates), certificates)
+	}
+
+	for i, certificate := range certificates {
+		if certificate.Name != expected[i].Name || !certificate.Expires.Equal(expected[i].Expires) ||
+			certificate.CertificateAuthority != expected[i].CertificateAuthority || certificate.ExternallyManaged != expected[i].ExternallyManaged {
+			t.Errorf("expected %+v, got %+v", expected[i], certificate)
+		}
+	}
+}
+
+func TestCertificateStatus(t *testing.T) {
+	now := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	warnWithin := 30 * 24 * time.Hour
+
+	tests := []struct {
+		expires  time.Time
+		expected CheckStatus
+	}{
+		{now.Add(-time.Hour), StatusCritical},
+		{now.Add(24 * time.Hour), StatusWarning},
+		{now.Add(60 * 24 * time.Hour), StatusOK},
+	}
+
+	for _, test := range tests {
+		if status := CertificateStatus(CertificateExpiry{Expires: test.expires}, now, warnWithin); status != test.expected {
+			t.Errorf("certificate expiring at %s: expected %s, got %s", test.expires, test.expected, status)
+		}
+	}
+}
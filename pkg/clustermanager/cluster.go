@@ -1,25 +1,44 @@
 package clustermanager
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"strings"
-	"time"
 
 	"github.com/xetys/hetzner-kube/pkg"
 )
 
-const rewriteTpl = `cat /etc/kubernetes/%s | sed -e 's/server: https\(.*\)/server: https:\/\/127.0.0.1:16443/g' > /tmp/cp && mv /tmp/cp /etc/kubernetes/%s`
+// configureKubectlCommand makes kubectl of root use the admin kubeconfig of a master
+const configureKubectlCommand = "rm -rf $HOME/.kube && mkdir -p $HOME/.kube && cp -i /etc/kubernetes/admin.conf $HOME/.kube/config && chown $(id -u):$(id -g) $HOME/.kube/config"
 
 // Manager is the structure used to mange cluster
 type Manager struct {
-	nodes            []Node
-	clusterName      string
-	cloudInitFile    string
-	eventService     EventService
-	nodeCommunicator NodeCommunicator
-	clusterProvider  ClusterProvider
-	haEnabled        bool
-	isolatedEtcd     bool
+	nodes             []Node
+	clusterName       string
+	cloudInitFile     string
+	kubernetesVersion string
+	eventService      EventService
+	nodeCommunicator  NodeCommunicator
+	clusterProvider   ClusterProvider
+	haEnabled         bool
+	isolatedEtcd      bool
+	containerRuntime  string
+	cni               string
+	podCIDR           string
+	serviceCIDR       string
+	dnsDomain         string
+	ipAllocations     map[string]string
+	ipFamily          string
+	nodeIPv6CIDR      string
+	podIPv6CIDR       string
+	serviceIPv6CIDR   string
+	wireGuard         WireGuardSettings
+	users             []ClusterUser
+	oidc              OIDCSettings
+	encryption        SecretsEncryptionSettings
+	audit             AuditSettings
+	kubeadmPatches    string
 }
 
 // KeepCerts is an enumeration for existing certificate handling during master install
@@ -38,14 +57,21 @@ const (
 // NewClusterManager create a new manager for the cluster
 func NewClusterManager(provider ClusterProvider, nodeCommunicator NodeCommunicator, eventService EventService, name string, haEnabled bool, isolatedEtcd bool, cloudInitFile string) *Manager {
 	manager := &Manager{
-		clusterName:      name,
-		haEnabled:        haEnabled,
-		isolatedEtcd:     isolatedEtcd,
-		cloudInitFile:    cloudInitFile,
-		eventService:     eventService,
-		nodeCommunicator: nodeCommunicator,
-		clusterProvider:  provider,
-		nodes:            provider.GetAllNodes(),
+		clusterName:       name,
+		haEnabled:         haEnabled,
+		isolatedEtcd:      isolatedEtcd,
+		cloudInitFile:     cloudInitFile,
+		kubernetesVersion: DefaultKubernetesVersion,
+		containerRuntime:  ContainerRuntimeDocker,
+		cni:               DefaultCNI,
+		podCIDR:           DefaultPodCIDR,
+		serviceCIDR:       DefaultServiceCIDR,
+		dnsDomain:         DefaultDNSDomain,
+		ipAllocations:     make(map[string]string),
+		eventService:      eventService,
+		nodeCommunicator:  nodeCommunicator,
+		clusterProvider:   provider,
+		nodes:             provider.GetAllNodes(),
 	}
 
 	return manager
@@ -54,14 +80,31 @@ func NewClusterManager(provider ClusterProvider, nodeCommunicator NodeCommunicat
 // NewClusterManagerFromCluster create a new manager from an existing cluster
 func NewClusterManagerFromCluster(cluster Cluster, provider ClusterProvider, nodeCommunicator NodeCommunicator, eventService EventService) *Manager {
 	return &Manager{
-		clusterName:      cluster.Name,
-		haEnabled:        cluster.HaEnabled,
-		isolatedEtcd:     cluster.IsolatedEtcd,
-		cloudInitFile:    cluster.CloudInitFile,
-		eventService:     eventService,
-		nodeCommunicator: nodeCommunicator,
-		clusterProvider:  provider,
-		nodes:            cluster.Nodes,
+		clusterName:       cluster.Name,
+		haEnabled:         cluster.HaEnabled,
+		isolatedEtcd:      cluster.IsolatedEtcd,
+		cloudInitFile:     cluster.CloudInitFile,
+		kubernetesVersion: KubernetesVersionOrDefault(cluster.KubernetesVersion),
+		containerRuntime:  ContainerRuntimeOrDefault(cluster.ContainerRuntime),
+		cni:               CNIOrDefault(cluster.CNI),
+		podCIDR:           PodCIDROrDefault(cluster.PodCIDR),
+		serviceCIDR:       ServiceCIDROrDefault(cluster.ServiceCIDR),
+		dnsDomain:         DNSDomainOrDefault(cluster.DNSDomain),
+		ipAllocations:     nodeIPAllocations(cluster.IPAllocations, cluster.Nodes),
+		ipFamily:          cluster.IPFamily,
+		nodeIPv6CIDR:      cluster.NodeIPv6CIDR,
+		podIPv6CIDR:       cluster.PodIPv6CIDR,
+		serviceIPv6CIDR:   cluster.ServiceIPv6CIDR,
+		wireGuard:         cluster.WireGuard,
+		users:             cluster.Users,
+		oidc:              cluster.OIDC,
+		encryption:        cluster.SecretsEncryption,
+		audit:             cluster.Audit,
+		kubeadmPatches:    cluster.KubeadmPatches,
+		eventService:      eventService,
+		nodeCommunicator:  nodeCommunicator,
+		clusterProvider:   provider,
+		nodes:             cluster.Nodes,
 	}
 }
 
@@ -74,13 +117,53 @@ func (manager *Manager) Cluster() Cluster {
 		IsolatedEtcd:      manager.isolatedEtcd,
 		CloudInitFile:     manager.cloudInitFile,
 		NodeCIDR:          manager.clusterProvider.GetNodeCidr(),
-		KubernetesVersion: "1.19.2",
+		KubernetesVersion: manager.kubernetesVersion,
+		ContainerRuntime:  manager.containerRuntime,
+		CNI:               manager.cni,
+		PodCIDR:           manager.podCIDR,
+		ServiceCIDR:       manager.serviceCIDR,
+		DNSDomain:         manager.dnsDomain,
+		IPAllocations:     nodeIPAllocations(manager.ipAllocations, nil),
+		IPFamily:          manager.ipFamily,
+		NodeIPv6CIDR:      manager.nodeIPv6CIDR,
+		PodIPv6CIDR:       manager.podIPv6CIDR,
+		ServiceIPv6CIDR:   manager.serviceIPv6CIDR,
+		WireGuard:         manager.wireGuard,
+		Users:             manager.users,
+		OIDC:              manager.oidc,
+		SecretsEncryption: manager.encryption,
+		Audit:             manager.audit,
+		KubeadmPatches:    manager.kubeadmPatches,
 	}
 }
 
 // AppendNodes can be used to append nodes to the cluster after initialization
 func (manager *Manager) AppendNodes(nodes []Node) {
 	manager.nodes = append(manager.nodes, nodes...)
+	for _, node := range nodes {
+		manager.ipAllocations[node.Name] = node.PrivateIPAddress
+	}
+}
+
+// podCIDRs returns the pod CIDR, followed by the IPv6 pod CIDR for dual-stack clusters
+func (manager *Manager) podCIDRs() string {
+	return PodCIDRs(Cluster{PodCIDR: manager.podCIDR, PodIPv6CIDR: manager.podIPv6CIDR, IPFamily: manager.ipFamily})
+}
+
+// nodeIPAllocations returns a copy of the allocations, completed by the private IP addresses of the given nodes
+func nodeIPAllocations(allocations map[string]string, nodes []Node) map[string]string {
+	result := make(map[string]string, len(allocations))
+	for name, address := range allocations {
+		result[name] = address
+	}
+
+	for _, node := range nodes {
+		if _, exists := result[node.Name]; !exists && node.PrivateIPAddress != "" {
+			result[node.Name] = node.PrivateIPAddress
+		}
+	}
+
+	return result
 }
 
 // ProvisionNodes install packages for the nodes
@@ -108,19 +191,24 @@ func (manager *Manager) ProvisionNodes(nodes []Node) error {
 	return waitOrError(trueChan, errChan, &numProcs)
 }
 
-// SetupEncryptedNetwork setups an encrypted virtual network using wireguard
+// SetupEncryptedNetwork setups an encrypted virtual network using wireguard. Only nodes without a key pair get a
+// new one and (re)start wireguard. The running interfaces of all other nodes keep their keys and only apply the
+// changed peers, so their existing connections are not interrupted
 // modifies the state of manager.Nodes
 func (manager *Manager) SetupEncryptedNetwork() error {
-	var err error
-	var keyPair WgKeyPair
-
+	newNodes := make(map[string]bool)
 	for i := range manager.nodes {
-		keyPair, err = GenerateKeyPair()
+		if manager.nodes[i].WireGuardKeyPair.Private != "" {
+			continue
+		}
+
+		keyPair, err := GenerateKeyPair()
 		if err != nil {
 			return fmt.Errorf("unable to setup encrypted network: %v", err)
 		}
 
 		manager.nodes[i].WireGuardKeyPair = keyPair
+		newNodes[manager.nodes[i].Name] = true
 	}
 
 	nodes := manager.nodes
@@ -133,24 +221,36 @@ func (manager *Manager) SetupEncryptedNetwork() error {
 		numProc++
 		go func(node Node) {
 			manager.eventService.AddEvent(node.Name, "configure wireguard")
-			wireGuardConf := GenerateWireguardConf(node, manager.nodes)
+			wireGuardConf := GenerateWireguardConf(node, manager.nodes, manager.wireGuard)
 			err := manager.nodeCommunicator.WriteFile(node, "/etc/wireguard/wg0.conf", wireGuardConf, OwnerRead)
 			if err != nil {
 				errChan <- err
+				return
 			}
 
-			overlayRouteConf := GenerateOverlayRouteSystemdService(node)
+			overlayRouteConf := GenerateOverlayRouteSystemdService(node, manager.podCIDRs())
 			err = manager.nodeCommunicator.WriteFile(node, "/etc/systemd/system/overlay-route.service", overlayRouteConf, AllRead)
 			if err != nil {
 				errChan <- err
+				return
+			}
+
+			command := "systemctl enable wg-quick@wg0 && systemctl restart wg-quick@wg0" +
+				" && systemctl enable overlay-route.service && systemctl restart overlay-route.service"
+			if !newNodes[node.Name] {
+				command = fmt.Sprintf("if wg show wg0 > /dev/null 2>&1; then %s; else %s; fi", WireguardSyncCommand(node, manager.nodes), command)
+			}
+
+			if node.PrivateIPv6Address != "" {
+				// IPv6 pod traffic is routed through the nodes like the IPv4 traffic
+				command = "echo net.ipv6.conf.all.forwarding=1 > /etc/sysctl.d/50-ipv6-forwarding.conf" +
+					" && sysctl --load=/etc/sysctl.d/50-ipv6-forwarding.conf && " + command
 			}
 
-			_, err = manager.nodeCommunicator.RunCmd(
-				node,
-				"systemctl enable wg-quick@wg0 && systemctl restart wg-quick@wg0"+
-					" && systemctl enable overlay-route.service && systemctl restart overlay-route.service")
+			_, err = manager.nodeCommunicator.RunCmd(node, command)
 			if err != nil {
 				errChan <- err
+				return
 			}
 
 			manager.eventService.AddEvent(node.Name, "wireguard configured")
@@ -158,7 +258,7 @@ func (manager *Manager) SetupEncryptedNetwork() error {
 		}(node)
 	}
 
-	err = waitOrError(trueChan, errChan, &numProc)
+	err := waitOrError(trueChan, errChan, &numProc)
 	if err != nil {
 		return err
 	}
@@ -166,133 +266,140 @@ func (manager *Manager) SetupEncryptedNetwork() error {
 	return nil
 }
 
-// InstallMasters installs the kubernetes control plane to master nodes
+// InstallMasters installs the kubernetes control plane to master nodes. The first master initializes the cluster,
+// all other masters join its control plane with the certificates it uploaded
 func (manager *Manager) InstallMasters(keepCerts KeepCerts) error {
+	cni, err := GetCNI(manager.cni)
+	if err != nil {
+		return err
+	}
+
 	commands := []NodeCommand{
-		{"sysctl settings", `printf '# Strict RPF mode as required by canal/Calico\nnet.ipv4.conf.default.rp_filter=1\nnet.ipv4.conf.all.rp_filter=1\n' >/etc/sysctl.d/50-canal-calico.conf && sysctl --load=/etc/sysctl.d/50-canal-calico.conf`},
+		{"sysctl settings", GenerateCNINodePrepCommand(cni)},
 		{"kubeadm init", "kubectl version > /dev/null &> /dev/null || kubeadm init --ignore-preflight-errors=all --config /root/master-config.yaml"},
-		{"configure kubectl", "rm -rf $HOME/.kube && mkdir -p $HOME/.kube && cp -i /etc/kubernetes/admin.conf $HOME/.kube/config && chown $(id -u):$(id -g) $HOME/.kube/config"},
-		{"install canal", "kubectl apply -f https://docs.projectcalico.org/v3.16/manifests/canal.yaml"},
+		{"configure kubectl", configureKubectlCommand},
+		{"install " + cni.Name(), cni.InstallCommand(manager.podCIDRs(), cni.MTU(manager.wireGuard.MTUOrDefault()))},
 	}
 
 	// inject custom commands
 	commands = append(commands, manager.clusterProvider.GetAdditionalMasterInstallCommands()...)
 
-	var masterNode Node
-
-	errChan := make(chan error)
-	trueChan := make(chan bool)
-	numProc := 0
-	numMaster := 0
+	if len(manager.nodes) == 1 {
+		commands = append(commands, NodeCommand{"taint master", "kubectl taint nodes --all " + masterTaintKey(manager.Cluster().KubernetesVersion) + "-"})
+	}
 
-	for _, node := range manager.nodes {
-		if node.IsMaster {
+	masterNodes := manager.clusterProvider.GetMasterNodes()
+	if len(masterNodes) == 0 {
+		return errors.New("no master node found")
+	}
 
-			var resetCommand string
+	var resetCommand string
+	switch keepCerts {
+	case NONE:
+		resetCommand = "kubeadm reset -f && rm -rf /etc/kubernetes/pki && mkdir /etc/kubernetes/pki"
+	case CA:
+		resetCommand = "mkdir -p /root/pki && cp -r /etc/kubernetes/pki/* /root/pki && kubeadm reset -f && cp -r /root/pki/ca* /etc/kubernetes/pki"
+	case ALL:
+		resetCommand = "mkdir -p /root/pki && cp -r /etc/kubernetes/pki/* /root/pki && kubeadm reset -f && cp -r /root/pki/* /etc/kubernetes/pki"
+	}
 
-			switch keepCerts {
-			case NONE:
-				resetCommand = "kubeadm reset -f && rm -rf /etc/kubernetes/pki && mkdir /etc/kubernetes/pki"
-			case CA:
-				resetCommand = "mkdir -p /root/pki && cp -r /etc/kubernetes/pki/* /root/pki && kubeadm reset -f && cp -r /root/pki/ca* /etc/kubernetes/pki"
-			case ALL:
-				resetCommand = "mkdir -p /root/pki && cp -r /etc/kubernetes/pki/* /root/pki && kubeadm reset -f && cp -r /root/pki/* /etc/kubernetes/pki"
-			}
+	firstMaster := masterNodes[0]
+	if _, err := manager.nodeCommunicator.RunCmd(firstMaster, resetCommand); err != nil {
+		return err
+	}
 
-			_, err := manager.nodeCommunicator.RunCmd(node, resetCommand)
-			if err != nil {
-				return err
-			}
+	if manager.haEnabled {
+		// the control plane endpoint is the load balancer static pod, which the kubelet starts together with the
+		// control plane. It is deployed after the reset, as kubeadm removes all static pods
+		if err := manager.DeployLoadBalancer([]Node{firstMaster}); err != nil {
+			return err
+		}
+	}
 
-			if len(manager.nodes) == 1 {
-				commands = append(commands, NodeCommand{"taint master", "kubectl taint nodes --all node-role.kubernetes.io/master-"})
-			}
+	if err := manager.installMasterStep(firstMaster, commands); err != nil {
+		return err
+	}
 
-			if numMaster == 0 {
-				masterNode = node
-			}
+	if len(masterNodes) == 1 {
+		return nil
+	}
 
-			numProc++
-			go func(node Node) {
-				manager.installMasterStep(node, numMaster, masterNode, commands, trueChan, errChan)
-			}(node)
+	join, err := manager.controlPlaneJoinParameters(firstMaster)
+	if err != nil {
+		return err
+	}
 
-			// early wait the first time
-			if numMaster == 0 {
-				select {
-				case err := <-errChan:
-					return err
-				case <-trueChan:
-					numProc--
-				}
-			}
-			numMaster++
+	for _, node := range masterNodes[1:] {
+		if err := manager.joinMaster(node, join); err != nil {
+			return err
 		}
 	}
 
-	return waitOrError(trueChan, errChan, &numProc)
+	return nil
 }
 
-// installs kubernetes control plane to a given node
-func (manager *Manager) installMasterStep(node Node, numMaster int, masterNode Node, commands []NodeCommand, trueChan chan bool, errChan chan error) {
-	// create master-configuration
-	var etcdNodes []Node
-	if manager.haEnabled {
-		if manager.isolatedEtcd {
-			etcdNodes = manager.clusterProvider.GetEtcdNodes()
-		} else {
-			etcdNodes = manager.clusterProvider.GetMasterNodes()
-		}
+// installMasterStep initializes the control plane on the first master
+func (manager *Manager) installMasterStep(node Node, commands []NodeCommand) error {
+	if err := manager.writeMasterConfiguration(node); err != nil {
+		return err
 	}
-	masterNodes := manager.clusterProvider.GetMasterNodes()
-	masterConfig := GenerateMasterConfiguration(node, masterNodes, etcdNodes, manager.Cluster().KubernetesVersion)
-	if err := manager.nodeCommunicator.WriteFile(node, "/root/master-config.yaml", masterConfig, AllRead); err != nil {
-		errChan <- err
-	}
-
-	if numMaster > 0 {
-		manager.eventService.AddEvent(node.Name, "copy PKI")
-
-		files := []string{
-			"apiserver-kubelet-client.crt",
-			"apiserver-kubelet-client.key",
-			"apiserver.crt",
-			"apiserver.key",
-			"ca.crt",
-			"ca.key",
-			"front-proxy-ca.crt",
-			"front-proxy-ca.key",
-			"front-proxy-client.crt",
-			"front-proxy-client.key",
-			"sa.key",
-			"sa.pub",
-		}
 
-		for _, file := range files {
-			err := manager.nodeCommunicator.CopyFileOverNode(masterNode, node, "/etc/kubernetes/pki/"+file)
-			if err != nil {
-				errChan <- err
-			}
-		}
+	if err := manager.writeEncryptionConfiguration(node); err != nil {
+		return err
+	}
+
+	if err := manager.writeAuditConfiguration(node); err != nil {
+		return err
 	}
 
-	for i, command := range commands {
+	for _, command := range commands {
 		manager.eventService.AddEvent(node.Name, command.EventName)
-		_, err := manager.nodeCommunicator.RunCmd(node, command.Command)
-		if err != nil {
-			errChan <- err
+		if _, err := manager.nodeCommunicator.RunCmd(node, command.Command); err != nil {
+			return err
+		}
+	}
+
+	if !manager.haEnabled {
+		manager.eventService.AddEvent(node.Name, pkg.CompletedEvent)
+	}
+
+	return nil
+}
+
+// writeMasterConfiguration renders the kubeadm configuration for a master node and places it on the node
+func (manager *Manager) writeMasterConfiguration(node Node) error {
+	masterNodes := manager.clusterProvider.GetMasterNodes()
+	cluster := manager.Cluster()
+	masterConfig, err := ApplyKubeadmPatches(GenerateMasterConfiguration(node, masterNodes, manager.externalEtcdNodes(), cluster), manager.kubeadmPatches, cluster.KubernetesVersion)
+	if err != nil {
+		return err
+	}
+
+	if manager.oidc.CA != "" {
+		if _, err := manager.nodeCommunicator.RunCmd(node, "mkdir -p /etc/kubernetes/pki"); err != nil {
+			return err
 		}
 
-		if numMaster > 0 && i > 0 {
-			break
+		if err := manager.nodeCommunicator.WriteFile(node, oidcCAPath, manager.oidc.CA, AllRead); err != nil {
+			return err
 		}
 	}
 
+	return manager.nodeCommunicator.WriteFile(node, "/root/master-config.yaml", masterConfig, AllRead)
+}
+
+// externalEtcdNodes returns the nodes running the etcd cluster used by the control plane, or nil if
+// kubeadm manages a local etcd
+func (manager *Manager) externalEtcdNodes() []Node {
 	if !manager.haEnabled {
-		manager.eventService.AddEvent(node.Name, pkg.CompletedEvent)
+		return nil
+	}
+
+	if manager.isolatedEtcd {
+		return manager.clusterProvider.GetEtcdNodes()
 	}
 
-	trueChan <- true
+	return manager.clusterProvider.GetMasterNodes()
 }
 
 // InstallEtcdNodes installs the etcd cluster
@@ -305,7 +412,10 @@ func (manager *Manager) InstallEtcdNodes(nodes []Node, keepData bool) error {
 		numProcs++
 
 		go func(node Node) {
-			manager.etcdInstallStep(node, nodes, errChan, keepData)
+			if err := manager.etcdInstallStep(node, nodes, keepData, false); err != nil {
+				errChan <- err
+				return
+			}
 
 			trueChan <- true
 		}(node)
@@ -314,41 +424,100 @@ func (manager *Manager) InstallEtcdNodes(nodes []Node, keepData bool) error {
 	return waitOrError(trueChan, errChan, &numProcs)
 }
 
-func (manager *Manager) etcdInstallStep(node Node, nodes []Node, errChan chan error, keepData bool) {
+// JoinEtcdNodes adds the given nodes one by one as new members to the running etcd cluster
+func (manager *Manager) JoinEtcdNodes(nodes []Node) error {
+	etcdManager := NewEtcdManager(manager.clusterProvider, manager.nodeCommunicator)
+	newNodes := make(map[string]bool)
+	for _, node := range nodes {
+		newNodes[node.Name] = true
+	}
+
+	members := []Node{}
+	for _, node := range manager.externalEtcdNodes() {
+		if !newNodes[node.Name] {
+			members = append(members, node)
+		}
+	}
+
+	for _, node := range nodes {
+		members = append(members, node)
+
+		manager.eventService.AddEvent(node.Name, "add etcd member")
+		if err := etcdManager.CheckAddMember(); err != nil {
+			return err
+		}
+
+		if err := etcdManager.AddMember(node); err != nil {
+			return err
+		}
+
+		if err := manager.etcdInstallStep(node, members, false, true); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RemoveEtcdNode removes a node from the running etcd cluster and stops etcd on it
+func (manager *Manager) RemoveEtcdNode(node Node) error {
+	etcdManager := NewEtcdManager(manager.clusterProvider, manager.nodeCommunicator)
+
+	manager.eventService.AddEvent(node.Name, "remove etcd member")
+	if err := etcdManager.CheckRemoveMember(node); err != nil {
+		return err
+	}
+
+	if err := etcdManager.RemoveMember(node); err != nil {
+		return err
+	}
+
+	// the node might already be gone, so a failing stop is not critical
+	_, err := manager.nodeCommunicator.RunCmd(node, "systemctl disable etcd.service && systemctl stop etcd.service && rm -rf /var/lib/etcd")
+	if err != nil {
+		log.Printf("unable to stop etcd on node '%s': %v", node.Name, err)
+	}
+
+	return nil
+}
+
+func (manager *Manager) etcdInstallStep(node Node, nodes []Node, keepData bool, joinExisting bool) error {
 	commands := []NodeCommand{
 		{"download etcd", "mkdir -p /opt/etcd && curl -L https://storage.googleapis.com/etcd/v3.3.11/etcd-v3.3.11-linux-amd64.tar.gz -o /opt/etcd-v3.3.11-linux-amd64.tar.gz"},
 		{"install etcd", "tar xzvf /opt/etcd-v3.3.11-linux-amd64.tar.gz -C /opt/etcd --strip-components=1"},
 		//{"configure etcd", "systemctl enable etcd.service && systemctl stop etcd.service && rm -rf /var/lib/etcd && systemctl start etcd.service"},
 	}
 	// set systemd service
-	etcdSystemdService := GenerateEtcdSystemdService(node, nodes)
+	etcdSystemdService := GenerateEtcdSystemdService(node, nodes, joinExisting)
 	err := manager.nodeCommunicator.WriteFile(node, "/etc/systemd/system/etcd.service", etcdSystemdService, AllRead)
 	if err != nil {
-		errChan <- err
+		return err
 	}
 	// install etcd
 	for _, command := range commands {
 		manager.eventService.AddEvent(node.Name, command.EventName)
 		_, err := manager.nodeCommunicator.RunCmd(node, command.Command)
 		if err != nil {
-			errChan <- err
+			return err
 		}
 	}
 	// configure etcd
-	configureCommand := "systemctl enable etcd.service && systemctl stop etcd.service && rm -rf /var/lib/etcd && systemctl start etcd.service"
+	configureCommand := "systemctl daemon-reload && systemctl enable etcd.service && systemctl stop etcd.service && rm -rf /var/lib/etcd && systemctl start etcd.service"
 	if keepData {
-		configureCommand = "systemctl enable etcd.service && systemctl stop etcd.service && systemctl start etcd.service"
+		configureCommand = "systemctl daemon-reload && systemctl enable etcd.service && systemctl stop etcd.service && systemctl start etcd.service"
 	}
 	manager.eventService.AddEvent(node.Name, "configure etcd")
 	_, err = manager.nodeCommunicator.RunCmd(node, configureCommand)
 	if err != nil {
-		errChan <- err
+		return err
 	}
 	if manager.isolatedEtcd {
 		manager.eventService.AddEvent(node.Name, pkg.CompletedEvent)
 	} else {
 		manager.eventService.AddEvent(node.Name, "etcd configured")
 	}
+
+	return nil
 }
 
 // InstallWorkers installs kubernetes workers to given nodes
@@ -358,12 +527,16 @@ func (manager *Manager) InstallWorkers(nodes []Node) error {
 		return err
 	}
 
+	cni, err := GetCNI(manager.cni)
+	if err != nil {
+		return err
+	}
+
 	commands := []NodeCommand{
-		{"sysctl settings", `printf '# Strict RPF mode as required by canal/Calico\nnet.ipv4.conf.default.rp_filter=1\nnet.ipv4.conf.all.rp_filter=1\n' >/etc/sysctl.d/50-canal-calico.conf && sysctl --load=/etc/sysctl.d/50-canal-calico.conf`},
+		{"sysctl settings", GenerateCNINodePrepCommand(cni)},
 	}
 
-	// create join command
-	joinCommand, err := manager.nodeCommunicator.RunCmd(*node, "kubeadm token create --print-join-command")
+	join, err := manager.joinParameters(*node)
 	if err != nil {
 		return err
 	}
@@ -377,31 +550,19 @@ func (manager *Manager) InstallWorkers(nodes []Node) error {
 			numProcs++
 			go func(node Node) {
 				manager.eventService.AddEvent(node.Name, "registering node")
-				_, err := manager.nodeCommunicator.RunCmd(
-					node,
-					"for i in ip_vs ip_vs_rr ip_vs_wrr ip_vs_sh nf_conntrack_ipv4; do modprobe $i; done"+
-						" && kubeadm reset -f && "+joinCommand)
+				err := manager.nodeCommunicator.WriteFile(node, "/root/join-config.yaml", GenerateJoinConfiguration(node, manager.Cluster(), join), OwnerRead)
 				if err != nil {
 					errChan <- err
+					return
 				}
-				if manager.haEnabled {
-					time.Sleep(10 * time.Second) // we need some time until the kubelet.conf appears
-
-					kubeConfigs := []string{"kubelet.conf", "bootstrap-kubelet.conf"}
 
-					manager.eventService.AddEvent(node.Name, "rewrite kubeconfigs")
-					for _, conf := range kubeConfigs {
-						_, err := manager.nodeCommunicator.RunCmd(node, fmt.Sprintf(rewriteTpl, conf, conf))
-						if err != nil {
-							errChan <- err
-						}
-					}
-					_, err = manager.nodeCommunicator.RunCmd(node, "systemctl restart docker && systemctl restart kubelet")
-					if err != nil {
-						errChan <- err
-					}
+				_, err = manager.nodeCommunicator.RunCmd(
+					node,
+					"for i in ip_vs ip_vs_rr ip_vs_wrr ip_vs_sh nf_conntrack_ipv4; do modprobe $i; done"+
+						" && kubeadm reset -f && kubeadm join --config /root/join-config.yaml")
+				if err != nil {
+					errChan <- err
 				}
-
 				for _, command := range commands {
 					manager.eventService.AddEvent(node.Name, command.EventName)
 					_, err := manager.nodeCommunicator.RunCmd(node, command.Command)
@@ -418,105 +579,308 @@ func (manager *Manager) InstallWorkers(nodes []Node) error {
 	return waitOrError(trueChan, errChan, &numProcs)
 }
 
-// SetupHA installs the high-availability plane to cluster
+// joinParameters creates a bootstrap token on a master, which nodes join the cluster with over the api server of
+// that master
+func (manager *Manager) joinParameters(masterNode Node) (JoinParameters, error) {
+	token, err := manager.nodeCommunicator.RunCmd(masterNode, "kubeadm token create")
+	if err != nil {
+		return JoinParameters{}, err
+	}
+
+	// the hash of the public key of the CA, as printed by 'kubeadm token create --print-join-command'
+	caCertHash, err := manager.nodeCommunicator.RunCmd(masterNode, "openssl x509 -pubkey -in /etc/kubernetes/pki/ca.crt | "+
+		"openssl pkey -pubin -outform der | openssl dgst -sha256 -hex | sed 's/^.* //'")
+	if err != nil {
+		return JoinParameters{}, err
+	}
+
+	return JoinParameters{
+		APIServerEndpoint: masterNode.PrivateIPAddress + ":6443",
+		Token:             strings.TrimSpace(token),
+		CACertHash:        "sha256:" + strings.TrimSpace(caCertHash),
+	}, nil
+}
+
+// controlPlaneJoinParameters uploads the certificates of the control plane from a master, encrypted with a new
+// certificate key. New masters download them while joining the control plane
+func (manager *Manager) controlPlaneJoinParameters(masterNode Node) (JoinParameters, error) {
+	join, err := manager.joinParameters(masterNode)
+	if err != nil {
+		return join, err
+	}
+
+	certificateKey, err := generateCertificateKey()
+	if err != nil {
+		return join, err
+	}
+
+	manager.eventService.AddEvent(masterNode.Name, "upload certificates")
+	_, err = manager.nodeCommunicator.RunCmd(masterNode, "kubeadm init phase upload-certs --upload-certs --config /root/master-config.yaml --certificate-key "+certificateKey)
+	if err != nil {
+		return join, fmt.Errorf("unable to upload the certificates of the control plane: %v", err)
+	}
+
+	join.ControlPlane = true
+	join.CertificateKey = certificateKey
+
+	return join, nil
+}
+
+// SetupHA deploys the load balancer of the control plane endpoint to all nodes, so the workers reach all masters
 func (manager *Manager) SetupHA() error {
-	// copy pki
-	masterNode, err := manager.clusterProvider.GetMasterNode()
+	if err := manager.DeployLoadBalancer(manager.nodes); err != nil {
+		return err
+	}
+
+	for _, node := range manager.clusterProvider.GetMasterNodes() {
+		manager.eventService.AddEvent(node.Name, pkg.CompletedEvent)
+	}
+
+	return nil
+}
+
+// AddMasters joins new master nodes to the control plane of an existing HA cluster. The nodes must be provisioned
+// and part of the encrypted network already
+func (manager *Manager) AddMasters(nodes []Node) error {
+	if !manager.haEnabled {
+		return errors.New("masters can only be added to HA clusters")
+	}
+
+	firstMaster, err := manager.findMasterExcluding(nodes)
 	if err != nil {
 		return err
 	}
 
-	errChan := make(chan error)
-	trueChan := make(chan bool)
-	numProcs := 0
-	// deploy load balancer
-	masterNodes := manager.clusterProvider.GetMasterNodes()
-	err = manager.DeployLoadBalancer(manager.nodes)
+	if !manager.isolatedEtcd {
+		if err := manager.JoinEtcdNodes(nodes); err != nil {
+			return err
+		}
+	}
+
+	// masters only join clusters whose kubeadm configuration contains the control plane endpoint
+	if err := manager.writeMasterConfiguration(firstMaster); err != nil {
+		return err
+	}
+
+	if _, err := manager.nodeCommunicator.RunCmd(firstMaster, "kubeadm init phase upload-config kubeadm --config /root/master-config.yaml"); err != nil {
+		return fmt.Errorf("unable to upload the kubeadm configuration: %v", err)
+	}
+
+	if err := manager.DeployLoadBalancer(manager.nodes); err != nil {
+		return err
+	}
+
+	join, err := manager.controlPlaneJoinParameters(firstMaster)
+	if err != nil {
+		return err
+	}
+
+	for _, node := range nodes {
+		if err := manager.joinMaster(node, join); err != nil {
+			return err
+		}
+	}
+
+	return manager.UpdateControlPlane()
+}
+
+// joinMaster joins a master to the control plane, with the certificates uploaded by an existing master
+func (manager *Manager) joinMaster(node Node, join JoinParameters) error {
+	_, err := manager.nodeCommunicator.RunCmd(node, "kubeadm reset -f && rm -rf /etc/kubernetes/pki && mkdir /etc/kubernetes/pki")
 	if err != nil {
 		return err
 	}
 
-	// set apiserver-count to number of masters
-	apiServerCount := fmt.Sprintf("- --apiserver-count=%d\n    image: gcr.io/", len(masterNodes))
-	for _, node := range masterNodes {
-		manager.eventService.AddEvent(node.Name, "set api-server count")
-		manager.nodeCommunicator.TransformFileOverNode(node, node, "/etc/kubernetes/manifests/kube-apiserver.yaml", func(in string) string {
-			return strings.Replace(in, "image: gcr.io/", apiServerCount, 1)
-		})
+	if err := manager.DeployLoadBalancer([]Node{node}); err != nil {
+		return err
 	}
 
-	manager.eventService.AddEvent(masterNode.Name, "configuring kube-proxy")
-	// update config-map for kube-proxy to lb
-	proxyUpdateCmd := `kubectl get -n kube-system configmap/kube-proxy -o=yaml | sed -e 's/server: https\(.*\)/server: https:\/\/127.0.0.1:16443/g' | kubectl -n kube-system apply -f -`
-	manager.nodeCommunicator.RunCmd(*masterNode, proxyUpdateCmd)
+	// the kubeadm configuration is not used to join, but to update the control plane later on
+	if err := manager.writeMasterConfiguration(node); err != nil {
+		return err
+	}
 
-	// delete proxy pods
-	manager.nodeCommunicator.RunCmd(*masterNode, "kubectl get pods --all-namespaces | grep proxy | awk '{print$2}' | xargs kubectl -n kube-system delete pod")
+	if err := manager.writeEncryptionConfiguration(node); err != nil {
+		return err
+	}
 
-	// rewrite all kubeconfigs
-	kubeConfigs := []string{"kubelet.conf", "controller-manager.conf", "scheduler.conf"}
+	if err := manager.writeAuditConfiguration(node); err != nil {
+		return err
+	}
 
-	numProcs = 0
-	for _, node := range masterNodes {
-		numProcs++
+	if err := manager.nodeCommunicator.WriteFile(node, "/root/join-config.yaml", GenerateJoinConfiguration(node, manager.Cluster(), join), OwnerRead); err != nil {
+		return err
+	}
 
-		go func(node Node) {
-			manager.eventService.AddEvent(node.Name, "rewrite kubeconfigs")
-			for _, conf := range kubeConfigs {
-				_, err := manager.nodeCommunicator.RunCmd(node, fmt.Sprintf(rewriteTpl, conf, conf))
-				if err != nil {
-					errChan <- err
-				}
-			}
-			_, err = manager.nodeCommunicator.RunCmd(node, "systemctl restart docker && systemctl restart kubelet")
-			if err != nil {
-				errChan <- err
-			}
+	cni, err := GetCNI(manager.cni)
+	if err != nil {
+		return err
+	}
 
-			// wait for the apiserver to be back online
-			manager.eventService.AddEvent(node.Name, "wait for apiserver")
-			_, err = manager.nodeCommunicator.RunCmd(node, `until $(kubectl get node > /dev/null 2>/dev/null ); do echo "wait.."; sleep 1; done`)
-			manager.eventService.AddEvent(node.Name, pkg.CompletedEvent)
+	commands := []NodeCommand{
+		{"sysctl settings", GenerateCNINodePrepCommand(cni)},
+		{"kubeadm join", "kubeadm join --ignore-preflight-errors=all --config /root/join-config.yaml"},
+		{"configure kubectl", configureKubectlCommand},
+	}
 
-			trueChan <- true
-		}(node)
+	for _, command := range commands {
+		manager.eventService.AddEvent(node.Name, command.EventName)
+		if _, err := manager.nodeCommunicator.RunCmd(node, command.Command); err != nil {
+			return err
+		}
 	}
 
-	return waitOrError(trueChan, errChan, &numProcs)
+	return nil
 }
 
-// DeployLoadBalancer installs a client based load balancer for the master nodes to given nodes
-func (manager *Manager) DeployLoadBalancer(nodes []Node) error {
+// RemoveMaster removes a master node from the control plane. If etcd runs on the masters, the node
+// also leaves the etcd cluster. The server itself is not deleted
+func (manager *Manager) RemoveMaster(node Node) error {
+	masterNode, err := manager.findMasterExcluding([]Node{node})
+	if err != nil {
+		return errors.New("cannot remove the last master of a cluster")
+	}
 
-	errChan := make(chan error)
-	trueChan := make(chan bool)
-	numProcs := 0
-	masterNodesIP := []string{}
-	for _, node := range manager.clusterProvider.GetMasterNodes() {
-		masterNodesIP = append(masterNodesIP, node.IPAddress)
+	// the quorum of etcd is checked before the master is drained, so a refused removal leaves the master untouched
+	if manager.haEnabled && !manager.isolatedEtcd {
+		if err := NewEtcdManager(manager.clusterProvider, manager.nodeCommunicator).CheckRemoveMember(node); err != nil {
+			return err
+		}
 	}
 
-	masterIps := strings.Join(masterNodesIP, " ")
-	for _, node := range nodes {
-		if !node.IsMaster && node.IsEtcd {
-			continue
+	manager.eventService.AddEvent(node.Name, "remove from kubernetes")
+	_, err = manager.nodeCommunicator.RunCmd(masterNode, fmt.Sprintf("kubectl drain %s --ignore-daemonsets --delete-local-data --force --timeout=120s", node.Name))
+	if err != nil {
+		log.Printf("unable to drain node '%s': %v", node.Name, err)
+	}
+
+	_, err = manager.nodeCommunicator.RunCmd(masterNode, fmt.Sprintf("kubectl delete node %s", node.Name))
+	if err != nil {
+		log.Printf("unable to delete node '%s' from kubernetes: %v", node.Name, err)
+	}
+
+	if manager.haEnabled && !manager.isolatedEtcd {
+		if err := manager.RemoveEtcdNode(node); err != nil {
+			return err
 		}
-		numProcs++
-		go func(node Node) {
-			manager.eventService.AddEvent(node.Name, "deploy load balancer")
-			// delete old if exists
-			_, err := manager.nodeCommunicator.RunCmd(node, `docker ps | grep master-lb | awk '{print "docker stop "$1" && docker rm "$1}' | sh`)
-			if err != nil {
-				errChan <- err
+	}
+
+	// the reset removes the load balancer static pod as well, which the node does not need after leaving the cluster
+	_, err = manager.nodeCommunicator.RunCmd(node, "kubeadm reset -f")
+	if err != nil {
+		log.Printf("unable to reset node '%s': %v", node.Name, err)
+	}
+
+	manager.removeNode(node)
+	if err := manager.SetupEncryptedNetwork(); err != nil {
+		return err
+	}
+
+	if !manager.haEnabled {
+		return nil
+	}
+
+	if err := manager.DeployLoadBalancer(manager.nodes); err != nil {
+		return err
+	}
+
+	return manager.UpdateControlPlane()
+}
+
+// UpdateControlPlane refreshes the kubeadm configuration and the api servers on all master nodes, e.g. after masters
+// or etcd nodes were added or removed. The api server manifests are generated again by kubeadm, so they contain the
+// current etcd members. Before the next master is updated, the api server of the current one must be healthy again
+func (manager *Manager) UpdateControlPlane() error {
+	for i, node := range manager.clusterProvider.GetMasterNodes() {
+		manager.eventService.AddEvent(node.Name, "update control plane")
+		if err := manager.writeMasterConfiguration(node); err != nil {
+			return err
+		}
+
+		if i == 0 {
+			if _, err := manager.nodeCommunicator.RunCmd(node, "kubeadm init phase upload-config kubeadm --config /root/master-config.yaml"); err != nil {
+				return fmt.Errorf("unable to upload the kubeadm configuration: %v", err)
 			}
-			_, err = manager.nodeCommunicator.RunCmd(node, fmt.Sprintf("docker run -d --name=master-lb --restart=always -p 16443:16443 xetys/k8s-master-lb %s", masterIps))
-			if err != nil {
-				errChan <- err
+		}
+
+		if _, err := manager.nodeCommunicator.RunCmd(node, "kubeadm init phase control-plane apiserver --config /root/master-config.yaml"); err != nil {
+			return fmt.Errorf("unable to update the api server of '%s': %v", node.Name, err)
+		}
+
+		if err := manager.waitForAPIServerRestart(node); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// findMasterExcluding returns the first master node which is not in the given list
+func (manager *Manager) findMasterExcluding(excluded []Node) (Node, error) {
+	for _, node := range manager.clusterProvider.GetMasterNodes() {
+		isExcluded := false
+		for _, excludedNode := range excluded {
+			if node.Name == excludedNode.Name {
+				isExcluded = true
+				break
 			}
+		}
 
-			trueChan <- true
-		}(node)
+		if !isExcluded {
+			return node, nil
+		}
 	}
 
-	return waitOrError(trueChan, errChan, &numProcs)
+	return Node{}, errors.New("no master node found")
+}
+
+// AddEtcdNodes adds new nodes to the isolated etcd cluster and points all api servers to the new member list.
+// The nodes must be provisioned and part of the encrypted network already
+func (manager *Manager) AddEtcdNodes(nodes []Node) error {
+	if !manager.isolatedEtcd {
+		return errors.New("etcd nodes can only be added to clusters with an isolated etcd")
+	}
+
+	if err := manager.JoinEtcdNodes(nodes); err != nil {
+		return err
+	}
+
+	return manager.UpdateControlPlane()
+}
+
+// RemoveEtcdNodeFromCluster removes a node from the node list and the isolated etcd cluster. The api servers are
+// pointed to the remaining members first, so they never use the removed member. The server itself is not deleted
+func (manager *Manager) RemoveEtcdNodeFromCluster(node Node) error {
+	if !manager.isolatedEtcd {
+		return errors.New("etcd nodes can only be removed from clusters with an isolated etcd")
+	}
+
+	if err := NewEtcdManager(manager.clusterProvider, manager.nodeCommunicator).CheckRemoveMember(node); err != nil {
+		return err
+	}
+
+	manager.removeNode(node)
+	if err := manager.UpdateControlPlane(); err != nil {
+		return err
+	}
+
+	if err := manager.RemoveEtcdNode(node); err != nil {
+		return err
+	}
+
+	return manager.SetupEncryptedNetwork()
+}
+
+// removeNode removes a node from the node list of the manager and the provider
+func (manager *Manager) removeNode(node Node) {
+	remainingNodes := []Node{}
+	for _, clusterNode := range manager.nodes {
+		if clusterNode.Name != node.Name {
+			remainingNodes = append(remainingNodes, clusterNode)
+		}
+	}
+
+	manager.nodes = remainingNodes
+	delete(manager.ipAllocations, node.Name)
+	manager.clusterProvider.SetNodes(remainingNodes)
 }
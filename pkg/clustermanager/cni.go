@@ -0,0 +1,222 @@
+package clustermanager
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// DefaultCNI is the network plugin of clusters created before the plugin was configurable
+	DefaultCNI = "canal"
+	// overlayInterface is the interface the network plugins send their traffic over, so it gets encrypted
+	overlayInterface = "wg0"
+)
+
+// CNI describes a container network plugin, which can be installed into the cluster
+type CNI interface {
+	// Name returns the name used to select the plugin
+	Name() string
+	// DaemonSet returns the name of the daemon set in kube-system running the plugin on every node
+	DaemonSet() string
+	// Sysctls returns the kernel parameters required on every node
+	Sysctls() []string
+	// KernelModules returns the kernel modules required on every node
+	KernelModules() []string
+	// MTU returns the MTU of the pod interfaces, if the plugin sends its traffic over an interface with the given MTU
+	MTU(interfaceMTU int) int
+	// SupportsDualStack returns true, if the plugin assigns IPv4 and IPv6 addresses to the pods
+	SupportsDualStack() bool
+	// InstallCommand returns the command rendering and applying the manifest of the plugin on a master. The pod CIDR
+	// of dual-stack clusters contains the IPv4 and IPv6 network separated by a comma
+	InstallCommand(podCIDR string, mtu int) string
+}
+
+var cniPlugins = map[string]CNI{}
+
+func addCNI(cni CNI) {
+	cniPlugins[cni.Name()] = cni
+}
+
+func init() {
+	addCNI(canalCNI{})
+	addCNI(calicoCNI{})
+	addCNI(ciliumCNI{})
+	addCNI(flannelCNI{})
+}
+
+// CNIOrDefault returns the given network plugin name, or canal for clusters created before the plugin was configurable
+func CNIOrDefault(name string) string {
+	if name == "" {
+		return DefaultCNI
+	}
+
+	return name
+}
+
+// GetCNI returns the network plugin with the given name. An empty name returns the default plugin
+func GetCNI(name string) (CNI, error) {
+	name = CNIOrDefault(name)
+	cni, exists := cniPlugins[name]
+	if !exists {
+		return nil, fmt.Errorf("unsupported CNI '%s', must be one of %s", name, strings.Join(CNINames(), ", "))
+	}
+
+	return cni, nil
+}
+
+// CNINames returns the names of all supported network plugins
+func CNINames() []string {
+	names := []string{}
+	for name := range cniPlugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// GenerateCNINodePrepCommand generates the command loading the kernel modules and setting the sysctls required by
+// the network plugin
+func GenerateCNINodePrepCommand(cni CNI) string {
+	commands := []string{}
+	if modules := cni.KernelModules(); len(modules) > 0 {
+		commands = append(commands,
+			fmt.Sprintf("printf '%s\\n' > /etc/modules-load.d/50-cni.conf", strings.Join(modules, "\\n")),
+			"for i in "+strings.Join(modules, " ")+"; do modprobe $i; done",
+		)
+	}
+
+	// the settings of clusters created before the network plugin was configurable are replaced
+	commands = append(commands,
+		"rm -f /etc/sysctl.d/50-canal-calico.conf",
+		fmt.Sprintf("printf '# required by %s\\n%s\\n' > /etc/sysctl.d/50-cni.conf", cni.Name(), strings.Join(cni.Sysctls(), "\\n")),
+		"sysctl --load=/etc/sysctl.d/50-cni.conf",
+	)
+
+	return strings.Join(commands, " && ")
+}
+
+// sedManifestCommand returns a command downloading a manifest, replacing all expressions and applying it
+func sedManifestCommand(url string, expressions []string) string {
+	sed := ""
+	for _, expression := range expressions {
+		sed += fmt.Sprintf(" -e '%s'", expression)
+	}
+
+	return fmt.Sprintf("curl -sSL %s | sed%s | kubectl apply -f -", url, sed)
+}
+
+// canalCNI is calico policies on top of a flannel vxlan network
+type canalCNI struct{}
+
+func (canalCNI) Name() string      { return "canal" }
+func (canalCNI) DaemonSet() string { return "canal" }
+
+func (canalCNI) Sysctls() []string {
+	// strict RPF mode as required by canal
+	return []string{"net.ipv4.conf.default.rp_filter=1", "net.ipv4.conf.all.rp_filter=1"}
+}
+
+func (canalCNI) KernelModules() []string { return []string{"br_netfilter"} }
+
+// MTU subtracts the vxlan overhead
+func (canalCNI) MTU(interfaceMTU int) int { return interfaceMTU - 50 }
+
+func (canalCNI) SupportsDualStack() bool { return false }
+
+func (canalCNI) InstallCommand(podCIDR string, mtu int) string {
+	return sedManifestCommand("https://docs.projectcalico.org/v3.16/manifests/canal.yaml", []string{
+		fmt.Sprintf(`s|canal_iface: ""|canal_iface: "%s"|`, overlayInterface),
+		fmt.Sprintf(`s|veth_mtu: ".*"|veth_mtu: "%d"|`, mtu),
+		fmt.Sprintf(`s|"Network": "10.244.0.0/16"|"Network": "%s"|`, podCIDR),
+	})
+}
+
+// calicoCNI is calico with its IP-in-IP network
+type calicoCNI struct{}
+
+func (calicoCNI) Name() string      { return "calico" }
+func (calicoCNI) DaemonSet() string { return "calico-node" }
+
+func (calicoCNI) Sysctls() []string {
+	// strict RPF mode as required by calico
+	return []string{"net.ipv4.conf.default.rp_filter=1", "net.ipv4.conf.all.rp_filter=1"}
+}
+
+func (calicoCNI) KernelModules() []string { return []string{"ipip"} }
+
+// MTU subtracts the IP-in-IP overhead
+func (calicoCNI) MTU(interfaceMTU int) int { return interfaceMTU - 20 }
+
+func (calicoCNI) SupportsDualStack() bool { return true }
+
+func (calicoCNI) InstallCommand(podCIDR string, mtu int) string {
+	cidrs := strings.Split(podCIDR, ",")
+	expressions := []string{
+		`s|# - name: CALICO_IPV4POOL_CIDR|- name: CALICO_IPV4POOL_CIDR|`,
+		fmt.Sprintf(`s|#   value: "192.168.0.0/16"|  value: "%s"|`, cidrs[0]),
+		fmt.Sprintf(`s|veth_mtu: ".*"|veth_mtu: "%d"|`, mtu),
+	}
+	if len(cidrs) > 1 {
+		expressions = append(expressions, `s|"type": "calico-ipam"|"type": "calico-ipam", "assign_ipv4": "true", "assign_ipv6": "true"|`)
+	}
+	apply := sedManifestCommand("https://docs.projectcalico.org/v3.16/manifests/calico.yaml", expressions)
+
+	// calico detects the first interface by default, which is the public one
+	env := fmt.Sprintf("IP_AUTODETECTION_METHOD=interface=%s", overlayInterface)
+	if len(cidrs) > 1 {
+		env += fmt.Sprintf(" IP6=autodetect IP6_AUTODETECTION_METHOD=interface=%s CALICO_IPV6POOL_CIDR=%s FELIX_IPV6SUPPORT=true", overlayInterface, cidrs[1])
+	}
+
+	return apply + " && kubectl -n kube-system set env daemonset/calico-node " + env
+}
+
+// ciliumCNI is cilium with its vxlan tunnel
+type ciliumCNI struct{}
+
+func (ciliumCNI) Name() string      { return "cilium" }
+func (ciliumCNI) DaemonSet() string { return "cilium" }
+
+func (ciliumCNI) Sysctls() []string {
+	// cilium does not work with reverse path filtering
+	return []string{"net.ipv4.conf.default.rp_filter=0", "net.ipv4.conf.all.rp_filter=0"}
+}
+
+func (ciliumCNI) KernelModules() []string { return []string{} }
+
+// MTU subtracts the vxlan overhead
+func (ciliumCNI) MTU(interfaceMTU int) int { return interfaceMTU - 50 }
+
+func (ciliumCNI) SupportsDualStack() bool { return false }
+
+func (ciliumCNI) InstallCommand(podCIDR string, mtu int) string {
+	return sedManifestCommand("https://raw.githubusercontent.com/cilium/cilium/v1.8/install/kubernetes/quick-install.yaml", []string{
+		fmt.Sprintf(`s|cluster-pool-ipv4-cidr: ".*"|cluster-pool-ipv4-cidr: "%s"|`, podCIDR),
+		fmt.Sprintf(`s|^data:$|data:\n  mtu: "%d"\n  devices: "%s"|`, mtu, overlayInterface),
+	})
+}
+
+// flannelCNI is a plain flannel vxlan network without network policies
+type flannelCNI struct{}
+
+func (flannelCNI) Name() string      { return "flannel" }
+func (flannelCNI) DaemonSet() string { return "kube-flannel-ds" }
+
+func (flannelCNI) Sysctls() []string {
+	return []string{"net.bridge.bridge-nf-call-iptables=1", "net.ipv4.ip_forward=1"}
+}
+
+func (flannelCNI) KernelModules() []string { return []string{"br_netfilter"} }
+
+// MTU subtracts the vxlan overhead. Flannel derives it from the interface on its own
+func (flannelCNI) MTU(interfaceMTU int) int { return interfaceMTU - 50 }
+
+func (flannelCNI) SupportsDualStack() bool { return false }
+
+func (flannelCNI) InstallCommand(podCIDR string, mtu int) string {
+	return sedManifestCommand("https://raw.githubusercontent.com/coreos/flannel/v0.13.0/Documentation/kube-flannel.yml", []string{
+		fmt.Sprintf(`s|"Network": "10.244.0.0/16"|"Network": "%s"|`, podCIDR),
+		fmt.Sprintf(`s|- --kube-subnet-mgr|- --kube-subnet-mgr\n        - --iface=%s|`, overlayInterface),
+	})
+}
@@ -0,0 +1,79 @@
+package clustermanager
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGetCNI(t *testing.T) {
+	cni, err := GetCNI("")
+	if err != nil || cni.Name() != DefaultCNI {
+		t.Errorf("expected the default CNI for an empty name, got %v, %v", cni, err)
+	}
+
+	for _, name := range CNINames() {
+		if cni, err := GetCNI(name); err != nil || cni.Name() != name {
+			t.Errorf("expected CNI '%s', got %v, %v", name, cni, err)
+		}
+	}
+
+	if _, err := GetCNI("weave"); err == nil {
+		t.Error("expected an error for an unsupported CNI")
+	}
+}
+
+func TestGenerateCNINodePrepCommand(t *testing.T) {
+	command := GenerateCNINodePrepCommand(canalCNI{})
+	expected := `printf 'br_netfilter\n' > /etc/modules-load.d/50-cni.conf && for i in br_netfilter; do modprobe $i; done && ` +
+		`rm -f /etc/sysctl.d/50-canal-calico.conf && ` +
+		`printf '# required by canal\nnet.ipv4.conf.default.rp_filter=1\nnet.ipv4.conf.all.rp_filter=1\n' > /etc/sysctl.d/50-cni.conf && ` +
+		`sysctl --load=/etc/sysctl.d/50-cni.conf`
+
+	if command != expected {
+		t.Errorf("unexpected node prep command\nexpected: %s\ngot: %s", expected, command)
+	}
+}
+
+func TestCNIInstallCommandRendersPodCIDRAndMTU(t *testing.T) {
+	// flannel has no MTU setting, it derives the MTU from the interface it is bound to
+	expectedMTUs := map[string]string{
+		"canal":   `veth_mtu: "1370"`,
+		"calico":  `veth_mtu: "1400"`,
+		"cilium":  `mtu: "1370"`,
+		"flannel": "--iface=wg0",
+	}
+
+	for _, name := range CNINames() {
+		cni, _ := GetCNI(name)
+		command := cni.InstallCommand("10.32.0.0/16", cni.MTU(DefaultWireguardMTU))
+
+		if expectedMTU, ok := expectedMTUs[name]; !ok || !strings.Contains(command, expectedMTU) {
+			t.Errorf("install command of %s does not contain the MTU %q: %s", name, expectedMTU, command)
+		}
+
+		if !strings.Contains(command, "10.32.0.0/16") {
+			t.Errorf("install command of %s does not contain the pod CIDR: %s", name, command)
+		}
+
+		if !strings.Contains(command, "wg0") {
+			t.Errorf("install command of %s does not bind to the wireguard interface: %s", name, command)
+		}
+	}
+}
+
+func TestCalicoDualStackInstallCommand(t *testing.T) {
+	command := calicoCNI{}.InstallCommand("10.244.0.0/16,fd00:10:244::/56", 1400)
+
+	expectedParts := []string{
+		`value: "10.244.0.0/16"`,
+		`"assign_ipv6": "true"`,
+		"CALICO_IPV6POOL_CIDR=fd00:10:244::/56",
+		"IP6_AUTODETECTION_METHOD=interface=wg0",
+	}
+
+	for _, part := range expectedParts {
+		if !strings.Contains(command, part) {
+			t.Errorf("dual-stack install command of calico does not contain %q: %s", part, command)
+		}
+	}
+}
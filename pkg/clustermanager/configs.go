@@ -6,69 +6,126 @@ import (
 )
 
 // GenerateMasterConfiguration generate the kubernetes config for master
-func GenerateMasterConfiguration(masterNode Node, masterNodes []Node, etcdNodes []Node, kubernetesVersion string) string {
-	masterConfigTpl := `apiVersion: kubeadm.k8s.io/v1beta1
-kind: ClusterConfiguration
-kubernetesVersion: v%s
-networking:
-  serviceSubnet: "10.96.0.0/12"
-  podSubnet: "10.244.0.0/16"
-  dnsDomain: "cluster.local"
-apiServer:
-  featureGates:
-    CSINodeInfo: true
-    CSIDriverRegistry: true
-  certSANs:
-    - 127.0.0.1
-%s%s
----
-apiVersion: kubeadm.k8s.io/v1beta1
-kind: InitConfiguration
-localAPIEndpoint:
-  advertiseAddress: %s
-  bindPort: 6443
-nodeRegistration:
-  taints:
-  - effect: NoSchedule
-    key: node-role.kubernetes.io/master
----
-apiVersion: kubelet.config.k8s.io/v1beta1
-kind: KubeletConfiguration
-featureGates:
-  CSINodeInfo: true
-  CSIDriverRegistry: true
-`
+func GenerateMasterConfiguration(masterNode Node, masterNodes []Node, etcdNodes []Node, cluster Cluster) string {
+	apiVersion := KubeadmAPIVersion(cluster.KubernetesVersion)
+	dualStack := IsDualStack(cluster)
 
-	masterNodesIps := ""
+	certSANs := []string{"127.0.0.1"}
 	for _, node := range masterNodes {
-		masterNodesIps = fmt.Sprintf("%s    - %s\n", masterNodesIps, node.IPAddress)
-		masterNodesIps = fmt.Sprintf("%s    - %s\n", masterNodesIps, node.PrivateIPAddress)
+		certSANs = append(certSANs, node.IPAddress, node.PrivateIPAddress)
+		if node.IPv6Address != "" {
+			certSANs = append(certSANs, node.IPv6Address)
+		}
+		if node.PrivateIPv6Address != "" {
+			certSANs = append(certSANs, node.PrivateIPv6Address)
+		}
 	}
 
-	etcdConfig := ""
-	if len(etcdNodes) > 0 {
-		etcdConfig = `etcd:
-  external:
-    endpoints:` + "\n"
+	clusterConfig := kubeadmClusterConfiguration{
+		APIVersion:        apiVersion,
+		Kind:              "ClusterConfiguration",
+		KubernetesVersion: "v" + cluster.KubernetesVersion,
+		Networking: kubeadmNetworking{
+			ServiceSubnet: dualStackCIDRs(ServiceCIDROrDefault(cluster.ServiceCIDR), ServiceIPv6CIDROrDefault(cluster.ServiceIPv6CIDR), dualStack),
+			PodSubnet:     dualStackCIDRs(PodCIDROrDefault(cluster.PodCIDR), PodIPv6CIDROrDefault(cluster.PodIPv6CIDR), dualStack),
+			DNSDomain:     DNSDomainOrDefault(cluster.DNSDomain),
+		},
+		APIServer: kubeadmAPIServer{
+			CertSANs: certSANs,
+		},
+	}
 
-		for _, node := range etcdNodes {
-			etcdConfig = fmt.Sprintf("%s%s\n", etcdConfig, "    - http://"+node.PrivateIPAddress+":2379")
+	if cluster.HaEnabled {
+		clusterConfig.ControlPlaneEndpoint = controlPlaneEndpoint
+	}
+
+	if args := apiServerExtraArgs(cluster); len(args) > 0 {
+		clusterConfig.APIServer.ExtraArgs = map[string]string{}
+		for _, arg := range args {
+			clusterConfig.APIServer.ExtraArgs[arg[0]] = arg[1]
 		}
 	}
 
-	masterConfig := fmt.Sprintf(
-		masterConfigTpl,
-		kubernetesVersion,
-		masterNodesIps,
-		etcdConfig,
-		masterNode.PrivateIPAddress,
-	)
+	for _, volume := range apiServerExtraVolumes(cluster) {
+		clusterConfig.APIServer.ExtraVolumes = append(clusterConfig.APIServer.ExtraVolumes, kubeadmHostPathMount{
+			Name:      volume.name,
+			HostPath:  volume.path,
+			MountPath: volume.path,
+			ReadOnly:  volume.readOnly,
+			PathType:  "DirectoryOrCreate",
+		})
+	}
+
+	if len(etcdNodes) > 0 {
+		clusterConfig.Etcd = &kubeadmEtcd{External: kubeadmExternalEtcd{Endpoints: EtcdEndpoints(etcdNodes)}}
+	}
+
+	initConfig := kubeadmInitConfiguration{
+		APIVersion:       apiVersion,
+		Kind:             "InitConfiguration",
+		LocalAPIEndpoint: kubeadmAPIEndpoint{AdvertiseAddress: masterNode.PrivateIPAddress, BindPort: 6443},
+		NodeRegistration: kubeadmNodeRegistration{
+			CRISocket: CRISocket(cluster.ContainerRuntime),
+			Taints:    []kubeadmTaint{{Effect: "NoSchedule", Key: masterTaintKey(cluster.KubernetesVersion)}},
+		},
+	}
+
+	kubeletConfig := kubeletConfiguration{
+		APIVersion: kubeletAPIVersion,
+		Kind:       "KubeletConfiguration",
+	}
+
+	// dual-stack is enabled by default since kubernetes 1.23, which deprecated the feature gate
+	if dualStack && kubernetesMinorVersion(cluster.KubernetesVersion) < 23 {
+		clusterConfig.FeatureGates = map[string]bool{"IPv6DualStack": true}
+		kubeletConfig.FeatureGates = map[string]bool{"IPv6DualStack": true}
+	}
+
+	if CRISocket(cluster.ContainerRuntime) != "" {
+		// containerd runs the containers in systemd cgroups, so the kubelet has to do the same
+		kubeletConfig.CgroupDriver = "systemd"
+	}
 
-	return masterConfig
+	return marshalKubeadmDocuments(clusterConfig, initConfig, kubeletConfig)
 }
 
-// GenerateEtcdSystemdService generate configuration file used to manage etcd service on systemd
-func GenerateEtcdSystemdService(node Node, etcdNodes []Node) string {
+// apiServerExtraArgs returns the additional arguments of the api server
+func apiServerExtraArgs(cluster Cluster) [][2]string {
+	args := OIDCAPIServerArgs(cluster.OIDC)
+	if cluster.SecretsEncryption.Enabled() {
+		args = append(args, [2]string{"encryption-provider-config", encryptionConfigPath(cluster.SecretsEncryption)})
+	}
+
+	return append(args, AuditAPIServerArgs(cluster.Audit)...)
+}
+
+// hostPathVolume is a directory of a master mounted into the api server pod
+type hostPathVolume struct {
+	name     string
+	path     string
+	readOnly bool
+}
+
+// apiServerExtraVolumes returns the additional volumes of the api server
+func apiServerExtraVolumes(cluster Cluster) []hostPathVolume {
+	volumes := []hostPathVolume{}
+	if cluster.SecretsEncryption.Enabled() {
+		volumes = append(volumes, hostPathVolume{name: "encryption-config", path: encryptionConfigDir, readOnly: true})
+	}
+
+	if cluster.Audit.Enabled {
+		volumes = append(volumes,
+			hostPathVolume{name: "audit-config", path: auditConfigDir, readOnly: true},
+			hostPathVolume{name: "audit-log", path: auditLogDir},
+		)
+	}
+
+	return volumes
+}
+
+// GenerateEtcdSystemdService generate configuration file used to manage etcd service on systemd.
+// If joinExisting is true, the node is configured to join an already running etcd cluster
+func GenerateEtcdSystemdService(node Node, etcdNodes []Node, joinExisting bool) string {
 	serviceTpls := `# /etc/systemd/system/etcd.service
 [Unit]
 Description=etcd
@@ -81,7 +138,7 @@ ExecStart=/opt/etcd/etcd --name %s \
   --advertise-client-urls "http://%s:2379" \
   --listen-peer-urls "http://%s:2380" \
   --initial-cluster "%s" \
-  --initial-advertise-peer-urls "http://%s:2380" \
+%s  --initial-advertise-peer-urls "http://%s:2380" \
   --heartbeat-interval 200 \
   --election-timeout 5000
 Restart=always
@@ -99,6 +156,11 @@ WantedBy=multi-user.target
 	}
 	initialCluster := strings.Join(ips, ",")
 
+	initialClusterState := ""
+	if joinExisting {
+		initialClusterState = "  --initial-cluster-state existing \\\n"
+	}
+
 	service := fmt.Sprintf(
 		serviceTpls,
 		node.Name,
@@ -106,8 +168,19 @@ WantedBy=multi-user.target
 		node.PrivateIPAddress,
 		node.PrivateIPAddress,
 		initialCluster,
+		initialClusterState,
 		node.PrivateIPAddress,
 	)
 
 	return service
 }
+
+// EtcdEndpoints returns the client URLs of the given etcd nodes
+func EtcdEndpoints(etcdNodes []Node) []string {
+	endpoints := make([]string, len(etcdNodes))
+	for i, node := range etcdNodes {
+		endpoints[i] = "http://" + node.PrivateIPAddress + ":2379"
+	}
+
+	return endpoints
+}
@@ -1,32 +1,29 @@
 package clustermanager
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/andreyvit/diff"
 )
 
 func TestGenerateMasterConfiguration(t *testing.T) {
-	expectedConf := `apiVersion: kubeadm.k8s.io/v1beta1
+	expectedConf := `apiVersion: kubeadm.k8s.io/v1beta2
 kind: ClusterConfiguration
 kubernetesVersion: v1.19.2
 networking:
-  serviceSubnet: "10.96.0.0/12"
-  podSubnet: "10.244.0.0/16"
-  dnsDomain: "cluster.local"
+  serviceSubnet: 10.96.0.0/12
+  podSubnet: 10.244.0.0/16
+  dnsDomain: cluster.local
 apiServer:
-  featureGates:
-    CSINodeInfo: true
-    CSIDriverRegistry: true
   certSANs:
-    - 127.0.0.1
-    - 1.1.1.1
-    - 10.0.0.1
-    - 1.1.1.2
-    - 10.0.0.2
-
+  - 127.0.0.1
+  - 1.1.1.1
+  - 10.0.0.1
+  - 1.1.1.2
+  - 10.0.0.2
 ---
-apiVersion: kubeadm.k8s.io/v1beta1
+apiVersion: kubeadm.k8s.io/v1beta2
 kind: InitConfiguration
 localAPIEndpoint:
   advertiseAddress: 10.0.0.1
@@ -38,36 +35,29 @@ nodeRegistration:
 ---
 apiVersion: kubelet.config.k8s.io/v1beta1
 kind: KubeletConfiguration
-featureGates:
-  CSINodeInfo: true
-  CSIDriverRegistry: true
 `
 
-	expectedConfWithEtcd := `apiVersion: kubeadm.k8s.io/v1beta1
+	expectedConfWithEtcd := `apiVersion: kubeadm.k8s.io/v1beta2
 kind: ClusterConfiguration
 kubernetesVersion: v1.19.2
 networking:
-  serviceSubnet: "10.96.0.0/12"
-  podSubnet: "10.244.0.0/16"
-  dnsDomain: "cluster.local"
+  serviceSubnet: 10.96.0.0/12
+  podSubnet: 10.244.0.0/16
+  dnsDomain: cluster.local
 apiServer:
-  featureGates:
-    CSINodeInfo: true
-    CSIDriverRegistry: true
   certSANs:
-    - 127.0.0.1
-    - 1.1.1.1
-    - 10.0.0.1
-    - 1.1.1.2
-    - 10.0.0.2
+  - 127.0.0.1
+  - 1.1.1.1
+  - 10.0.0.1
+  - 1.1.1.2
+  - 10.0.0.2
 etcd:
   external:
     endpoints:
     - http://10.0.0.1:2379
     - http://10.0.0.2:2379
-
 ---
-apiVersion: kubeadm.k8s.io/v1beta1
+apiVersion: kubeadm.k8s.io/v1beta2
 kind: InitConfiguration
 localAPIEndpoint:
   advertiseAddress: 10.0.0.1
@@ -79,30 +69,191 @@ nodeRegistration:
 ---
 apiVersion: kubelet.config.k8s.io/v1beta1
 kind: KubeletConfiguration
-featureGates:
-  CSINodeInfo: true
-  CSIDriverRegistry: true
 `
 	nodes := []Node{
 		{Name: "node1", IPAddress: "1.1.1.1", PrivateIPAddress: "10.0.0.1"},
 		{Name: "node2", IPAddress: "1.1.1.2", PrivateIPAddress: "10.0.0.2"},
 	}
 
-	kubernetesVersion := "1.19.2"
+	cluster := Cluster{KubernetesVersion: "1.19.2"}
 
-	noEtcdConf := GenerateMasterConfiguration(nodes[0], nodes, nil, kubernetesVersion)
+	noEtcdConf := GenerateMasterConfiguration(nodes[0], nodes, nil, cluster)
 
 	if noEtcdConf != expectedConf {
 		t.Errorf("master config without etcd does not match to expected.\n%s\n", diff.LineDiff(noEtcdConf, expectedConf))
 	}
 
-	etcdConf := GenerateMasterConfiguration(nodes[0], nodes, nodes, kubernetesVersion)
+	etcdConf := GenerateMasterConfiguration(nodes[0], nodes, nodes, cluster)
 
 	if etcdConf != expectedConfWithEtcd {
 		t.Errorf("master config with etcd does not match to expected.\n%s\n", diff.LineDiff(etcdConf, expectedConfWithEtcd))
 	}
 }
 
+func TestGenerateMasterConfigurationAPIVersions(t *testing.T) {
+	nodes := []Node{
+		{Name: "node1", IPAddress: "1.1.1.1", PrivateIPAddress: "10.0.0.1"},
+	}
+
+	tests := []struct {
+		version    string
+		apiVersion string
+		taint      string
+	}{
+		{"1.19.2", "apiVersion: kubeadm.k8s.io/v1beta2", "key: node-role.kubernetes.io/master"},
+		{"1.22.4", "apiVersion: kubeadm.k8s.io/v1beta3", "key: node-role.kubernetes.io/master"},
+		{"1.24.1", "apiVersion: kubeadm.k8s.io/v1beta3", "key: node-role.kubernetes.io/control-plane"},
+	}
+
+	for _, test := range tests {
+		conf := GenerateMasterConfiguration(nodes[0], nodes, nil, Cluster{KubernetesVersion: test.version})
+		for _, part := range []string{test.apiVersion, test.taint, "kubernetesVersion: v" + test.version} {
+			if !strings.Contains(conf, part) {
+				t.Errorf("master config of kubernetes %s does not contain %q\n%s", test.version, part, conf)
+			}
+		}
+	}
+}
+
+func TestValidateKubernetesVersion(t *testing.T) {
+	valid := [][2]string{{"1.19.2", ContainerRuntimeDocker}, {"1.23.17", ""}, {"1.24.3", ContainerRuntimeContainerd}}
+	for _, test := range valid {
+		if err := ValidateKubernetesVersion(test[0], test[1]); err != nil {
+			t.Errorf("expected kubernetes %s with runtime %q to be valid, got %v", test[0], test[1], err)
+		}
+	}
+
+	invalid := [][2]string{{"v1.19.2", ContainerRuntimeDocker}, {"1.19", ContainerRuntimeDocker}, {"1.18.9", ContainerRuntimeDocker}, {"1.24.3", ContainerRuntimeDocker}, {"1.24.3", ""}}
+	for _, test := range invalid {
+		if err := ValidateKubernetesVersion(test[0], test[1]); err == nil {
+			t.Errorf("expected kubernetes %s with runtime %q to be invalid", test[0], test[1])
+		}
+	}
+
+	if version := KubernetesVersionOrDefault(""); version != DefaultKubernetesVersion {
+		t.Errorf("expected clusters without a version to use %s, got %s", DefaultKubernetesVersion, version)
+	}
+}
+
+func TestGenerateMasterConfigurationControlPlaneEndpoint(t *testing.T) {
+	nodes := []Node{
+		{Name: "node1", IPAddress: "1.1.1.1", PrivateIPAddress: "10.0.0.1"},
+	}
+
+	conf := GenerateMasterConfiguration(nodes[0], nodes, nil, Cluster{KubernetesVersion: "1.19.2"})
+	if strings.Contains(conf, "controlPlaneEndpoint") {
+		t.Errorf("master config of a cluster without HA contains a control plane endpoint\n%s", conf)
+	}
+
+	conf = GenerateMasterConfiguration(nodes[0], nodes, nodes, Cluster{KubernetesVersion: "1.19.2", HaEnabled: true})
+	if !strings.Contains(conf, "kubernetesVersion: v1.19.2\ncontrolPlaneEndpoint: 127.0.0.1:16443\n") {
+		t.Errorf("master config of a HA cluster does not use the load balancer as control plane endpoint\n%s", conf)
+	}
+}
+
+func TestGenerateMasterConfigurationWithContainerd(t *testing.T) {
+	nodes := []Node{
+		{Name: "node1", IPAddress: "1.1.1.1", PrivateIPAddress: "10.0.0.1"},
+	}
+
+	conf := GenerateMasterConfiguration(nodes[0], nodes, nil, Cluster{KubernetesVersion: "1.19.2", ContainerRuntime: ContainerRuntimeContainerd})
+
+	expectedParts := []string{
+		"nodeRegistration:\n  criSocket: /run/containerd/containerd.sock\n  taints:\n",
+		"kind: KubeletConfiguration\ncgroupDriver: systemd\n",
+	}
+
+	for _, part := range expectedParts {
+		if !strings.Contains(conf, part) {
+			t.Errorf("master config with containerd does not contain %q\n%s", part, conf)
+		}
+	}
+}
+
+func TestGenerateMasterConfigurationDualStack(t *testing.T) {
+	nodes := []Node{
+		{Name: "node1", IPAddress: "1.1.1.1", PrivateIPAddress: "10.0.0.1", IPv6Address: "2001:db8::1", PrivateIPv6Address: "fd00:10:0:1::a00:1"},
+	}
+
+	conf := GenerateMasterConfiguration(nodes[0], nodes, nil, Cluster{KubernetesVersion: "1.19.2", IPFamily: IPFamilyDualStack})
+
+	expectedParts := []string{
+		"serviceSubnet: 10.96.0.0/12,fd00:10:96::/112",
+		"podSubnet: 10.244.0.0/16,fd00:10:244::/56",
+		"featureGates:\n  IPv6DualStack: true\napiServer:",
+		"  - 2001:db8::1\n  - fd00:10:0:1::a00:1\n",
+		"kind: KubeletConfiguration\nfeatureGates:\n  IPv6DualStack: true\n",
+	}
+
+	for _, part := range expectedParts {
+		if !strings.Contains(conf, part) {
+			t.Errorf("dual-stack master config does not contain %q\n%s", part, conf)
+		}
+	}
+
+	// the feature gate is deprecated since dual-stack is enabled by default
+	conf = GenerateMasterConfiguration(nodes[0], nodes, nil, Cluster{KubernetesVersion: "1.24.3", IPFamily: IPFamilyDualStack})
+	if !strings.Contains(conf, expectedParts[1]) || strings.Contains(conf, "IPv6DualStack") {
+		t.Errorf("dual-stack master config of kubernetes 1.24 must not contain the IPv6DualStack feature gate\n%s", conf)
+	}
+}
+
+func TestGenerateMasterConfigurationWithOIDC(t *testing.T) {
+	nodes := []Node{
+		{Name: "node1", IPAddress: "1.1.1.1", PrivateIPAddress: "10.0.0.1"},
+	}
+	oidc := OIDCSettings{IssuerURL: "https://accounts.example.com", ClientID: "kubernetes", GroupsClaim: "groups", CA: "ca"}
+
+	conf := GenerateMasterConfiguration(nodes[0], nodes, nil, Cluster{KubernetesVersion: "1.19.2", OIDC: oidc})
+
+	expected := `apiServer:
+  extraArgs:
+    oidc-ca-file: /etc/kubernetes/pki/oidc-ca.crt
+    oidc-client-id: kubernetes
+    oidc-groups-claim: groups
+    oidc-issuer-url: https://accounts.example.com
+  certSANs:`
+	if !strings.Contains(conf, expected) {
+		t.Errorf("master config does not contain the OIDC arguments\n%s", conf)
+	}
+}
+
+func TestGenerateJoinConfiguration(t *testing.T) {
+	expectedConf := `apiVersion: kubeadm.k8s.io/v1beta2
+kind: JoinConfiguration
+discovery:
+  bootstrapToken:
+    apiServerEndpoint: 10.0.0.1:6443
+    token: abcdef.0123456789abcdef
+    caCertHashes:
+    - sha256:1234
+nodeRegistration:
+  criSocket: /run/containerd/containerd.sock
+`
+	node := Node{Name: "worker1", IPAddress: "1.1.1.2", PrivateIPAddress: "10.0.0.2"}
+	cluster := Cluster{KubernetesVersion: "1.19.2", ContainerRuntime: ContainerRuntimeContainerd}
+	join := JoinParameters{APIServerEndpoint: "10.0.0.1:6443", Token: "abcdef.0123456789abcdef", CACertHash: "sha256:1234"}
+
+	conf := GenerateJoinConfiguration(node, cluster, join)
+	if conf != expectedConf {
+		t.Errorf("worker join config does not match to expected.\n%s\n", diff.LineDiff(conf, expectedConf))
+	}
+
+	join.ControlPlane = true
+	join.CertificateKey = "key"
+	conf = GenerateJoinConfiguration(node, cluster, join)
+
+	expected := `controlPlane:
+  localAPIEndpoint:
+    advertiseAddress: 10.0.0.2
+    bindPort: 6443
+  certificateKey: key
+`
+	if !strings.HasSuffix(conf, expected) || !strings.Contains(conf, "key: node-role.kubernetes.io/master") {
+		t.Errorf("master join config does not join the control plane\n%s", conf)
+	}
+}
+
 func TestGenerateEtcdSystemdService(t *testing.T) {
 	expectedString := `# /etc/systemd/system/etcd.service
 [Unit]
@@ -133,9 +284,23 @@ WantedBy=multi-user.target
 		{Name: "kube3", IPAddress: "1.1.1.3", PrivateIPAddress: "10.0.1.13"},
 	}
 
-	etcdService := GenerateEtcdSystemdService(nodes[0], nodes)
+	etcdService := GenerateEtcdSystemdService(nodes[0], nodes, false)
 
 	if etcdService != expectedString {
 		t.Errorf("etcd systemd service does not match expected\n%s", diff.LineDiff(expectedString, etcdService))
 	}
 }
+
+func TestGenerateEtcdSystemdServiceJoiningExistingCluster(t *testing.T) {
+	nodes := []Node{
+		{Name: "kube1", IPAddress: "1.1.1.1", PrivateIPAddress: "10.0.1.11"},
+		{Name: "kube2", IPAddress: "1.1.1.2", PrivateIPAddress: "10.0.1.12"},
+	}
+
+	etcdService := GenerateEtcdSystemdService(nodes[1], nodes, true)
+	expectedLine := "  --initial-cluster-state existing \\\n  --initial-advertise-peer-urls \"http://10.0.1.12:2380\" \\\n"
+
+	if !strings.Contains(etcdService, expectedLine) {
+		t.Errorf("etcd systemd service does not join the existing cluster\n%s", etcdService)
+	}
+}
@@ -0,0 +1,153 @@
+package clustermanager
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+const (
+	// EncryptionProviderAESCBC encrypts secrets with AES-CBC
+	EncryptionProviderAESCBC = "aescbc"
+	// EncryptionProviderSecretbox encrypts secrets with XSalsa20 and Poly1305
+	EncryptionProviderSecretbox = "secretbox"
+)
+
+// encryptionConfigDir is the directory of the encryption configuration on the masters, which is mounted into the
+// api server pod
+const encryptionConfigDir = "/etc/kubernetes/encryption"
+
+// EncryptionKey is a key secrets are encrypted with in etcd
+type EncryptionKey struct {
+	Name      string    `json:"name"`
+	Secret    string    `json:"secret"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SecretsEncryptionSettings configure the encryption of secrets at rest. Secrets are written with the first key,
+// and read with any of the keys
+type SecretsEncryptionSettings struct {
+	Provider string          `json:"provider"`
+	Keys     []EncryptionKey `json:"keys"`
+}
+
+// Enabled checks if secrets are encrypted
+func (settings SecretsEncryptionSettings) Enabled() bool {
+	return len(settings.Keys) > 0
+}
+
+// ValidateEncryptionProvider checks that secrets can be encrypted with the provider
+func ValidateEncryptionProvider(provider string) error {
+	if provider != EncryptionProviderAESCBC && provider != EncryptionProviderSecretbox {
+		return fmt.Errorf("unsupported encryption provider '%s', must be %s or %s", provider, EncryptionProviderAESCBC, EncryptionProviderSecretbox)
+	}
+
+	return nil
+}
+
+// GenerateEncryptionKey creates a random 32 byte key, which is named after its creation time
+func GenerateEncryptionKey() (EncryptionKey, error) {
+	var secret [32]byte
+	if _, err := rand.Reader.Read(secret[:]); err != nil {
+		return EncryptionKey{}, fmt.Errorf("unable to generate an encryption key: %v", err)
+	}
+
+	createdAt := time.Now().UTC()
+
+	return EncryptionKey{
+		Name:      "key-" + createdAt.Format("20060102150405"),
+		Secret:    base64.StdEncoding.EncodeToString(secret[:]),
+		CreatedAt: createdAt,
+	}, nil
+}
+
+// GenerateEncryptionConfiguration generates the configuration of the api server encrypting secrets with the keys.
+// Secrets written before the encryption was enabled are stored unencrypted, so they are still read with the
+// identity provider
+func GenerateEncryptionConfiguration(settings SecretsEncryptionSettings) string {
+	configTpl := `apiVersion: apiserver.config.k8s.io/v1
+kind: EncryptionConfiguration
+resources:
+  - resources:
+      - secrets
+    providers:
+      - %s:
+          keys:
+%s      - identity: {}
+`
+
+	keys := ""
+	for _, key := range settings.Keys {
+		keys += fmt.Sprintf("            - name: %s\n              secret: %s\n", key.Name, key.Secret)
+	}
+
+	return fmt.Sprintf(configTpl, settings.Provider, keys)
+}
+
+// encryptionConfigPath returns the path of the encryption configuration on the masters. It contains the hash of the
+// configuration, so the api server manifest generated by kubeadm changes and the api server is restarted whenever the
+// keys change, as it only reads the configuration on start
+func encryptionConfigPath(settings SecretsEncryptionSettings) string {
+	hash := sha256.Sum256([]byte(GenerateEncryptionConfiguration(settings)))
+
+	return fmt.Sprintf("%s/config-%s.yaml", encryptionConfigDir, hex.EncodeToString(hash[:8]))
+}
+
+// writeEncryptionConfiguration places the encryption configuration on a master, if secrets are encrypted
+func (manager *Manager) writeEncryptionConfiguration(node Node) error {
+	if !manager.encryption.Enabled() {
+		return nil
+	}
+
+	if _, err := manager.nodeCommunicator.RunCmd(node, fmt.Sprintf("mkdir -p %s && chmod 700 %s", encryptionConfigDir, encryptionConfigDir)); err != nil {
+		return err
+	}
+
+	return manager.nodeCommunicator.WriteFile(node, encryptionConfigPath(manager.encryption), GenerateEncryptionConfiguration(manager.encryption), OwnerRead)
+}
+
+// ApplySecretsEncryption places the encryption configuration with the given keys on all masters, and updates the
+// control plane to use it. The configurations with previous keys are removed once all api servers are updated
+func (manager *Manager) ApplySecretsEncryption(settings SecretsEncryptionSettings) error {
+	manager.encryption = settings
+
+	masterNodes := manager.clusterProvider.GetMasterNodes()
+	for _, node := range masterNodes {
+		manager.eventService.AddEvent(node.Name, "update encryption configuration")
+		if err := manager.writeEncryptionConfiguration(node); err != nil {
+			return err
+		}
+	}
+
+	if err := manager.UpdateControlPlane(); err != nil {
+		return err
+	}
+
+	removeCommand := fmt.Sprintf("find %s -name 'config*.yaml' ! -path %s -delete", encryptionConfigDir, encryptionConfigPath(settings))
+	for _, node := range masterNodes {
+		if _, err := manager.nodeCommunicator.RunCmd(node, removeCommand); err != nil {
+			return fmt.Errorf("unable to remove the previous encryption configuration of '%s': %v", node.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// RewriteSecrets writes all secrets again, so they are encrypted with the current key
+func (manager *Manager) RewriteSecrets() error {
+	masterNode, err := manager.clusterProvider.GetMasterNode()
+	if err != nil {
+		return err
+	}
+
+	manager.eventService.AddEvent(masterNode.Name, "rewrite secrets")
+	_, err = manager.nodeCommunicator.RunCmd(*masterNode, "kubectl get secrets --all-namespaces -o json | kubectl replace -f -")
+	if err != nil {
+		return fmt.Errorf("unable to rewrite secrets: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package clustermanager
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/andreyvit/diff"
+)
+
+func TestGenerateEncryptionConfiguration(t *testing.T) {
+	settings := SecretsEncryptionSettings{
+		Provider: EncryptionProviderAESCBC,
+		Keys: []EncryptionKey{
+			{Name: "key-2", Secret: "c2Vjb25k"},
+			{Name: "key-1", Secret: "Zmlyc3Q="},
+		},
+	}
+
+	expected := `apiVersion: apiserver.config.k8s.io/v1
+kind: EncryptionConfiguration
+resources:
+  - resources:
+      - secrets
+    providers:
+      - aescbc:
+          keys:
+            - name: key-2
+              secret: c2Vjb25k
+            - name: key-1
+              secret: Zmlyc3Q=
+      - identity: {}
+`
+
+	config := GenerateEncryptionConfiguration(settings)
+	if config != expected {
+		t.Errorf("encryption configuration does not match expected\n%s", diff.LineDiff(expected, config))
+	}
+}
+
+func TestGenerateEncryptionKey(t *testing.T) {
+	key, err := GenerateEncryptionKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret, err := base64.StdEncoding.DecodeString(key.Secret)
+	if err != nil || len(secret) != 32 {
+		t.Errorf("expected a base64 encoded 32 byte key, got %s", key.Secret)
+	}
+
+	if !strings.HasPrefix(key.Name, "key-") || key.CreatedAt.IsZero() {
+		t.Errorf("expected a key named after its creation time, got %+v", key)
+	}
+}
+
+func TestGenerateMasterConfigurationWithSecretsEncryption(t *testing.T) {
+	nodes := []Node{
+		{Name: "node1", IPAddress: "1.1.1.1", PrivateIPAddress: "10.0.0.1"},
+	}
+	settings := SecretsEncryptionSettings{Provider: EncryptionProviderSecretbox, Keys: []EncryptionKey{{Name: "key-1", Secret: "Zmlyc3Q="}}}
+
+	conf := GenerateMasterConfiguration(nodes[0], nodes, nil, Cluster{KubernetesVersion: "1.19.2", SecretsEncryption: settings})
+
+	expected := `apiServer:
+  extraArgs:
+    encryption-provider-config: ` + encryptionConfigPath(settings) + `
+  extraVolumes:
+  - name: encryption-config
+    hostPath: /etc/kubernetes/encryption
+    mountPath: /etc/kubernetes/encryption
+    readOnly: true
+    pathType: DirectoryOrCreate
+  certSANs:`
+	if !strings.Contains(conf, expected) {
+		t.Errorf("master config does not configure the encryption\n%s", conf)
+	}
+
+	rotated := SecretsEncryptionSettings{Provider: settings.Provider, Keys: append([]EncryptionKey{{Name: "key-2", Secret: "c2Vjb25k"}}, settings.Keys...)}
+	if encryptionConfigPath(rotated) == encryptionConfigPath(settings) {
+		t.Errorf("encryption configuration path does not change with the keys: %s", encryptionConfigPath(settings))
+	}
+
+	if strings.Contains(conf, "Zmlyc3Q=") {
+		t.Errorf("master config contains the encryption key\n%s", conf)
+	}
+}
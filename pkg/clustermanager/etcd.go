@@ -1,10 +1,14 @@
 package clustermanager
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 )
 
+const etcdctl = "ETCDCTL_API=3 /opt/etcd/etcdctl"
+
 // EtcdManager is a tool which provides basic backup & restore functionality for HA clusters
 type EtcdManager struct {
 	provider         ClusterProvider
@@ -39,7 +43,7 @@ func (manager *EtcdManager) CreateSnapshot(name string) error {
 		return err
 	}
 
-	saveCommand := fmt.Sprintf("ETCDCTL_API=3 /opt/etcd/etcdctl snapshot save ~/etcd-snapshots/%s.db", snapshotName)
+	saveCommand := fmt.Sprintf("%s snapshot save ~/etcd-snapshots/%s.db", etcdctl, snapshotName)
 	_, err = manager.nodeCommunicator.RunCmd(firstEtcdNode, saveCommand)
 
 	if err != nil {
@@ -96,7 +100,8 @@ func (manager *EtcdManager) restoreNode(node Node, snapshotPath, initialCluster
 		return err
 	}
 
-	restoreCmd := fmt.Sprintf("ETCDCTL_API=3 /opt/etcd/etcdctl snapshot restore %s --name %s --data-dir /var/lib/etcd --initial-cluster %s --initial-advertise-peer-urls \"http://%s:2380\"",
+	restoreCmd := fmt.Sprintf("%s snapshot restore %s --name %s --data-dir /var/lib/etcd --initial-cluster %s --initial-advertise-peer-urls \"http://%s:2380\"",
+		etcdctl,
 		snapshotPath,
 		node.Name,
 		initialCluster,
@@ -155,6 +160,253 @@ func (manager *EtcdManager) copyAndRestore(firstEtcdNode Node, snapshotPath stri
 	return nil
 }
 
+// ListMembers returns the current members of the etcd cluster
+func (manager *EtcdManager) ListMembers() ([]EtcdMember, error) {
+	out, err := manager.runOnAnyEtcdNode(etcdctl + " member list")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseEtcdMemberList(out)
+}
+
+// AddMember announces a new member to the etcd cluster. The etcd service on the new node must be started
+// with the initial cluster state 'existing' afterwards
+func (manager *EtcdManager) AddMember(node Node) error {
+	executingNode, err := manager.findOtherEtcdNode(node)
+	if err != nil {
+		return err
+	}
+
+	addCommand := fmt.Sprintf("%s member add %s --peer-urls=http://%s:2380", etcdctl, node.Name, node.PrivateIPAddress)
+	_, err = manager.nodeCommunicator.RunCmd(executingNode, addCommand)
+
+	return err
+}
+
+// RemoveMember removes the member with the given node name from the etcd cluster
+func (manager *EtcdManager) RemoveMember(node Node) error {
+	executingNode, err := manager.findOtherEtcdNode(node)
+	if err != nil {
+		return err
+	}
+
+	members, err := manager.listMembersOnNode(executingNode)
+	if err != nil {
+		return err
+	}
+
+	for _, member := range members {
+		if member.Name == node.Name {
+			removeCommand := fmt.Sprintf("%s member remove %s", etcdctl, member.ID)
+			_, err = manager.nodeCommunicator.RunCmd(executingNode, removeCommand)
+
+			return err
+		}
+	}
+
+	return fmt.Errorf("node '%s' is not a member of the etcd cluster", node.Name)
+}
+
+// MemberHealth returns the health of all etcd members, indexed by member name
+func (manager *EtcdManager) MemberHealth() (map[string]bool, error) {
+	members, err := manager.ListMembers()
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := []string{}
+	for _, member := range members {
+		if member.ClientURLs != "" {
+			endpoints = append(endpoints, member.ClientURLs)
+		}
+	}
+
+	health := make(map[string]bool)
+	for _, member := range members {
+		health[member.Name] = false
+	}
+
+	if len(endpoints) == 0 {
+		return health, nil
+	}
+
+	// endpoint health exits non-zero if any endpoint is unhealthy, but we are interested in every single result
+	healthCommand := fmt.Sprintf("%s endpoint health --endpoints=%s 2>&1 || true", etcdctl, strings.Join(endpoints, ","))
+	out, err := manager.runOnAnyEtcdNode(healthCommand)
+	if err != nil {
+		return nil, err
+	}
+
+	endpointHealth := parseEtcdEndpointHealth(out)
+	for _, member := range members {
+		health[member.Name] = endpointHealth[member.ClientURLs]
+	}
+
+	return health, nil
+}
+
+// CheckAddMember returns an error, if adding a new member would cost the etcd cluster its quorum
+func (manager *EtcdManager) CheckAddMember() error {
+	health, err := manager.MemberHealth()
+	if err != nil {
+		return err
+	}
+
+	// the new member does not count as healthy until it is started
+	return checkQuorum(len(health)+1, countHealthy(health))
+}
+
+// CheckRemoveMember returns an error, if removing the member would cost the etcd cluster its quorum
+func (manager *EtcdManager) CheckRemoveMember(node Node) error {
+	health, err := manager.MemberHealth()
+	if err != nil {
+		return err
+	}
+
+	isHealthy, isMember := health[node.Name]
+	if !isMember {
+		return fmt.Errorf("node '%s' is not a member of the etcd cluster", node.Name)
+	}
+
+	if len(health) == 1 {
+		return errors.New("cannot remove the last member of the etcd cluster")
+	}
+
+	healthy := countHealthy(health)
+	if isHealthy {
+		healthy--
+	}
+
+	return checkQuorum(len(health)-1, healthy)
+}
+
+// CheckMemberDowntime returns an error, if a temporary outage of the member would cost the etcd cluster its quorum
+func (manager *EtcdManager) CheckMemberDowntime(node Node) error {
+	health, err := manager.MemberHealth()
+	if err != nil {
+		return err
+	}
+
+	isHealthy, isMember := health[node.Name]
+	if !isMember {
+		return fmt.Errorf("node '%s' is not a member of the etcd cluster", node.Name)
+	}
+
+	healthy := countHealthy(health)
+	if isHealthy {
+		healthy--
+	}
+
+	return checkQuorum(len(health), healthy)
+}
+
+// checkQuorum returns an error, if an etcd cluster of the given size has not enough healthy members for a quorum
+func checkQuorum(size int, healthy int) error {
+	quorum := size/2 + 1
+	if healthy < quorum {
+		return fmt.Errorf("operation would lose etcd quorum: %d of %d members would be healthy, but %d are required", healthy, size, quorum)
+	}
+
+	return nil
+}
+
+func countHealthy(health map[string]bool) int {
+	healthy := 0
+	for _, isHealthy := range health {
+		if isHealthy {
+			healthy++
+		}
+	}
+
+	return healthy
+}
+
+// listMembersOnNode runs 'etcdctl member list' on the given node
+func (manager *EtcdManager) listMembersOnNode(node Node) ([]EtcdMember, error) {
+	out, err := manager.nodeCommunicator.RunCmd(node, etcdctl+" member list")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseEtcdMemberList(out)
+}
+
+// runOnAnyEtcdNode runs a command on the first etcd node which is reachable
+func (manager *EtcdManager) runOnAnyEtcdNode(command string) (string, error) {
+	etcdNodes := manager.provider.GetEtcdNodes()
+
+	if len(etcdNodes) == 0 {
+		return "", fmt.Errorf("cannot run etcd commands when no etcd nodes are available")
+	}
+
+	var err error
+	var out string
+	for _, node := range etcdNodes {
+		out, err = manager.nodeCommunicator.RunCmd(node, command)
+		if err == nil {
+			return out, nil
+		}
+	}
+
+	return "", err
+}
+
+// findOtherEtcdNode returns an etcd node, which is not the given one, to run membership commands on
+func (manager *EtcdManager) findOtherEtcdNode(node Node) (Node, error) {
+	for _, etcdNode := range manager.provider.GetEtcdNodes() {
+		if etcdNode.Name != node.Name {
+			return etcdNode, nil
+		}
+	}
+
+	return Node{}, fmt.Errorf("no etcd node found to manage membership of '%s'", node.Name)
+}
+
+// parseEtcdMemberList parses the output of 'etcdctl member list' (API v3, simple format)
+func parseEtcdMemberList(out string) ([]EtcdMember, error) {
+	members := []EtcdMember{}
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		fields := strings.Split(line, ",")
+		if len(fields) < 5 {
+			return nil, fmt.Errorf("unable to parse etcd member line %q", line)
+		}
+
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+
+		members = append(members, EtcdMember{
+			ID:         fields[0],
+			Started:    fields[1] == "started",
+			Name:       fields[2],
+			PeerURLs:   fields[3],
+			ClientURLs: fields[4],
+		})
+	}
+
+	return members, nil
+}
+
+// parseEtcdEndpointHealth parses the output of 'etcdctl endpoint health' and returns the health by endpoint
+func parseEtcdEndpointHealth(out string) map[string]bool {
+	health := make(map[string]bool)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[1] != "is" {
+			continue
+		}
+
+		health[fields[0]] = strings.HasPrefix(fields[2], "healthy")
+	}
+
+	return health
+}
+
 // generateName returns a datetime string for unnamed snapshots
 func generateName() string {
 	t := time.Now()
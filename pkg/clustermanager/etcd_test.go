@@ -0,0 +1,71 @@
+package clustermanager
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseEtcdMemberList(t *testing.T) {
+	out := `8e9e05c52164694d, started, kube1, http://10.0.1.11:2380, http://10.0.1.11:2379
+91bc3c398fb3c146, unstarted, kube2, http://10.0.1.12:2380,
+`
+	expected := []EtcdMember{
+		{ID: "8e9e05c52164694d", Name: "kube1", Started: true, PeerURLs: "http://10.0.1.11:2380", ClientURLs: "http://10.0.1.11:2379"},
+		{ID: "91bc3c398fb3c146", Name: "kube2", Started: false, PeerURLs: "http://10.0.1.12:2380", ClientURLs: ""},
+	}
+
+	members, err := parseEtcdMemberList(out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(members, expected) {
+		t.Errorf("parsed members do not match expected\nexpected: %v\ngot: %v", expected, members)
+	}
+
+	if _, err := parseEtcdMemberList("garbage"); err == nil {
+		t.Error("expected an error on parsing an invalid member list")
+	}
+}
+
+func TestParseEtcdEndpointHealth(t *testing.T) {
+	out := `http://10.0.1.1:2379 is healthy: successfully committed proposal: took = 2.110377ms
+http://10.0.1.2:2379 is unhealthy: failed to connect: dial tcp 10.0.1.2:2379: connect: connection refused
+Error: unhealthy cluster
+`
+	expected := map[string]bool{
+		"http://10.0.1.1:2379": true,
+		"http://10.0.1.2:2379": false,
+	}
+
+	health := parseEtcdEndpointHealth(out)
+	if !reflect.DeepEqual(health, expected) {
+		t.Errorf("parsed health does not match expected\nexpected: %v\ngot: %v", expected, health)
+	}
+}
+
+func TestCheckQuorum(t *testing.T) {
+	testCases := []struct {
+		size      int
+		healthy   int
+		expectErr bool
+	}{
+		{size: 3, healthy: 3, expectErr: false},
+		{size: 3, healthy: 2, expectErr: false},
+		{size: 3, healthy: 1, expectErr: true},
+		{size: 4, healthy: 2, expectErr: true},
+		{size: 4, healthy: 3, expectErr: false},
+		{size: 1, healthy: 1, expectErr: false},
+	}
+
+	for _, tC := range testCases {
+		err := checkQuorum(tC.size, tC.healthy)
+		if tC.expectErr && err == nil {
+			t.Errorf("expected quorum error for %d of %d healthy members", tC.healthy, tC.size)
+		}
+
+		if !tC.expectErr && err != nil {
+			t.Errorf("unexpected quorum error for %d of %d healthy members: %v", tC.healthy, tC.size, err)
+		}
+	}
+}
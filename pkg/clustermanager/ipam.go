@@ -0,0 +1,125 @@
+package clustermanager
+
+import (
+	"fmt"
+	"net"
+)
+
+// IPAM allocates the private IP addresses of the nodes from the node CIDR. The allocations map node names to their
+// addresses and are persisted with the cluster, so addresses are never handed out twice
+type IPAM struct {
+	network     *net.IPNet
+	allocations map[string]string
+}
+
+// NewIPAM creates an IPAM for the given CIDR with the already existing allocations
+func NewIPAM(cidr string, allocations map[string]string) (*IPAM, error) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse cidr %q", cidr)
+	}
+
+	ipam := &IPAM{network: network, allocations: make(map[string]string)}
+	for name, address := range allocations {
+		if err := ipam.Reserve(name, address); err != nil {
+			return nil, err
+		}
+	}
+
+	return ipam, nil
+}
+
+// NewClusterIPAM creates an IPAM for the node CIDR of the cluster. The addresses of nodes of clusters created
+// before the allocations were persisted are reserved as well
+func NewClusterIPAM(cluster Cluster) (*IPAM, error) {
+	ipam, err := NewIPAM(cluster.NodeCIDR, cluster.IPAllocations)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, node := range cluster.Nodes {
+		if _, exists := ipam.allocations[node.Name]; exists || node.PrivateIPAddress == "" {
+			continue
+		}
+
+		if err := ipam.Reserve(node.Name, node.PrivateIPAddress); err != nil {
+			return nil, err
+		}
+	}
+
+	return ipam, nil
+}
+
+// Allocate returns the lowest free address of the network for the node. A node which already has an address
+// keeps it
+func (ipam *IPAM) Allocate(name string) (string, error) {
+	if address, exists := ipam.allocations[name]; exists {
+		return address, nil
+	}
+
+	used := make(map[string]bool)
+	for _, address := range ipam.allocations {
+		used[address] = true
+	}
+
+	for ip := nextIP(ipam.network.IP); ipam.isUsable(ip); ip = nextIP(ip) {
+		if !used[ip.String()] {
+			ipam.allocations[name] = ip.String()
+			return ip.String(), nil
+		}
+	}
+
+	return "", fmt.Errorf("no free address left in %s", ipam.network)
+}
+
+// Reserve allocates the given address for the node, e.g. for nodes which already have one
+func (ipam *IPAM) Reserve(name string, address string) error {
+	ip := net.ParseIP(address)
+	if ip == nil || !ipam.isUsable(ip) || ip.Equal(ipam.network.IP) {
+		return fmt.Errorf("address %s of node '%s' is not a usable address of %s", address, name, ipam.network)
+	}
+
+	for owner, allocated := range ipam.allocations {
+		if allocated == ip.String() && owner != name {
+			return fmt.Errorf("address %s of node '%s' is already allocated by node '%s'", address, name, owner)
+		}
+	}
+
+	ipam.allocations[name] = ip.String()
+
+	return nil
+}
+
+// Release frees the address of the node
+func (ipam *IPAM) Release(name string) {
+	delete(ipam.allocations, name)
+}
+
+// Allocations returns a copy of all allocations, mapping node names to their addresses
+func (ipam *IPAM) Allocations() map[string]string {
+	allocations := make(map[string]string, len(ipam.allocations))
+	for name, address := range ipam.allocations {
+		allocations[name] = address
+	}
+
+	return allocations
+}
+
+// isUsable returns true, if the address is part of the network and not its last (broadcast) address
+func (ipam *IPAM) isUsable(ip net.IP) bool {
+	return ipam.network.Contains(ip) && ipam.network.Contains(nextIP(ip))
+}
+
+// nextIP returns the address following the given one
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+
+	return next
+}
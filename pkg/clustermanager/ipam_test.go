@@ -0,0 +1,118 @@
+package clustermanager
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestIPAMAllocate(t *testing.T) {
+	ipam, err := NewIPAM("10.0.1.0/24", map[string]string{"master-01": "10.0.1.2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"master-01": "10.0.1.2",
+		"worker-01": "10.0.1.1",
+		"worker-02": "10.0.1.3",
+	}
+
+	for _, name := range []string{"master-01", "worker-01", "worker-02"} {
+		address, err := ipam.Allocate(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if address != expected[name] {
+			t.Errorf("expected address %s for %s, got %s", expected[name], name, address)
+		}
+	}
+
+	ipam.Release("worker-01")
+	if address, _ := ipam.Allocate("worker-03"); address != "10.0.1.1" {
+		t.Errorf("expected the released address 10.0.1.1 to be reused, got %s", address)
+	}
+}
+
+func TestIPAMAllocateLargeNetwork(t *testing.T) {
+	ipam, err := NewIPAM("10.0.0.0/16", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var address string
+	for i := 1; i <= 300; i++ {
+		address, err = ipam.Allocate(fmt.Sprintf("worker-%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if address != "10.0.1.44" {
+		t.Errorf("expected address 10.0.1.44 for the 300th node, got %s", address)
+	}
+}
+
+func TestIPAMExhausted(t *testing.T) {
+	ipam, err := NewIPAM("10.0.1.0/30", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"master-01", "worker-01"} {
+		if _, err := ipam.Allocate(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if address, err := ipam.Allocate("worker-02"); err == nil {
+		t.Errorf("expected the network to be exhausted, got address %s", address)
+	}
+}
+
+func TestIPAMReserve(t *testing.T) {
+	ipam, err := NewIPAM("10.0.1.0/24", map[string]string{"master-01": "10.0.1.11"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := map[string]string{
+		"10.0.1.11":  "already allocated",
+		"10.0.1.0":   "network address",
+		"10.0.1.255": "broadcast address",
+		"10.0.2.1":   "outside of the network",
+		"bullshit":   "no address",
+	}
+
+	for address, reason := range invalid {
+		if err := ipam.Reserve("worker-01", address); err == nil {
+			t.Errorf("expected reserving %s to fail (%s)", address, reason)
+		}
+	}
+
+	if _, err := NewIPAM("10.0.1.0/24", map[string]string{"master-01": "10.0.2.1"}); err == nil {
+		t.Error("expected an allocation outside of the network to fail")
+	}
+}
+
+func TestNewClusterIPAM(t *testing.T) {
+	cluster := Cluster{
+		NodeCIDR: "10.0.1.0/24",
+		Nodes: []Node{
+			{Name: "master-01", PrivateIPAddress: "10.0.1.11"},
+			{Name: "worker-01", PrivateIPAddress: "10.0.1.21"},
+			{Name: "external", PrivateIPAddress: ""},
+		},
+		IPAllocations: map[string]string{"worker-01": "10.0.1.21"},
+	}
+
+	ipam, err := NewClusterIPAM(cluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	allocations := ipam.Allocations()
+	if len(allocations) != 2 || allocations["master-01"] != "10.0.1.11" || allocations["worker-01"] != "10.0.1.21" {
+		t.Errorf("unexpected allocations %v", allocations)
+	}
+}
@@ -0,0 +1,231 @@
+package clustermanager
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// keyRotationTimeout is the time the peers of a node have to complete a handshake with its new key
+const keyRotationTimeout = 5 * time.Minute
+
+// RotateNodeKeys replaces the wireguard key pair of a node while wireguard keeps running. The new public key is
+// added to all peers first, which moves the allowed IPs of the node from its old public key to the new one, before
+// the node switches to its new private key. Only the connections of this node are interrupted, until the first
+// handshakes with the new key completed. If presharedKeys is true, new preshared keys are generated for all
+// connections of the node. If a step fails, the old key is restored on the peers, and the saved keys are kept
+func (manager *Manager) RotateNodeKeys(node Node, presharedKeys bool) error {
+	keyPair, err := GenerateKeyPair()
+	if err != nil {
+		return err
+	}
+
+	rotated := node
+	rotated.WireGuardKeyPair = keyPair
+	peers := manager.wireguardPeers(node)
+
+	rotatedKeys := make(map[string]string)
+	if presharedKeys {
+		for _, peer := range peers {
+			key, err := GeneratePresharedKey()
+			if err != nil {
+				return err
+			}
+
+			rotatedKeys[peer.Name] = key
+		}
+	}
+
+	manager.eventService.AddEvent(node.Name, "add new key to peers")
+	errs := make([]error, len(peers))
+	var wg sync.WaitGroup
+	for i, peer := range peers {
+		wg.Add(1)
+		go func(i int, peer Node) {
+			defer wg.Done()
+			presharedKey, exists := rotatedKeys[peer.Name]
+			if !exists {
+				presharedKey = manager.wireGuard.PresharedKeys[PresharedKeyID(node.Name, peer.Name)]
+			}
+
+			keys := map[string]string{}
+			keyFile := ""
+			if presharedKey != "" {
+				keyFile = wireguardKeyFile("psk-" + node.Name)
+				keys[keyFile] = presharedKey
+			}
+
+			command := wireguardAddPeerCommand(peer, rotated, keyFile, manager.wireGuard) +
+				fmt.Sprintf(" && wg set wg0 peer %s remove", node.WireGuardKeyPair.Public)
+			errs[i] = manager.runWithKeyFiles(peer, keys, command)
+		}(i, peer)
+	}
+	wg.Wait()
+
+	updatedPeers := []Node{}
+	var addErr error
+	for i, peer := range peers {
+		if errs[i] == nil {
+			updatedPeers = append(updatedPeers, peer)
+		} else if addErr == nil {
+			addErr = fmt.Errorf("unable to add the new key of %s to %s: %v", node.Name, peer.Name, errs[i])
+		}
+	}
+
+	if addErr != nil {
+		return manager.restorePeers(node, rotated, updatedPeers, addErr)
+	}
+
+	manager.eventService.AddEvent(node.Name, "switch to new key")
+	keys := map[string]string{wireguardKeyFile("private-key"): keyPair.Private}
+	commands := []string{"wg set wg0 private-key " + wireguardKeyFile("private-key")}
+	for _, peer := range peers {
+		if key, exists := rotatedKeys[peer.Name]; exists {
+			keys[wireguardKeyFile("psk-"+peer.Name)] = key
+			commands = append(commands, fmt.Sprintf("wg set wg0 peer %s preshared-key %s", peer.WireGuardKeyPair.Public, wireguardKeyFile("psk-"+peer.Name)))
+		}
+	}
+
+	if err := manager.runWithKeyFiles(node, keys, strings.Join(commands, " && ")); err != nil {
+		return manager.restorePeers(node, rotated, peers, fmt.Errorf("unable to switch %s to its new key: %v", node.Name, err))
+	}
+
+	manager.setPresharedKeys(node, rotatedKeys)
+	manager.ReplaceNode(rotated)
+
+	// the configuration files are only written to keep the live configuration across restarts
+	for _, configNode := range append(peers, rotated) {
+		conf := GenerateWireguardConf(configNode, manager.nodes, manager.wireGuard)
+		if err := manager.nodeCommunicator.WriteFile(configNode, "/etc/wireguard/wg0.conf", conf, OwnerRead); err != nil {
+			return err
+		}
+	}
+
+	return manager.waitForRotatedKey(rotated, peers)
+}
+
+// restorePeers adds the old key of the node back to the peers which already use its rotated key, so the node, which
+// still uses its old key pair, reaches them again. The saved keys are not changed, so if a peer cannot be restored,
+// applying the saved configuration with 'cluster phase network-setup' restores the network
+func (manager *Manager) restorePeers(node Node, rotated Node, peers []Node, cause error) error {
+	manager.eventService.AddEvent(node.Name, "restore old key on peers")
+	failed := []string{}
+	for _, peer := range peers {
+		keys := map[string]string{}
+		keyFile := ""
+		if presharedKey := manager.wireGuard.PresharedKeys[PresharedKeyID(node.Name, peer.Name)]; presharedKey != "" {
+			keyFile = wireguardKeyFile("psk-" + node.Name)
+			keys[keyFile] = presharedKey
+		}
+
+		command := wireguardAddPeerCommand(peer, node, keyFile, manager.wireGuard) +
+			fmt.Sprintf(" && wg set wg0 peer %s remove", rotated.WireGuardKeyPair.Public)
+		if err := manager.runWithKeyFiles(peer, keys, command); err != nil {
+			failed = append(failed, peer.Name)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%v, and the old key of %s could not be restored on %s. Run 'hetzner-kube cluster phase network-setup' to apply the saved keys again",
+			cause, node.Name, strings.Join(failed, ", "))
+	}
+
+	return fmt.Errorf("%v, the old key of %s was restored on all peers", cause, node.Name)
+}
+
+// waitForRotatedKey waits until all peers completed a handshake with the new key of the node. As wireguard only
+// handshakes on traffic, the node is pinged before
+func (manager *Manager) waitForRotatedKey(node Node, peers []Node) error {
+	manager.eventService.AddEvent(node.Name, "wait for wireguard handshakes")
+	for _, peer := range peers {
+		err := waitUntil(keyRotationTimeout, func() bool {
+			manager.nodeCommunicator.RunCmd(peer, fmt.Sprintf("ping -c 1 -W 2 %s > /dev/null; true", node.PrivateIPAddress))
+			out, err := manager.nodeCommunicator.RunCmd(peer, "wg show wg0 latest-handshakes")
+			if err != nil {
+				return false
+			}
+
+			handshake := parseWireguardHandshakes(out)[node.WireGuardKeyPair.Public]
+			return !handshake.IsZero() && time.Since(handshake) < staleHandshakeAge
+		})
+		if err != nil {
+			return fmt.Errorf("no handshake between %s and %s with the new key: %v", peer.Name, node.Name, err)
+		}
+	}
+
+	manager.eventService.AddEvent(node.Name, "wireguard key rotated")
+	return nil
+}
+
+// wireguardPeers returns all nodes except the given one
+func (manager *Manager) wireguardPeers(node Node) []Node {
+	peers := []Node{}
+	for _, peer := range manager.nodes {
+		if peer.Name != node.Name {
+			peers = append(peers, peer)
+		}
+	}
+
+	return peers
+}
+
+// setPresharedKeys replaces the preshared keys of the connections between the node and the given peers
+func (manager *Manager) setPresharedKeys(node Node, keys map[string]string) {
+	presharedKeys := make(map[string]string)
+	for id, key := range manager.wireGuard.PresharedKeys {
+		presharedKeys[id] = key
+	}
+
+	for peerName, key := range keys {
+		presharedKeys[PresharedKeyID(node.Name, peerName)] = key
+	}
+
+	manager.wireGuard.PresharedKeys = presharedKeys
+}
+
+// wireguardAddPeerCommand returns the command adding or updating a peer in the running wireguard interface of the
+// node. Allowed IPs already assigned to another peer are moved to this one. The preshared key is read from the given
+// file, if there is one
+func wireguardAddPeerCommand(node Node, peer Node, presharedKeyFile string, settings WireGuardSettings) string {
+	command := fmt.Sprintf("wg set wg0 peer %s", peer.WireGuardKeyPair.Public)
+	if presharedKeyFile != "" {
+		command += " preshared-key " + presharedKeyFile
+	}
+
+	command += fmt.Sprintf(" endpoint %s allowed-ips %s", wireguardEndpoint(node, peer, settings), strings.Join(wireguardAllowedIPs(peer), ","))
+	if keepalive := wireguardKeepalive(node, settings); keepalive > 0 {
+		command += fmt.Sprintf(" persistent-keepalive %d", keepalive)
+	}
+
+	return command
+}
+
+// wireguardKeyFile returns the path of a file a key is passed to wg in, as wg only reads keys from files
+func wireguardKeyFile(name string) string {
+	return "/etc/wireguard/" + name + ".key"
+}
+
+// runWithKeyFiles writes keys to files only readable by root and runs a command reading them, so the keys never show
+// up on a command line. The files are removed afterwards, also if the command fails
+func (manager *Manager) runWithKeyFiles(node Node, keys map[string]string, command string) error {
+	files := []string{}
+	for file := range keys {
+		files = append(files, file)
+	}
+	removeCommand := "rm -f " + strings.Join(files, " ")
+
+	for file, key := range keys {
+		if err := manager.nodeCommunicator.WriteFile(node, file, key, OwnerRead); err != nil {
+			manager.nodeCommunicator.RunCmd(node, removeCommand)
+			return err
+		}
+	}
+
+	if len(files) > 0 {
+		command = fmt.Sprintf("trap '%s' EXIT; %s", removeCommand, command)
+	}
+
+	_, err := manager.nodeCommunicator.RunCmd(node, command)
+	return err
+}
@@ -0,0 +1,42 @@
+package clustermanager
+
+import "testing"
+
+func TestWireguardAddPeerCommand(t *testing.T) {
+	node := Node{Name: "node1", IPAddress: "1.1.1.1"}
+	peer := Node{Name: "node2", IPAddress: "1.1.1.2", PrivateIPAddress: "10.0.1.2", WireGuardKeyPair: WgKeyPair{Public: "node2pub"}}
+
+	command := wireguardAddPeerCommand(node, peer, "", WireGuardSettings{})
+	expected := "wg set wg0 peer node2pub endpoint 1.1.1.2:51820 allowed-ips 10.0.1.2/32"
+	if command != expected {
+		t.Errorf("unexpected add peer command\nexpected: %s\ngot: %s", expected, command)
+	}
+
+	peer.PrivateIPv6Address = "fd00::a00:102"
+	command = wireguardAddPeerCommand(node, peer, "/etc/wireguard/psk-node2.key", WireGuardSettings{})
+	expected = "wg set wg0 peer node2pub preshared-key /etc/wireguard/psk-node2.key endpoint 1.1.1.2:51820 allowed-ips 10.0.1.2/32,fd00::a00:102/128"
+	if command != expected {
+		t.Errorf("unexpected add peer command with preshared key\nexpected: %s\ngot: %s", expected, command)
+	}
+}
+
+func TestPresharedKeyID(t *testing.T) {
+	if PresharedKeyID("worker-01", "master-01") != PresharedKeyID("master-01", "worker-01") {
+		t.Error("expected the preshared key id to be independent of the order of the nodes")
+	}
+}
+
+func TestSetPresharedKeys(t *testing.T) {
+	manager := &Manager{wireGuard: WireGuardSettings{PresharedKeys: map[string]string{"master-01/worker-01": "old", "master-01/worker-02": "other"}}}
+	settings := manager.wireGuard
+
+	manager.setPresharedKeys(Node{Name: "worker-01"}, map[string]string{"master-01": "new"})
+
+	if manager.wireGuard.PresharedKeys["master-01/worker-01"] != "new" || manager.wireGuard.PresharedKeys["master-01/worker-02"] != "other" {
+		t.Errorf("unexpected preshared keys %v", manager.wireGuard.PresharedKeys)
+	}
+
+	if settings.PresharedKeys["master-01/worker-01"] != "old" {
+		t.Error("expected the previous settings to be left unchanged")
+	}
+}
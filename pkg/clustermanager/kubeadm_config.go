@@ -0,0 +1,266 @@
+package clustermanager
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// kubeadmAPIVersionV1beta2 is the kubeadm configuration API of kubernetes 1.15 to 1.21
+	kubeadmAPIVersionV1beta2 = "kubeadm.k8s.io/v1beta2"
+	// kubeadmAPIVersionV1beta3 is the kubeadm configuration API since kubernetes 1.22
+	kubeadmAPIVersionV1beta3 = "kubeadm.k8s.io/v1beta3"
+	// kubeletAPIVersion is the API version of the kubelet configuration
+	kubeletAPIVersion = "kubelet.config.k8s.io/v1beta1"
+	// DefaultKubernetesVersion is the kubernetes version of new clusters and of clusters created before the version
+	// was configurable
+	DefaultKubernetesVersion = "1.19.2"
+	// minKubernetesMinorVersion is the oldest supported minor version of kubernetes
+	minKubernetesMinorVersion = 19
+	// dockershimRemovedMinorVersion is the minor version of kubernetes which removed dockershim
+	dockershimRemovedMinorVersion = 24
+)
+
+// kubernetesVersionPattern matches kubernetes versions like 1.19.2, which are installed as packages version 1.19.2-00
+var kubernetesVersionPattern = regexp.MustCompile(`^1\.[0-9]+\.[0-9]+$`)
+
+// controlPlaneEndpoint is the address of the load balancer running on every node of HA clusters, which all
+// components reach the api servers with
+const controlPlaneEndpoint = "127.0.0.1:16443"
+
+// kubeadmClusterConfiguration is the cluster wide configuration of kubeadm
+type kubeadmClusterConfiguration struct {
+	APIVersion           string            `yaml:"apiVersion"`
+	Kind                 string            `yaml:"kind"`
+	KubernetesVersion    string            `yaml:"kubernetesVersion"`
+	ControlPlaneEndpoint string            `yaml:"controlPlaneEndpoint,omitempty"`
+	Networking           kubeadmNetworking `yaml:"networking"`
+	FeatureGates         map[string]bool   `yaml:"featureGates,omitempty"`
+	APIServer            kubeadmAPIServer  `yaml:"apiServer"`
+	Etcd                 *kubeadmEtcd      `yaml:"etcd,omitempty"`
+}
+
+// kubeadmNetworking contains the service and pod networks of the cluster
+type kubeadmNetworking struct {
+	ServiceSubnet string `yaml:"serviceSubnet"`
+	PodSubnet     string `yaml:"podSubnet"`
+	DNSDomain     string `yaml:"dnsDomain"`
+}
+
+// kubeadmAPIServer contains the settings of the api servers
+type kubeadmAPIServer struct {
+	ExtraArgs    map[string]string      `yaml:"extraArgs,omitempty"`
+	ExtraVolumes []kubeadmHostPathMount `yaml:"extraVolumes,omitempty"`
+	CertSANs     []string               `yaml:"certSANs"`
+}
+
+// kubeadmHostPathMount is a directory of a master mounted into a control plane pod
+type kubeadmHostPathMount struct {
+	Name      string `yaml:"name"`
+	HostPath  string `yaml:"hostPath"`
+	MountPath string `yaml:"mountPath"`
+	ReadOnly  bool   `yaml:"readOnly"`
+	PathType  string `yaml:"pathType"`
+}
+
+// kubeadmEtcd configures the external etcd cluster of HA clusters
+type kubeadmEtcd struct {
+	External kubeadmExternalEtcd `yaml:"external"`
+}
+
+// kubeadmExternalEtcd contains the endpoints of an external etcd cluster
+type kubeadmExternalEtcd struct {
+	Endpoints []string `yaml:"endpoints"`
+}
+
+// kubeadmInitConfiguration is the configuration of the master running 'kubeadm init'
+type kubeadmInitConfiguration struct {
+	APIVersion       string                  `yaml:"apiVersion"`
+	Kind             string                  `yaml:"kind"`
+	LocalAPIEndpoint kubeadmAPIEndpoint      `yaml:"localAPIEndpoint"`
+	NodeRegistration kubeadmNodeRegistration `yaml:"nodeRegistration"`
+}
+
+// kubeadmJoinConfiguration is the configuration of a node running 'kubeadm join'
+type kubeadmJoinConfiguration struct {
+	APIVersion       string                   `yaml:"apiVersion"`
+	Kind             string                   `yaml:"kind"`
+	Discovery        kubeadmDiscovery         `yaml:"discovery"`
+	NodeRegistration kubeadmNodeRegistration  `yaml:"nodeRegistration"`
+	ControlPlane     *kubeadmJoinControlPlane `yaml:"controlPlane,omitempty"`
+}
+
+// kubeadmDiscovery configures how a joining node finds and trusts the cluster
+type kubeadmDiscovery struct {
+	BootstrapToken kubeadmBootstrapTokenDiscovery `yaml:"bootstrapToken"`
+}
+
+// kubeadmBootstrapTokenDiscovery discovers the cluster with a bootstrap token, and trusts the CA with the given hashes
+type kubeadmBootstrapTokenDiscovery struct {
+	APIServerEndpoint string   `yaml:"apiServerEndpoint"`
+	Token             string   `yaml:"token"`
+	CACertHashes      []string `yaml:"caCertHashes"`
+}
+
+// kubeadmJoinControlPlane makes a joining node a master
+type kubeadmJoinControlPlane struct {
+	LocalAPIEndpoint kubeadmAPIEndpoint `yaml:"localAPIEndpoint"`
+	CertificateKey   string             `yaml:"certificateKey,omitempty"`
+}
+
+// kubeadmAPIEndpoint is the address the api server of a master listens on
+type kubeadmAPIEndpoint struct {
+	AdvertiseAddress string `yaml:"advertiseAddress"`
+	BindPort         int    `yaml:"bindPort"`
+}
+
+// kubeadmNodeRegistration configures how a node is registered in the cluster
+type kubeadmNodeRegistration struct {
+	CRISocket string         `yaml:"criSocket,omitempty"`
+	Taints    []kubeadmTaint `yaml:"taints,omitempty"`
+}
+
+// kubeadmTaint is a taint of a node
+type kubeadmTaint struct {
+	Effect string `yaml:"effect"`
+	Key    string `yaml:"key"`
+}
+
+// kubeletConfiguration is the configuration of the kubelets, which kubeadm distributes to all nodes
+type kubeletConfiguration struct {
+	APIVersion   string          `yaml:"apiVersion"`
+	Kind         string          `yaml:"kind"`
+	FeatureGates map[string]bool `yaml:"featureGates,omitempty"`
+	CgroupDriver string          `yaml:"cgroupDriver,omitempty"`
+}
+
+// JoinParameters are the credentials a node joins the cluster with. Masters join the control plane, if
+// ControlPlane is set
+type JoinParameters struct {
+	APIServerEndpoint string
+	Token             string
+	CACertHash        string
+	ControlPlane      bool
+	CertificateKey    string
+}
+
+// KubeadmAPIVersion returns the kubeadm configuration API of a kubernetes version, which is v1beta3 since 1.22 and
+// v1beta2 before
+func KubeadmAPIVersion(kubernetesVersion string) string {
+	if kubernetesMinorVersion(kubernetesVersion) >= 22 {
+		return kubeadmAPIVersionV1beta3
+	}
+
+	return kubeadmAPIVersionV1beta2
+}
+
+// KubernetesVersionOrDefault returns the given kubernetes version, or the default version for clusters created
+// before the version was configurable
+func KubernetesVersionOrDefault(kubernetesVersion string) string {
+	if kubernetesVersion == "" {
+		return DefaultKubernetesVersion
+	}
+
+	return kubernetesVersion
+}
+
+// ValidateKubernetesVersion checks that a kubernetes version is supported and can run with the container runtime,
+// as docker cannot be used since dockershim was removed
+func ValidateKubernetesVersion(kubernetesVersion string, containerRuntime string) error {
+	if !kubernetesVersionPattern.MatchString(kubernetesVersion) {
+		return fmt.Errorf("invalid kubernetes version '%s', must be like %s", kubernetesVersion, DefaultKubernetesVersion)
+	}
+
+	minor := kubernetesMinorVersion(kubernetesVersion)
+	if minor < minKubernetesMinorVersion {
+		return fmt.Errorf("kubernetes version '%s' is not supported, must be at least 1.%d", kubernetesVersion, minKubernetesMinorVersion)
+	}
+
+	if minor >= dockershimRemovedMinorVersion && ContainerRuntimeOrDefault(containerRuntime) == ContainerRuntimeDocker {
+		return fmt.Errorf("kubernetes version '%s' cannot run with docker, use --container-runtime %s", kubernetesVersion, ContainerRuntimeContainerd)
+	}
+
+	return nil
+}
+
+// kubernetesMinorVersion returns the minor version of a kubernetes version like 1.19.2 or v1.19.2, or 0 if it
+// cannot be parsed
+func kubernetesMinorVersion(kubernetesVersion string) int {
+	parts := strings.Split(strings.TrimPrefix(kubernetesVersion, "v"), ".")
+	if len(parts) < 2 {
+		return 0
+	}
+
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0
+	}
+
+	return minor
+}
+
+// masterTaintKey returns the key of the taint keeping workloads off the masters, which is renamed in kubernetes 1.24
+func masterTaintKey(kubernetesVersion string) string {
+	if kubernetesMinorVersion(kubernetesVersion) >= 24 {
+		return "node-role.kubernetes.io/control-plane"
+	}
+
+	return "node-role.kubernetes.io/master"
+}
+
+// GenerateJoinConfiguration generates the kubeadm configuration of a node joining the cluster
+func GenerateJoinConfiguration(node Node, cluster Cluster, join JoinParameters) string {
+	joinConfig := kubeadmJoinConfiguration{
+		APIVersion: KubeadmAPIVersion(cluster.KubernetesVersion),
+		Kind:       "JoinConfiguration",
+		Discovery: kubeadmDiscovery{
+			BootstrapToken: kubeadmBootstrapTokenDiscovery{
+				APIServerEndpoint: join.APIServerEndpoint,
+				Token:             join.Token,
+				CACertHashes:      []string{join.CACertHash},
+			},
+		},
+		NodeRegistration: kubeadmNodeRegistration{
+			CRISocket: CRISocket(cluster.ContainerRuntime),
+		},
+	}
+
+	if join.ControlPlane {
+		joinConfig.NodeRegistration.Taints = []kubeadmTaint{{Effect: "NoSchedule", Key: masterTaintKey(cluster.KubernetesVersion)}}
+		joinConfig.ControlPlane = &kubeadmJoinControlPlane{
+			LocalAPIEndpoint: kubeadmAPIEndpoint{AdvertiseAddress: node.PrivateIPAddress, BindPort: 6443},
+			CertificateKey:   join.CertificateKey,
+		}
+	}
+
+	return marshalKubeadmDocuments(joinConfig)
+}
+
+// generateCertificateKey creates a random key, which the certificates of the control plane are encrypted with while
+// they are shared with joining masters
+func generateCertificateKey() (string, error) {
+	var key [32]byte
+	if _, err := rand.Reader.Read(key[:]); err != nil {
+		return "", fmt.Errorf("unable to generate a certificate key: %v", err)
+	}
+
+	return hex.EncodeToString(key[:]), nil
+}
+
+// marshalKubeadmDocuments renders configuration documents as one multi-document YAML file
+func marshalKubeadmDocuments(documents ...interface{}) string {
+	rendered := []string{}
+	for _, document := range documents {
+		// the documents only consist of strings, numbers, lists and maps, which are always marshalled
+		out, _ := yaml.Marshal(document)
+		rendered = append(rendered, string(out))
+	}
+
+	return strings.Join(rendered, "---\n")
+}
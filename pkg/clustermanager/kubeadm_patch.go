@@ -0,0 +1,400 @@
+package clustermanager
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// kubeadmPatchKinds are the documents of the kubeadm configuration which can be patched, with the API version of
+// documents which are added by a patch. The kubeadm documents have no fixed version, as it depends on the kubernetes
+// version
+var kubeadmPatchKinds = map[string]string{
+	"ClusterConfiguration":   "",
+	"InitConfiguration":      "",
+	"KubeletConfiguration":   kubeletAPIVersion,
+	"KubeProxyConfiguration": "kubeproxy.config.k8s.io/v1alpha1",
+}
+
+// kubeadmPatchAPIVersion returns the API version of a document of the kind which is added by a patch
+func kubeadmPatchAPIVersion(kind string, kubernetesVersion string) string {
+	if apiVersion := kubeadmPatchKinds[kind]; apiVersion != "" {
+		return apiVersion
+	}
+
+	return KubeadmAPIVersion(kubernetesVersion)
+}
+
+// JSONPatchOperation is an operation of a JSON patch (RFC 6902). The operations add, remove, replace and test are
+// supported
+type JSONPatchOperation struct {
+	Op    string      `yaml:"op"`
+	Path  string      `yaml:"path"`
+	Value interface{} `yaml:"value"`
+}
+
+// KubeadmPatch changes a document of the generated kubeadm configuration, either with a merge patch or a JSON patch
+type KubeadmPatch struct {
+	Kind string
+	// APIVersion is used if the document is added by the patch
+	APIVersion string
+	// Merge is merged into the document, maps and lists are merged recursively and null values remove fields
+	Merge map[interface{}]interface{}
+	// JSONPatch is applied to the document, if it is given
+	JSONPatch []JSONPatchOperation
+}
+
+// ParseKubeadmPatches parses the YAML documents of a patch file. A document is a merge patch of the document of the
+// same kind, or a JSON patch if it contains the operations in 'jsonPatch':
+//
+//	kind: ClusterConfiguration
+//	jsonPatch:
+//	  - op: add
+//	    path: /apiServer/certSANs/-
+//	    value: k8s.example.com
+func ParseKubeadmPatches(content string) ([]KubeadmPatch, error) {
+	patches := []KubeadmPatch{}
+	decoder := yaml.NewDecoder(strings.NewReader(content))
+	for {
+		document := map[interface{}]interface{}{}
+		err := decoder.Decode(&document)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse kubeadm patch: %v", err)
+		}
+
+		if len(document) == 0 {
+			continue
+		}
+
+		kind, _ := document["kind"].(string)
+		if _, ok := kubeadmPatchKinds[kind]; !ok {
+			return nil, fmt.Errorf("unsupported kubeadm patch kind '%s', must be one of %s", kind, strings.Join(kubeadmPatchKindNames(), ", "))
+		}
+
+		apiVersion, _ := document["apiVersion"].(string)
+		delete(document, "apiVersion")
+		patch := KubeadmPatch{Kind: kind, APIVersion: apiVersion}
+		if operations, ok := document["jsonPatch"]; ok {
+			if len(document) != 2 {
+				return nil, fmt.Errorf("JSON patch of %s must only contain kind and jsonPatch", kind)
+			}
+
+			out, _ := yaml.Marshal(operations)
+			if err := yaml.UnmarshalStrict(out, &patch.JSONPatch); err != nil {
+				return nil, fmt.Errorf("invalid JSON patch of %s: %v", kind, err)
+			}
+
+			for _, operation := range patch.JSONPatch {
+				if err := validateJSONPatchOperation(operation); err != nil {
+					return nil, fmt.Errorf("invalid JSON patch of %s: %v", kind, err)
+				}
+			}
+		} else {
+			patch.Merge = document
+		}
+
+		patches = append(patches, patch)
+	}
+
+	return patches, nil
+}
+
+// ValidateKubeadmPatches checks that the patches of a patch file can be parsed and applied to all masters. Only the
+// first master runs 'kubeadm init', the other masters of HA clusters join with a JoinConfiguration, so patches of the
+// InitConfiguration would be ignored on them
+func ValidateKubeadmPatches(content string, haEnabled bool) error {
+	patches, err := ParseKubeadmPatches(content)
+	if err != nil {
+		return err
+	}
+
+	for _, patch := range patches {
+		if haEnabled && patch.Kind == "InitConfiguration" {
+			return errors.New("InitConfiguration cannot be patched in HA clusters, as it is only used by the first master")
+		}
+	}
+
+	return nil
+}
+
+// kubeadmPatchKindNames returns the sorted kinds of documents which can be patched
+func kubeadmPatchKindNames() []string {
+	kinds := []string{}
+	for kind := range kubeadmPatchKinds {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	return kinds
+}
+
+// ApplyKubeadmPatches applies the patches of a patch file to the documents of a kubeadm configuration. Patched
+// documents are rendered again, all others are kept as they are. A merge patch of a document which is not part of
+// the configuration adds it, with the API version of the patch or the one of its kind for the kubernetes version
+func ApplyKubeadmPatches(config string, content string, kubernetesVersion string) (string, error) {
+	patches, err := ParseKubeadmPatches(content)
+	if err != nil || len(patches) == 0 {
+		return config, err
+	}
+
+	documents := strings.Split(strings.TrimSuffix(config, "\n"), "\n---\n")
+	parsed := make([]map[interface{}]interface{}, len(documents))
+	patched := make([]bool, len(documents))
+	for i, document := range documents {
+		if err := yaml.Unmarshal([]byte(document), &parsed[i]); err != nil {
+			return "", fmt.Errorf("unable to parse kubeadm configuration: %v", err)
+		}
+	}
+
+	for _, patch := range patches {
+		index := -1
+		for i, document := range parsed {
+			if document["kind"] == patch.Kind {
+				index = i
+				break
+			}
+		}
+
+		if index == -1 {
+			if patch.JSONPatch != nil {
+				return "", fmt.Errorf("unable to apply JSON patch, the kubeadm configuration contains no %s", patch.Kind)
+			}
+
+			apiVersion := patch.APIVersion
+			if apiVersion == "" {
+				apiVersion = kubeadmPatchAPIVersion(patch.Kind, kubernetesVersion)
+			}
+
+			documents = append(documents, "")
+			parsed = append(parsed, map[interface{}]interface{}{"apiVersion": apiVersion, "kind": patch.Kind})
+			patched = append(patched, true)
+			index = len(parsed) - 1
+		}
+
+		var document interface{} = parsed[index]
+		if patch.JSONPatch != nil {
+			for _, operation := range patch.JSONPatch {
+				document, err = applyJSONPatchOperation(document, jsonPointerTokens(operation.Path), operation)
+				if err != nil {
+					return "", fmt.Errorf("unable to apply JSON patch to %s at '%s': %v", patch.Kind, operation.Path, err)
+				}
+			}
+		} else {
+			document = mergePatch(document, patch.Merge)
+		}
+
+		patchedDocument, ok := document.(map[interface{}]interface{})
+		if !ok {
+			return "", fmt.Errorf("patched %s is no longer a map", patch.Kind)
+		}
+		parsed[index] = patchedDocument
+		patched[index] = true
+	}
+
+	for i := range documents {
+		if !patched[i] {
+			continue
+		}
+
+		out, err := yaml.Marshal(parsed[i])
+		if err != nil {
+			return "", err
+		}
+		documents[i] = strings.TrimSuffix(string(out), "\n")
+	}
+
+	return strings.Join(documents, "\n---\n") + "\n", nil
+}
+
+// validateJSONPatchOperation checks that an operation is supported and has a valid path
+func validateJSONPatchOperation(operation JSONPatchOperation) error {
+	switch operation.Op {
+	case "add", "remove", "replace", "test":
+	default:
+		return fmt.Errorf("unsupported operation '%s', must be add, remove, replace or test", operation.Op)
+	}
+
+	if !strings.HasPrefix(operation.Path, "/") {
+		return fmt.Errorf("path '%s' must start with /", operation.Path)
+	}
+
+	return nil
+}
+
+// jsonPointerTokens splits a JSON pointer (RFC 6901) into its unescaped reference tokens
+func jsonPointerTokens(pointer string) []string {
+	tokens := strings.Split(strings.TrimPrefix(pointer, "/"), "/")
+	for i, token := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+
+	return tokens
+}
+
+// applyJSONPatchOperation applies an operation to the value at the path of the reference tokens, and returns the
+// changed value
+func applyJSONPatchOperation(value interface{}, tokens []string, operation JSONPatchOperation) (interface{}, error) {
+	token := tokens[0]
+	last := len(tokens) == 1
+
+	switch typed := value.(type) {
+	case map[interface{}]interface{}:
+		child, exists := typed[token]
+		if !last {
+			if !exists {
+				return nil, fmt.Errorf("field '%s' does not exist", token)
+			}
+
+			changed, err := applyJSONPatchOperation(child, tokens[1:], operation)
+			if err != nil {
+				return nil, err
+			}
+
+			typed[token] = changed
+			return typed, nil
+		}
+
+		if !exists && operation.Op != "add" {
+			return nil, fmt.Errorf("field '%s' does not exist", token)
+		}
+
+		switch operation.Op {
+		case "add", "replace":
+			typed[token] = operation.Value
+		case "remove":
+			delete(typed, token)
+		case "test":
+			if !jsonPatchValuesEqual(child, operation.Value) {
+				return nil, fmt.Errorf("field '%s' is %v, not %v", token, child, operation.Value)
+			}
+		}
+
+		return typed, nil
+	case []interface{}:
+		index := len(typed)
+		if token != "-" || !last || operation.Op != "add" {
+			var err error
+			index, err = strconv.Atoi(token)
+			if err != nil || index < 0 || index > len(typed) || (index == len(typed) && operation.Op != "add") {
+				return nil, fmt.Errorf("invalid index '%s'", token)
+			}
+		}
+
+		if !last {
+			changed, err := applyJSONPatchOperation(typed[index], tokens[1:], operation)
+			if err != nil {
+				return nil, err
+			}
+
+			typed[index] = changed
+			return typed, nil
+		}
+
+		switch operation.Op {
+		case "add":
+			typed = append(typed, nil)
+			copy(typed[index+1:], typed[index:])
+			typed[index] = operation.Value
+		case "replace":
+			typed[index] = operation.Value
+		case "remove":
+			typed = append(typed[:index], typed[index+1:]...)
+		case "test":
+			if !jsonPatchValuesEqual(typed[index], operation.Value) {
+				return nil, fmt.Errorf("item %d is %v, not %v", index, typed[index], operation.Value)
+			}
+		}
+
+		return typed, nil
+	default:
+		return nil, fmt.Errorf("'%s' is neither a field nor an item", token)
+	}
+}
+
+// jsonPatchValuesEqual compares two values by their YAML representation, so numbers of different types are equal
+func jsonPatchValuesEqual(a interface{}, b interface{}) bool {
+	if reflect.DeepEqual(a, b) {
+		return true
+	}
+
+	outA, errA := yaml.Marshal(a)
+	outB, errB := yaml.Marshal(b)
+
+	return errA == nil && errB == nil && bytes.Equal(outA, outB)
+}
+
+// mergePatch merges a patch into a value. Maps are merged recursively, null values remove fields, lists are merged
+// with mergeList and all other values replace the existing ones
+func mergePatch(value interface{}, patch interface{}) interface{} {
+	if patchList, ok := patch.([]interface{}); ok {
+		if valueList, ok := value.([]interface{}); ok {
+			return mergeList(valueList, patchList)
+		}
+
+		return patch
+	}
+
+	patchMap, ok := patch.(map[interface{}]interface{})
+	if !ok {
+		return patch
+	}
+
+	valueMap, ok := value.(map[interface{}]interface{})
+	if !ok {
+		valueMap = map[interface{}]interface{}{}
+	}
+
+	for key, patchValue := range patchMap {
+		if patchValue == nil {
+			delete(valueMap, key)
+			continue
+		}
+
+		valueMap[key] = mergePatch(valueMap[key], patchValue)
+	}
+
+	return valueMap
+}
+
+// mergeList merges the items of a patch into a list, so generated items like cert SANs or extra volumes are kept.
+// Maps are merged into the item with the same name, all other items are appended unless the list contains them
+// already. Items can only be removed with a JSON patch
+func mergeList(list []interface{}, patch []interface{}) []interface{} {
+	for _, patchItem := range patch {
+		index := -1
+		for i, item := range list {
+			if jsonPatchValuesEqual(item, patchItem) || (listItemName(item) != nil && listItemName(item) == listItemName(patchItem)) {
+				index = i
+				break
+			}
+		}
+
+		if index == -1 {
+			list = append(list, patchItem)
+		} else {
+			list[index] = mergePatch(list[index], patchItem)
+		}
+	}
+
+	return list
+}
+
+// listItemName returns the name of a list item which is a map, or nil
+func listItemName(item interface{}) interface{} {
+	itemMap, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return nil
+	}
+
+	return itemMap["name"]
+}
@@ -0,0 +1,221 @@
+package clustermanager
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func generatedTestConfig() string {
+	nodes := []Node{
+		{Name: "node1", IPAddress: "1.1.1.1", PrivateIPAddress: "10.0.0.1"},
+	}
+
+	return GenerateMasterConfiguration(nodes[0], nodes, nil, Cluster{KubernetesVersion: "1.19.2"})
+}
+
+// kubeadmDocument returns the parsed document of a kind of a kubeadm configuration
+func kubeadmDocument(t *testing.T, config string, kind string) map[interface{}]interface{} {
+	for _, document := range strings.Split(config, "\n---\n") {
+		parsed := map[interface{}]interface{}{}
+		if err := yaml.Unmarshal([]byte(document), &parsed); err != nil {
+			t.Fatal(err)
+		}
+
+		if parsed["kind"] == kind {
+			return parsed
+		}
+	}
+
+	t.Fatalf("configuration contains no %s\n%s", kind, config)
+	return nil
+}
+
+func TestApplyKubeadmPatchesWithoutPatches(t *testing.T) {
+	config := generatedTestConfig()
+	patched, err := ApplyKubeadmPatches(config, "", "1.19.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if patched != config {
+		t.Errorf("configuration changed without patches\n%s", patched)
+	}
+}
+
+func TestApplyKubeadmMergePatch(t *testing.T) {
+	patches := `kind: ClusterConfiguration
+networking:
+  dnsDomain: null
+apiServer:
+  extraArgs:
+    default-not-ready-toleration-seconds: "60"
+  certSANs:
+    - 127.0.0.1
+    - k8s.example.com
+  extraVolumes:
+    - name: audit-log
+      readOnly: true
+---
+kind: KubeProxyConfiguration
+mode: ipvs
+`
+	nodes := []Node{
+		{Name: "node1", IPAddress: "1.1.1.1", PrivateIPAddress: "10.0.0.1"},
+	}
+	config := GenerateMasterConfiguration(nodes[0], nodes, nil, Cluster{KubernetesVersion: "1.19.2", Audit: AuditSettings{Enabled: true}})
+	generatedAPIServer := kubeadmDocument(t, config, "ClusterConfiguration")["apiServer"].(map[interface{}]interface{})
+	generatedSANs := generatedAPIServer["certSANs"].([]interface{})
+	generatedVolumes := generatedAPIServer["extraVolumes"].([]interface{})
+
+	patched, err := ApplyKubeadmPatches(config, patches, "1.19.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clusterConfig := kubeadmDocument(t, patched, "ClusterConfiguration")
+	networking := clusterConfig["networking"].(map[interface{}]interface{})
+	if _, ok := networking["dnsDomain"]; ok {
+		t.Errorf("expected the DNS domain to be removed, got %v", networking)
+	}
+
+	apiServer := clusterConfig["apiServer"].(map[interface{}]interface{})
+
+	if apiServer["extraArgs"].(map[interface{}]interface{})["default-not-ready-toleration-seconds"] != "60" {
+		t.Errorf("expected the extra argument to be added, got %v", apiServer)
+	}
+
+	// lists are merged, so the generated cert SANs are kept and existing ones are not added twice
+	sans := apiServer["certSANs"].([]interface{})
+	if len(sans) != len(generatedSANs)+1 || sans[len(sans)-1] != "k8s.example.com" {
+		t.Errorf("expected k8s.example.com to be added to the generated cert SANs %v, got %v", generatedSANs, sans)
+	}
+
+	// items of lists of maps are merged by their name
+	volumes := apiServer["extraVolumes"].([]interface{})
+	volume := volumes[1].(map[interface{}]interface{})
+	if len(volumes) != len(generatedVolumes) || volume["name"] != "audit-log" || volume["hostPath"] != auditLogDir || volume["readOnly"] != true {
+		t.Errorf("expected the audit-log volume to be merged, got %v", volumes)
+	}
+
+	kubeProxy := kubeadmDocument(t, patched, "KubeProxyConfiguration")
+	if kubeProxy["apiVersion"] != "kubeproxy.config.k8s.io/v1alpha1" || kubeProxy["mode"] != "ipvs" {
+		t.Errorf("expected a kube-proxy configuration with ipvs, got %v", kubeProxy)
+	}
+
+	// documents without patches are kept as they are
+	initConfig := strings.Split(config, "\n---\n")[1]
+	if !strings.Contains(patched, initConfig) {
+		t.Errorf("init configuration changed\n%s", patched)
+	}
+}
+
+func TestApplyKubeadmPatchAddsDocumentsOfKubernetesVersion(t *testing.T) {
+	config := "apiVersion: kubelet.config.k8s.io/v1beta1\nkind: KubeletConfiguration\n"
+	patches := "kind: ClusterConfiguration\nnetworking:\n  dnsDomain: example.local\n"
+
+	for kubernetesVersion, apiVersion := range map[string]string{"1.19.2": kubeadmAPIVersionV1beta2, "1.24.3": kubeadmAPIVersionV1beta3} {
+		patched, err := ApplyKubeadmPatches(config, patches, kubernetesVersion)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if clusterConfig := kubeadmDocument(t, patched, "ClusterConfiguration"); clusterConfig["apiVersion"] != apiVersion {
+			t.Errorf("expected added ClusterConfiguration of kubernetes %s to be %s, got %v", kubernetesVersion, apiVersion, clusterConfig["apiVersion"])
+		}
+	}
+}
+
+func TestApplyKubeadmJSONPatch(t *testing.T) {
+	patches := `kind: ClusterConfiguration
+jsonPatch:
+  - op: test
+    path: /apiServer/certSANs/0
+    value: 127.0.0.1
+  - op: add
+    path: /apiServer/certSANs/-
+    value: k8s.example.com
+  - op: replace
+    path: /networking/dnsDomain
+    value: example.local
+---
+kind: KubeletConfiguration
+jsonPatch:
+  - op: add
+    path: /featureGates
+    value:
+      GracefulNodeShutdown: true
+`
+	patched, err := ApplyKubeadmPatches(generatedTestConfig(), patches, "1.19.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clusterConfig := kubeadmDocument(t, patched, "ClusterConfiguration")
+	sans := clusterConfig["apiServer"].(map[interface{}]interface{})["certSANs"].([]interface{})
+	if sans[len(sans)-1] != "k8s.example.com" {
+		t.Errorf("expected k8s.example.com to be appended to the cert SANs, got %v", sans)
+	}
+
+	if clusterConfig["networking"].(map[interface{}]interface{})["dnsDomain"] != "example.local" {
+		t.Errorf("expected the DNS domain to be replaced, got %v", clusterConfig["networking"])
+	}
+
+	featureGates := kubeadmDocument(t, patched, "KubeletConfiguration")["featureGates"].(map[interface{}]interface{})
+	if featureGates["GracefulNodeShutdown"] != true {
+		t.Errorf("expected the GracefulNodeShutdown feature gate to be added, got %v", featureGates)
+	}
+}
+
+func TestApplyKubeadmJSONPatchErrors(t *testing.T) {
+	tests := []string{
+		"kind: ClusterConfiguration\njsonPatch:\n  - op: replace\n    path: /scheduler/extraArgs\n    value: {}\n",
+		"kind: ClusterConfiguration\njsonPatch:\n  - op: test\n    path: /networking/dnsDomain\n    value: example.local\n",
+		"kind: ClusterConfiguration\njsonPatch:\n  - op: remove\n    path: /apiServer/certSANs/10\n",
+		"kind: KubeProxyConfiguration\njsonPatch:\n  - op: add\n    path: /mode\n    value: ipvs\n",
+	}
+
+	for _, patches := range tests {
+		if _, err := ApplyKubeadmPatches(generatedTestConfig(), patches, "1.19.2"); err == nil {
+			t.Errorf("expected patch to fail\n%s", patches)
+		}
+	}
+}
+
+func TestParseKubeadmPatchesErrors(t *testing.T) {
+	tests := []string{
+		"kind: Deployment\nspec: {}\n",
+		"networking:\n  dnsDomain: example.local\n",
+		"kind: ClusterConfiguration\njsonPatch:\n  - op: move\n    path: /networking\n",
+		"kind: ClusterConfiguration\njsonPatch:\n  - op: remove\n    path: networking\n",
+		"kind: ClusterConfiguration\njsonPatch: []\nnetworking: {}\n",
+		"kind: [",
+	}
+
+	for _, patches := range tests {
+		if _, err := ParseKubeadmPatches(patches); err == nil {
+			t.Errorf("expected patch to be invalid\n%s", patches)
+		}
+	}
+}
+
+func TestValidateKubeadmPatches(t *testing.T) {
+	patches := "kind: InitConfiguration\nnodeRegistration:\n  kubeletExtraArgs:\n    max-pods: \"200\"\n---\nkind: ClusterConfiguration\nnetworking: {}\n"
+
+	if err := ValidateKubeadmPatches(patches, false); err != nil {
+		t.Errorf("expected InitConfiguration patches to be valid without HA, got %v", err)
+	}
+
+	if err := ValidateKubeadmPatches(patches, true); err == nil {
+		t.Error("expected InitConfiguration patches to be rejected in HA clusters")
+	}
+
+	if err := ValidateKubeadmPatches("kind: ClusterConfiguration\nnetworking: {}\n", true); err != nil {
+		t.Errorf("expected ClusterConfiguration patches to be valid in HA clusters, got %v", err)
+	}
+
+	if err := ValidateKubeadmPatches("kind: Deployment\n", false); err == nil {
+		t.Error("expected patches of unsupported kinds to be invalid")
+	}
+}
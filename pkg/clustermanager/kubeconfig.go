@@ -0,0 +1,155 @@
+package clustermanager
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+)
+
+// KubeConfigEntry is a named cluster, user or context of a kubeconfig. All fields besides the name are kept as they
+// are, so entries not managed by hetzner-kube survive a merge
+type KubeConfigEntry struct {
+	Name   string                 `yaml:"name"`
+	Fields map[string]interface{} `yaml:",inline"`
+}
+
+// KubeConfig is a kubeconfig file, as used by kubectl
+type KubeConfig struct {
+	APIVersion     string                 `yaml:"apiVersion"`
+	Kind           string                 `yaml:"kind"`
+	Clusters       []KubeConfigEntry      `yaml:"clusters"`
+	Contexts       []KubeConfigEntry      `yaml:"contexts"`
+	Users          []KubeConfigEntry      `yaml:"users"`
+	CurrentContext string                 `yaml:"current-context"`
+	Extra          map[string]interface{} `yaml:",inline"`
+}
+
+// ParseKubeConfig parses the content of a kubeconfig file. An empty content results in an empty kubeconfig
+func ParseKubeConfig(content string) (KubeConfig, error) {
+	config := KubeConfig{APIVersion: "v1", Kind: "Config"}
+	if err := yaml.Unmarshal([]byte(content), &config); err != nil {
+		return KubeConfig{}, fmt.Errorf("unable to parse kubeconfig: %v", err)
+	}
+
+	return config, nil
+}
+
+// MarshalKubeConfig renders a kubeconfig as YAML
+func MarshalKubeConfig(config KubeConfig) (string, error) {
+	out, err := yaml.Marshal(config)
+	if err != nil {
+		return "", fmt.Errorf("unable to render kubeconfig: %v", err)
+	}
+
+	return string(out), nil
+}
+
+// RenameKubeConfig renames the cluster, user and context of a kubeconfig created by kubeadm to the given name, which
+// are called kubernetes, kubernetes-admin and kubernetes-admin@kubernetes in every cluster otherwise
+func RenameKubeConfig(config KubeConfig, name string) KubeConfig {
+	renamed := config
+	renamed.Clusters = renameEntries(config.Clusters, name)
+	renamed.Users = renameEntries(config.Users, name)
+	renamed.Contexts = renameEntries(config.Contexts, name)
+	for _, context := range renamed.Contexts {
+		if fields, ok := context.Fields["context"].(map[interface{}]interface{}); ok {
+			fields["cluster"] = name
+			fields["user"] = name
+		}
+	}
+	renamed.CurrentContext = name
+
+	return renamed
+}
+
+// SetKubeConfigServer points all clusters of a kubeconfig to the given server. The kubeconfig of kubeadm contains the
+// private IP of the master, or the local load balancer in HA clusters, which are not reachable from outside
+func SetKubeConfigServer(config KubeConfig, server string) KubeConfig {
+	for _, cluster := range config.Clusters {
+		if fields, ok := cluster.Fields["cluster"].(map[interface{}]interface{}); ok {
+			fields["server"] = server
+		}
+	}
+
+	return config
+}
+
+// MergeKubeConfig adds the clusters, users and contexts of a kubeconfig to an existing one, replacing entries with
+// the same name. The current context is switched if requested, or if the existing kubeconfig has none
+func MergeKubeConfig(existing KubeConfig, config KubeConfig, setCurrent bool) KubeConfig {
+	merged := existing
+	merged.Clusters = mergeEntries(existing.Clusters, config.Clusters)
+	merged.Users = mergeEntries(existing.Users, config.Users)
+	merged.Contexts = mergeEntries(existing.Contexts, config.Contexts)
+	if setCurrent || merged.CurrentContext == "" {
+		merged.CurrentContext = config.CurrentContext
+	}
+
+	return merged
+}
+
+// RemoveFromKubeConfig removes the cluster, user and context with the given name. The current context is unset, if
+// it is the removed one
+func RemoveFromKubeConfig(config KubeConfig, name string) KubeConfig {
+	removed := config
+	removed.Clusters = removeEntry(config.Clusters, name)
+	removed.Users = removeEntry(config.Users, name)
+	removed.Contexts = removeEntry(config.Contexts, name)
+	if removed.CurrentContext == name {
+		removed.CurrentContext = ""
+	}
+
+	return removed
+}
+
+// HasKubeConfigEntry checks if the kubeconfig contains a cluster, user or context with the given name
+func HasKubeConfigEntry(config KubeConfig, name string) bool {
+	for _, entries := range [][]KubeConfigEntry{config.Clusters, config.Users, config.Contexts} {
+		for _, entry := range entries {
+			if entry.Name == name {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func renameEntries(entries []KubeConfigEntry, name string) []KubeConfigEntry {
+	renamed := []KubeConfigEntry{}
+	for _, entry := range entries {
+		renamed = append(renamed, KubeConfigEntry{Name: name, Fields: entry.Fields})
+	}
+
+	return renamed
+}
+
+func mergeEntries(existing []KubeConfigEntry, entries []KubeConfigEntry) []KubeConfigEntry {
+	merged := append([]KubeConfigEntry{}, existing...)
+	for _, entry := range entries {
+		replaced := false
+		for i := range merged {
+			if merged[i].Name == entry.Name {
+				merged[i] = entry
+				replaced = true
+			}
+		}
+
+		if !replaced {
+			merged = append(merged, entry)
+		}
+	}
+
+	return merged
+}
+
+func removeEntry(entries []KubeConfigEntry, name string) []KubeConfigEntry {
+	remaining := []KubeConfigEntry{}
+	for _, entry := range entries {
+		if entry.Name != name {
+			remaining = append(remaining, entry)
+		}
+	}
+
+	return remaining
+}
@@ -0,0 +1,141 @@
+package clustermanager
+
+import (
+	"strings"
+	"testing"
+)
+
+const adminConf = `apiVersion: v1
+clusters:
+- cluster:
+    certificate-authority-data: Y2E=
+    server: https://1.1.1.1:6443
+  name: kubernetes
+contexts:
+- context:
+    cluster: kubernetes
+    user: kubernetes-admin
+  name: kubernetes-admin@kubernetes
+current-context: kubernetes-admin@kubernetes
+kind: Config
+preferences: {}
+users:
+- name: kubernetes-admin
+  user:
+    client-certificate-data: Y2VydA==
+    client-key-data: a2V5
+`
+
+const existingConf = `apiVersion: v1
+clusters:
+- cluster:
+    server: https://example.com
+  name: other
+contexts:
+- context:
+    cluster: other
+    namespace: dev
+    user: other
+  name: other
+current-context: other
+kind: Config
+preferences:
+  colors: true
+users:
+- name: other
+  user:
+    exec:
+      command: login-helper
+`
+
+func TestSetKubeConfigServer(t *testing.T) {
+	// the admin.conf of HA clusters points to the load balancer on the master
+	haAdminConf := strings.Replace(adminConf, "https://1.1.1.1:6443", "https://127.0.0.1:16443", 1)
+	tests := []string{adminConf, strings.Replace(adminConf, "1.1.1.1", "10.0.1.1", 1), haAdminConf}
+
+	for _, content := range tests {
+		config, err := ParseKubeConfig(content)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		out, err := MarshalKubeConfig(SetKubeConfigServer(config, "https://2.2.2.2:6443"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.Contains(out, "    server: https://2.2.2.2:6443\n") || strings.Count(out, "server:") != 1 {
+			t.Errorf("expected the server to be https://2.2.2.2:6443\n%s", out)
+		}
+	}
+}
+
+func TestMergeKubeConfig(t *testing.T) {
+	config, err := ParseKubeConfig(adminConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	existing, err := ParseKubeConfig(existingConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	merged := MergeKubeConfig(existing, RenameKubeConfig(config, "my-cluster"), false)
+	if merged.CurrentContext != "other" {
+		t.Errorf("expected the current context to be kept, got %s", merged.CurrentContext)
+	}
+
+	if len(merged.Clusters) != 2 || len(merged.Users) != 2 || len(merged.Contexts) != 2 {
+		t.Fatalf("expected two clusters, users and contexts, got %+v", merged)
+	}
+
+	out, err := MarshalKubeConfig(merged)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, part := range []string{"name: my-cluster", "cluster: my-cluster", "user: my-cluster", "command: login-helper", "namespace: dev", "colors: true", "client-key-data: a2V5"} {
+		if !strings.Contains(out, part) {
+			t.Errorf("merged kubeconfig does not contain %q:\n%s", part, out)
+		}
+	}
+
+	if strings.Contains(out, "kubernetes-admin") {
+		t.Errorf("merged kubeconfig still contains the kubeadm names:\n%s", out)
+	}
+
+	// merging again replaces the entries of the cluster
+	merged = MergeKubeConfig(merged, RenameKubeConfig(config, "my-cluster"), true)
+	if len(merged.Clusters) != 2 || merged.CurrentContext != "my-cluster" {
+		t.Errorf("expected the cluster to be replaced and the current context to be set, got %+v", merged)
+	}
+}
+
+func TestMergeKubeConfigIntoEmptyConfig(t *testing.T) {
+	config, _ := ParseKubeConfig(adminConf)
+	existing, err := ParseKubeConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	merged := MergeKubeConfig(existing, RenameKubeConfig(config, "my-cluster"), false)
+	if merged.CurrentContext != "my-cluster" || merged.APIVersion != "v1" || merged.Kind != "Config" {
+		t.Errorf("expected a complete kubeconfig using the cluster, got %+v", merged)
+	}
+}
+
+func TestRemoveFromKubeConfig(t *testing.T) {
+	config, _ := ParseKubeConfig(adminConf)
+	existing, _ := ParseKubeConfig(existingConf)
+	merged := MergeKubeConfig(existing, RenameKubeConfig(config, "my-cluster"), true)
+
+	removed := RemoveFromKubeConfig(merged, "my-cluster")
+	if HasKubeConfigEntry(removed, "my-cluster") {
+		t.Errorf("expected all entries of the cluster to be removed, got %+v", removed)
+	}
+
+	if !HasKubeConfigEntry(removed, "other") || removed.CurrentContext != "" {
+		t.Errorf("expected the other entries to be kept and the current context to be unset, got %+v", removed)
+	}
+}
@@ -0,0 +1,193 @@
+package clustermanager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+const (
+	// loadBalancerImage is the image of the client based master load balancer
+	loadBalancerImage = "docker.io/library/haproxy:2.4-alpine"
+	// loadBalancerConfigDir is the directory of the HAProxy configuration on all nodes of HA clusters
+	loadBalancerConfigDir = "/etc/kubernetes/master-lb"
+	// loadBalancerManifest is the static pod of the load balancer on the masters. All components of a master reach the
+	// api servers through it, so it must never be moved aside like the manifests in restartControlPlaneCommand. kubeadm
+	// reset removes it, so it is deployed again after every reset of a master which stays in the cluster
+	loadBalancerManifest = "/etc/kubernetes/manifests/master-lb.yaml"
+)
+
+// removeLoadBalancerServiceCommand removes the systemd service and container of the load balancer, which the masters
+// ran before the load balancer became a static pod. Every step runs even if the previous one fails, as the service or
+// the container may be gone already
+const removeLoadBalancerServiceCommand = "systemctl disable --now master-lb > /dev/null 2>&1; " +
+	"rm -f /etc/systemd/system/master-lb.service; systemctl daemon-reload; docker rm -f master-lb > /dev/null 2>&1; true"
+
+// GenerateLoadBalancerConfig generates the HAProxy configuration of the master load balancer. It listens on the
+// control plane endpoint and forwards to the api servers of the masters, which are only used while their health
+// check succeeds
+func GenerateLoadBalancerConfig(masterIPs []string) string {
+	configTpl := `global
+  log stdout format raw local0 notice
+  maxconn 4000
+
+defaults
+  mode tcp
+  log global
+  option tcplog
+  timeout connect 5s
+  timeout client 1h
+  timeout server 1h
+  default-server inter 5s fall 2 rise 2
+
+frontend kube-apiserver
+  bind %s
+  default_backend kube-apiserver
+
+backend kube-apiserver
+  balance roundrobin
+  option httpchk GET /healthz
+  http-check expect status 200
+%s`
+
+	servers := ""
+	for i, ip := range masterIPs {
+		servers += fmt.Sprintf("  server master%d %s:6443 check check-ssl verify none\n", i+1, ip)
+	}
+
+	return fmt.Sprintf(configTpl, controlPlaneEndpoint, servers)
+}
+
+// GenerateLoadBalancerStaticPod generates the static pod running the load balancer on a master. The kubelet starts it
+// together with the control plane, and replaces it whenever the hash of the configuration changes
+func GenerateLoadBalancerStaticPod(config string) string {
+	podTpl := `apiVersion: v1
+kind: Pod
+metadata:
+  name: master-lb
+  namespace: kube-system
+  labels:
+    component: master-lb
+    tier: control-plane
+  annotations:
+    hetzner-kube/config-hash: %s
+spec:
+  hostNetwork: true
+  priorityClassName: system-node-critical
+  containers:
+  - name: haproxy
+    image: %s
+    volumeMounts:
+    - name: config
+      mountPath: /usr/local/etc/haproxy
+      readOnly: true
+  volumes:
+  - name: config
+    hostPath:
+      path: %s
+      type: Directory
+`
+
+	hash := sha256.Sum256([]byte(config))
+
+	return fmt.Sprintf(podTpl, hex.EncodeToString(hash[:8]), loadBalancerImage, loadBalancerConfigDir)
+}
+
+// GenerateLoadBalancerSystemdService generates the systemd service running the load balancer on a worker with the
+// container runtime of the cluster, as it must be up before the kubelet can join the cluster
+func GenerateLoadBalancerSystemdService(containerRuntime string) string {
+	serviceTpl := `[Unit]
+Description=kubernetes master load balancer
+After=%[1]s.service
+Requires=%[1]s.service
+
+[Service]
+%[2]sRestart=always
+RestartSec=5
+
+[Install]
+WantedBy=multi-user.target
+`
+
+	commands := fmt.Sprintf(`ExecStartPre=-/usr/bin/docker rm -f master-lb
+ExecStartPre=/usr/bin/docker pull %[1]s
+ExecStart=/usr/bin/docker run --rm --name=master-lb --net=host -v %[2]s:/usr/local/etc/haproxy:ro %[1]s
+ExecStop=/usr/bin/docker stop master-lb
+`, loadBalancerImage, loadBalancerConfigDir)
+
+	if containerRuntime == ContainerRuntimeContainerd {
+		commands = fmt.Sprintf(`ExecStartPre=-/usr/bin/ctr -n hetzner-kube task kill -s SIGKILL master-lb
+ExecStartPre=-/usr/bin/ctr -n hetzner-kube container rm master-lb
+ExecStartPre=/usr/bin/ctr -n hetzner-kube image pull %[1]s
+ExecStart=/usr/bin/ctr -n hetzner-kube run --rm --net-host --mount type=bind,src=%[2]s,dst=/usr/local/etc/haproxy,options=rbind:ro %[1]s master-lb
+`, loadBalancerImage, loadBalancerConfigDir)
+	}
+
+	return fmt.Sprintf(serviceTpl, ContainerRuntimeOrDefault(containerRuntime), commands)
+}
+
+// DeployLoadBalancer renders the load balancer configuration of the current masters, and (re)starts the load balancer
+// on the given nodes with it. Etcd nodes are skipped, as they do not run kubernetes
+func (manager *Manager) DeployLoadBalancer(nodes []Node) error {
+	config := GenerateLoadBalancerConfig(manager.masterPrivateIPs())
+
+	errChan := make(chan error)
+	trueChan := make(chan bool)
+	numProcs := 0
+	for _, node := range nodes {
+		if !node.IsMaster && node.IsEtcd {
+			continue
+		}
+		numProcs++
+		go func(node Node) {
+			manager.eventService.AddEvent(node.Name, "deploy load balancer")
+			if err := manager.deployLoadBalancerOnNode(node, config); err != nil {
+				errChan <- err
+				return
+			}
+
+			trueChan <- true
+		}(node)
+	}
+
+	return waitOrError(trueChan, errChan, &numProcs)
+}
+
+// masterPrivateIPs returns the IPs of the masters in the wireguard network, which the load balancers forward to
+func (manager *Manager) masterPrivateIPs() []string {
+	masterIPs := []string{}
+	for _, node := range manager.clusterProvider.GetMasterNodes() {
+		masterIPs = append(masterIPs, node.PrivateIPAddress)
+	}
+
+	return masterIPs
+}
+
+// deployLoadBalancerOnNode places the load balancer configuration on a node. Masters run the load balancer as static
+// pod, all other nodes as systemd service, which is restarted to read the configuration again
+func (manager *Manager) deployLoadBalancerOnNode(node Node, config string) error {
+	_, err := manager.nodeCommunicator.RunCmd(node, "mkdir -p "+loadBalancerConfigDir+" /etc/kubernetes/manifests")
+	if err != nil {
+		return err
+	}
+
+	if err := manager.nodeCommunicator.WriteFile(node, loadBalancerConfigDir+"/haproxy.cfg", config, AllRead); err != nil {
+		return err
+	}
+
+	if node.IsMaster {
+		if _, err := manager.nodeCommunicator.RunCmd(node, removeLoadBalancerServiceCommand); err != nil {
+			return err
+		}
+
+		return manager.nodeCommunicator.WriteFile(node, loadBalancerManifest, GenerateLoadBalancerStaticPod(config), OwnerRead)
+	}
+
+	err = manager.nodeCommunicator.WriteFile(node, "/etc/systemd/system/master-lb.service", GenerateLoadBalancerSystemdService(manager.containerRuntime), AllRead)
+	if err != nil {
+		return err
+	}
+
+	_, err = manager.nodeCommunicator.RunCmd(node, "systemctl daemon-reload && systemctl enable master-lb && systemctl restart master-lb")
+	return err
+}
@@ -0,0 +1,92 @@
+package clustermanager
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/andreyvit/diff"
+)
+
+func TestGenerateLoadBalancerConfig(t *testing.T) {
+	expectedConfig := `global
+  log stdout format raw local0 notice
+  maxconn 4000
+
+defaults
+  mode tcp
+  log global
+  option tcplog
+  timeout connect 5s
+  timeout client 1h
+  timeout server 1h
+  default-server inter 5s fall 2 rise 2
+
+frontend kube-apiserver
+  bind 127.0.0.1:16443
+  default_backend kube-apiserver
+
+backend kube-apiserver
+  balance roundrobin
+  option httpchk GET /healthz
+  http-check expect status 200
+  server master1 10.0.1.11:6443 check check-ssl verify none
+  server master2 10.0.1.12:6443 check check-ssl verify none
+`
+
+	config := GenerateLoadBalancerConfig([]string{"10.0.1.11", "10.0.1.12"})
+	if config != expectedConfig {
+		t.Errorf("load balancer config does not match expected\n%s", diff.LineDiff(expectedConfig, config))
+	}
+}
+
+func TestGenerateLoadBalancerStaticPod(t *testing.T) {
+	pod := GenerateLoadBalancerStaticPod(GenerateLoadBalancerConfig([]string{"10.0.1.11", "10.0.1.12"}))
+
+	expectedParts := []string{
+		"  hostNetwork: true\n",
+		"    image: " + loadBalancerImage + "\n",
+		"      path: /etc/kubernetes/master-lb\n",
+	}
+
+	for _, part := range expectedParts {
+		if !strings.Contains(pod, part) {
+			t.Errorf("load balancer static pod does not contain %q\n%s", part, pod)
+		}
+	}
+
+	changedPod := GenerateLoadBalancerStaticPod(GenerateLoadBalancerConfig([]string{"10.0.1.11"}))
+	if pod == changedPod {
+		t.Errorf("load balancer static pod is not replaced when the masters change\n%s", pod)
+	}
+}
+
+func TestGenerateLoadBalancerSystemdService(t *testing.T) {
+	tests := []struct {
+		containerRuntime string
+		expectedParts    []string
+	}{
+		{
+			"",
+			[]string{
+				"After=docker.service\n",
+				"ExecStart=/usr/bin/docker run --rm --name=master-lb --net=host -v /etc/kubernetes/master-lb:/usr/local/etc/haproxy:ro " + loadBalancerImage + "\n",
+			},
+		},
+		{
+			ContainerRuntimeContainerd,
+			[]string{
+				"After=containerd.service\n",
+				"--mount type=bind,src=/etc/kubernetes/master-lb,dst=/usr/local/etc/haproxy,options=rbind:ro " + loadBalancerImage + " master-lb\n",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		service := GenerateLoadBalancerSystemdService(test.containerRuntime)
+		for _, part := range test.expectedParts {
+			if !strings.Contains(service, part) {
+				t.Errorf("load balancer service for %q does not contain %q\n%s", test.containerRuntime, part, service)
+			}
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package clustermanager
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+const (
+	// DefaultPodCIDR is the network the pod IPs are allocated from
+	DefaultPodCIDR = "10.244.0.0/16"
+	// DefaultServiceCIDR is the network the service IPs are allocated from
+	DefaultServiceCIDR = "10.96.0.0/12"
+	// DefaultDNSDomain is the DNS domain of the services in the cluster
+	DefaultDNSDomain = "cluster.local"
+
+	// DefaultNodeIPv6CIDR is the unique local network the IPv6 overlay addresses of the nodes are derived from
+	DefaultNodeIPv6CIDR = "fd00:10:0:1::/64"
+	// DefaultPodIPv6CIDR is the network the pod IPv6 addresses are allocated from in dual-stack clusters
+	DefaultPodIPv6CIDR = "fd00:10:244::/56"
+	// DefaultServiceIPv6CIDR is the network the service IPv6 addresses are allocated from in dual-stack clusters
+	DefaultServiceIPv6CIDR = "fd00:10:96::/112"
+)
+
+const (
+	// IPFamilyIPv4 clusters use IPv4 addresses only
+	IPFamilyIPv4 = "ipv4"
+	// IPFamilyDualStack clusters use IPv4 and IPv6 addresses for nodes, pods and services
+	IPFamilyDualStack = "dual-stack"
+	// IPFamilyIPv6 clusters would use IPv6 addresses only
+	IPFamilyIPv6 = "ipv6"
+)
+
+var dnsDomainPattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+
+// ValidateNetworks checks that the node, pod and service CIDRs are valid networks which do not overlap
+func ValidateNetworks(nodeCIDR string, podCIDR string, serviceCIDR string) error {
+	networks := []struct {
+		name string
+		cidr string
+	}{
+		{"node", nodeCIDR},
+		{"pod", podCIDR},
+		{"service", serviceCIDR},
+	}
+
+	parsed := make([]*net.IPNet, len(networks))
+	for i, network := range networks {
+		_, ipNet, err := net.ParseCIDR(network.cidr)
+		if err != nil {
+			return fmt.Errorf("could not parse %s cidr: %v", network.name, err)
+		}
+
+		parsed[i] = ipNet
+	}
+
+	for i := range networks {
+		for j := i + 1; j < len(networks); j++ {
+			if networksOverlap(parsed[i], parsed[j]) {
+				return fmt.Errorf("%s cidr %s overlaps with %s cidr %s", networks[i].name, networks[i].cidr, networks[j].name, networks[j].cidr)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ValidateIPv6Networks checks that the IPv6 node, pod and service CIDRs of a dual-stack cluster are valid IPv6
+// networks which do not overlap. The node network must be large enough to embed the IPv4 node addresses and the
+// service network must not exceed the limit of the api server
+func ValidateIPv6Networks(nodeCIDR string, podCIDR string, serviceCIDR string) error {
+	if err := ValidateNetworks(nodeCIDR, podCIDR, serviceCIDR); err != nil {
+		return err
+	}
+
+	for _, cidr := range []string{nodeCIDR, podCIDR, serviceCIDR} {
+		if _, network, _ := net.ParseCIDR(cidr); network.IP.To4() != nil {
+			return fmt.Errorf("%s is not an IPv6 network", cidr)
+		}
+	}
+
+	_, nodeNetwork, _ := net.ParseCIDR(nodeCIDR)
+	if ones, _ := nodeNetwork.Mask.Size(); ones > 96 {
+		return fmt.Errorf("node IPv6 cidr %s must be at least a /96", nodeCIDR)
+	}
+
+	_, serviceNetwork, _ := net.ParseCIDR(serviceCIDR)
+	if ones, _ := serviceNetwork.Mask.Size(); ones < 108 {
+		return fmt.Errorf("service IPv6 cidr %s must not be larger than a /108", serviceCIDR)
+	}
+
+	return nil
+}
+
+// ValidateIPFamily checks that clusters of the IP family can be created
+func ValidateIPFamily(ipFamily string) error {
+	switch ipFamily {
+	case "", IPFamilyIPv4, IPFamilyDualStack:
+		return nil
+	case IPFamilyIPv6:
+		// hcloud-go v1.16 has no option to create servers without a public IPv4 address
+		return errors.New("IPv6-only clusters are not supported yet, as servers cannot be created without a public IPv4 address. Use dual-stack instead")
+	}
+
+	return fmt.Errorf("unsupported IP family '%s', must be one of %s, %s", ipFamily, IPFamilyIPv4, IPFamilyDualStack)
+}
+
+// IsDualStack returns true, if the nodes, pods and services of the cluster have IPv6 addresses as well
+func IsDualStack(cluster Cluster) bool {
+	return cluster.IPFamily == IPFamilyDualStack
+}
+
+// OverlayIPv6Address derives the IPv6 overlay address of a node by embedding its IPv4 overlay address into the
+// last 32 bits of the IPv6 node network, so it is unique as long as the IPv4 address is
+func OverlayIPv6Address(nodeIPv6CIDR string, ipv4Address string) (string, error) {
+	_, network, err := net.ParseCIDR(nodeIPv6CIDR)
+	if err != nil || network.IP.To4() != nil {
+		return "", fmt.Errorf("unable to parse IPv6 cidr %q", nodeIPv6CIDR)
+	}
+
+	if ones, _ := network.Mask.Size(); ones > 96 {
+		return "", fmt.Errorf("IPv6 cidr %q is too small to embed IPv4 addresses", nodeIPv6CIDR)
+	}
+
+	ipv4 := net.ParseIP(ipv4Address).To4()
+	if ipv4 == nil {
+		return "", fmt.Errorf("unable to parse IPv4 address %q", ipv4Address)
+	}
+
+	address := make(net.IP, net.IPv6len)
+	copy(address, network.IP)
+	copy(address[12:], ipv4)
+
+	return address.String(), nil
+}
+
+// PodCIDRs returns the pod CIDR of the cluster, followed by the IPv6 pod CIDR for dual-stack clusters
+func PodCIDRs(cluster Cluster) string {
+	return dualStackCIDRs(PodCIDROrDefault(cluster.PodCIDR), PodIPv6CIDROrDefault(cluster.PodIPv6CIDR), IsDualStack(cluster))
+}
+
+// dualStackCIDRs returns the IPv4 CIDR, or both CIDRs separated by a comma for dual-stack clusters, as kubernetes
+// expects them
+func dualStackCIDRs(ipv4CIDR string, ipv6CIDR string, dualStack bool) string {
+	if !dualStack {
+		return ipv4CIDR
+	}
+
+	return strings.Join([]string{ipv4CIDR, ipv6CIDR}, ",")
+}
+
+// ValidateDNSDomain checks that the domain is a valid DNS name
+func ValidateDNSDomain(domain string) error {
+	if len(domain) > 253 || !dnsDomainPattern.MatchString(domain) {
+		return fmt.Errorf("invalid dns domain '%s'", domain)
+	}
+
+	return nil
+}
+
+// networksOverlap returns true, if one of the networks contains the other one
+func networksOverlap(a *net.IPNet, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+// PodCIDROrDefault returns the given pod CIDR, or the default one for clusters created
+// before it was configurable
+func PodCIDROrDefault(podCIDR string) string {
+	if podCIDR == "" {
+		return DefaultPodCIDR
+	}
+
+	return podCIDR
+}
+
+// ServiceCIDROrDefault returns the given service CIDR, or the default one for clusters created
+// before it was configurable
+func ServiceCIDROrDefault(serviceCIDR string) string {
+	if serviceCIDR == "" {
+		return DefaultServiceCIDR
+	}
+
+	return serviceCIDR
+}
+
+// DNSDomainOrDefault returns the given DNS domain, or the default one for clusters created
+// before it was configurable
+func DNSDomainOrDefault(dnsDomain string) string {
+	if dnsDomain == "" {
+		return DefaultDNSDomain
+	}
+
+	return dnsDomain
+}
+
+// PodIPv6CIDROrDefault returns the given IPv6 pod CIDR, or the default one for clusters created
+// before it was configurable
+func PodIPv6CIDROrDefault(podIPv6CIDR string) string {
+	if podIPv6CIDR == "" {
+		return DefaultPodIPv6CIDR
+	}
+
+	return podIPv6CIDR
+}
+
+// ServiceIPv6CIDROrDefault returns the given IPv6 service CIDR, or the default one for clusters created
+// before it was configurable
+func ServiceIPv6CIDROrDefault(serviceIPv6CIDR string) string {
+	if serviceIPv6CIDR == "" {
+		return DefaultServiceIPv6CIDR
+	}
+
+	return serviceIPv6CIDR
+}
@@ -0,0 +1,374 @@
+package clustermanager
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WireguardPeerState is a peer of a running wireguard interface, as reported by 'wg show <interface> dump'
+type WireguardPeerState struct {
+	PublicKey       string
+	PresharedKey    string
+	Endpoint        string
+	AllowedIPs      []string
+	LatestHandshake time.Time
+}
+
+// WireguardInterfaceState is a running wireguard interface, as reported by 'wg show <interface> dump'
+type WireguardInterfaceState struct {
+	PublicKey  string
+	ListenPort int
+	Peers      map[string]WireguardPeerState
+}
+
+// NetworkReport is the result of the diagnostics of the encrypted network
+type NetworkReport struct {
+	Results []CheckResult `json:"checks"`
+	// Connectivity contains the result of pinging the private IP address of every peer, by source and target node.
+	// Nodes which could not be checked are missing
+	Connectivity map[string]map[string]bool `json:"connectivity"`
+}
+
+// NetworkChecker diagnoses the wireguard mesh of a cluster by comparing the running interfaces with the stored nodes
+type NetworkChecker struct {
+	nodeCommunicator NodeCommunicator
+	cluster          Cluster
+}
+
+// NewNetworkChecker creates a NetworkChecker instance
+func NewNetworkChecker(nodeCommunicator NodeCommunicator, cluster Cluster) *NetworkChecker {
+	return &NetworkChecker{
+		nodeCommunicator: nodeCommunicator,
+		cluster:          cluster,
+	}
+}
+
+// Run diagnoses all nodes in parallel
+func (checker *NetworkChecker) Run() NetworkReport {
+	nodes := checker.cluster.Nodes
+	results := make([][]CheckResult, len(nodes))
+	connectivity := make([]map[string]bool, len(nodes))
+
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, node Node) {
+			defer wg.Done()
+			results[i], connectivity[i] = checker.checkNode(node)
+		}(i, node)
+	}
+	wg.Wait()
+
+	report := NetworkReport{Results: []CheckResult{}, Connectivity: make(map[string]map[string]bool)}
+	for i, node := range nodes {
+		report.Results = append(report.Results, results[i]...)
+		if connectivity[i] != nil {
+			report.Connectivity[node.Name] = connectivity[i]
+		}
+	}
+
+	return report
+}
+
+// checkNode runs all diagnostics for a single node
+func (checker *NetworkChecker) checkNode(node Node) ([]CheckResult, map[string]bool) {
+	out, err := checker.nodeCommunicator.RunCmd(node, "wg show wg0 dump")
+	if err != nil {
+		return []CheckResult{{Node: node.Name, Check: "wireguard", Status: StatusCritical, Message: "wireguard interface wg0 is not up"}}, nil
+	}
+
+	results := checkWireguardState(node, checker.cluster.Nodes, parseWireguardDump(out), checker.cluster.WireGuard)
+	results = append(results, checker.checkConfigDrift(node), checker.checkOverlayRoute(node))
+
+	connectivity, err := checker.pingPeers(node)
+	if err != nil {
+		results = append(results, CheckResult{Node: node.Name, Check: "connectivity", Status: StatusCritical, Message: err.Error()})
+		return results, nil
+	}
+
+	results = append(results, checkConnectivity(node, checker.cluster.Nodes, connectivity))
+	return results, connectivity
+}
+
+// checkConfigDrift compares the configuration file of the node with the configuration rendered from the stored nodes
+func (checker *NetworkChecker) checkConfigDrift(node Node) CheckResult {
+	result := CheckResult{Node: node.Name, Check: "wireguard-config"}
+	out, err := checker.nodeCommunicator.RunCmd(node, "cat /etc/wireguard/wg0.conf")
+	if err != nil {
+		result.Status = StatusCritical
+		result.Message = "unable to read /etc/wireguard/wg0.conf"
+		return result
+	}
+
+	expected := GenerateWireguardConf(node, checker.cluster.Nodes, checker.cluster.WireGuard)
+	if strings.TrimSpace(out) != strings.TrimSpace(expected) {
+		result.Status = StatusWarning
+		result.Message = "wg0.conf differs from the stored cluster configuration"
+	} else {
+		result.Status = StatusOK
+		result.Message = "wg0.conf matches the stored cluster configuration"
+	}
+
+	return result
+}
+
+// checkOverlayRoute verifies that the pod networks are routed over wireguard, as set up by overlay-route.service
+func (checker *NetworkChecker) checkOverlayRoute(node Node) CheckResult {
+	result := CheckResult{Node: node.Name, Check: "overlay-route"}
+	missing := []string{}
+	cidrs := strings.Split(PodCIDRs(checker.cluster), ",")
+	for _, cidr := range cidrs {
+		ip := "ip"
+		if strings.Contains(cidr, ":") {
+			ip = "ip -6"
+		}
+
+		out, err := checker.nodeCommunicator.RunCmd(node, fmt.Sprintf("%s route show exact %s", ip, cidr))
+		if err != nil || !strings.Contains(out, "dev wg0") {
+			missing = append(missing, cidr)
+		}
+	}
+
+	if len(missing) > 0 {
+		result.Status = StatusCritical
+		result.Message = "no route over wg0 to " + strings.Join(missing, ", ") + ", check overlay-route.service"
+	} else {
+		result.Status = StatusOK
+		result.Message = strings.Join(cidrs, ", ") + " routed over wg0"
+	}
+
+	return result
+}
+
+// pingPeers pings the private IP address of every peer once and returns the result by peer name
+func (checker *NetworkChecker) pingPeers(node Node) (map[string]bool, error) {
+	addresses := []string{}
+	for _, peer := range checker.cluster.Nodes {
+		if peer.Name != node.Name {
+			addresses = append(addresses, peer.PrivateIPAddress)
+		}
+	}
+
+	if len(addresses) == 0 {
+		return map[string]bool{}, nil
+	}
+
+	out, err := checker.nodeCommunicator.RunCmd(node, fmt.Sprintf(
+		"for ip in %s; do if ping -c 1 -W 2 $ip > /dev/null 2>&1; then echo \"$ip ok\"; else echo \"$ip failed\"; fi; done",
+		strings.Join(addresses, " "),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	reachable := parsePingResults(out)
+	connectivity := make(map[string]bool)
+	for _, peer := range checker.cluster.Nodes {
+		if peer.Name != node.Name {
+			connectivity[peer.Name] = reachable[peer.PrivateIPAddress]
+		}
+	}
+
+	return connectivity, nil
+}
+
+// checkWireguardState compares the running interface of a node with the stored nodes. It reports a wrong interface
+// key or port, missing, unknown or misconfigured peers and missing or stale handshakes
+func checkWireguardState(node Node, nodes []Node, state WireguardInterfaceState, settings WireGuardSettings) []CheckResult {
+	interfaceResult := CheckResult{Node: node.Name, Check: "wireguard", Status: StatusOK, Message: "interface wg0 is up"}
+	switch {
+	case state.PublicKey != node.WireGuardKeyPair.Public:
+		interfaceResult.Status = StatusCritical
+		interfaceResult.Message = "the key of wg0 does not match the stored key of the node"
+	case state.ListenPort != settings.PortOrDefault():
+		interfaceResult.Status = StatusCritical
+		interfaceResult.Message = fmt.Sprintf("wg0 listens on port %d instead of %d", state.ListenPort, settings.PortOrDefault())
+	}
+
+	peersResult := CheckResult{Node: node.Name, Check: "wireguard-peers"}
+	handshakesResult := CheckResult{Node: node.Name, Check: "wireguard-handshakes"}
+	missing := []string{}
+	drifted := []string{}
+	noHandshake := []string{}
+	stale := []string{}
+	known := make(map[string]bool)
+	for _, peer := range nodes {
+		if peer.Name == node.Name {
+			continue
+		}
+
+		known[peer.WireGuardKeyPair.Public] = true
+		peerState, exists := state.Peers[peer.WireGuardKeyPair.Public]
+		if !exists {
+			missing = append(missing, peer.Name)
+			continue
+		}
+
+		// the endpoint of a peer changes, if it connects from another address, e.g. from behind a NAT
+		if !endpointMatches(peerState.Endpoint, wireguardEndpoint(node, peer, settings)) || !sameStrings(peerState.AllowedIPs, wireguardAllowedIPs(peer)) {
+			drifted = append(drifted, peer.Name)
+		}
+
+		if peerState.LatestHandshake.IsZero() {
+			noHandshake = append(noHandshake, peer.Name)
+		} else if time.Since(peerState.LatestHandshake) > staleHandshakeAge {
+			stale = append(stale, peer.Name)
+		}
+	}
+
+	unknown := []string{}
+	for publicKey := range state.Peers {
+		if !known[publicKey] {
+			unknown = append(unknown, publicKey)
+		}
+	}
+	sort.Strings(unknown)
+
+	switch {
+	case len(missing) > 0:
+		peersResult.Status = StatusCritical
+		peersResult.Message = "missing peers " + strings.Join(missing, ", ")
+	case len(drifted) > 0:
+		peersResult.Status = StatusWarning
+		peersResult.Message = "endpoint or allowed IPs differ for " + strings.Join(drifted, ", ")
+	case len(unknown) > 0:
+		peersResult.Status = StatusWarning
+		peersResult.Message = "unknown peers " + strings.Join(unknown, ", ")
+	default:
+		peersResult.Status = StatusOK
+		peersResult.Message = fmt.Sprintf("%d peers configured", len(state.Peers))
+	}
+
+	switch {
+	case len(noHandshake) > 0:
+		handshakesResult.Status = StatusCritical
+		handshakesResult.Message = "no handshake with " + strings.Join(noHandshake, ", ")
+	case len(stale) > 0:
+		handshakesResult.Status = StatusWarning
+		handshakesResult.Message = "stale handshake with " + strings.Join(stale, ", ")
+	default:
+		handshakesResult.Status = StatusOK
+		handshakesResult.Message = "recent handshakes with all peers"
+	}
+
+	return []CheckResult{interfaceResult, peersResult, handshakesResult}
+}
+
+// endpointMatches compares the endpoint of a running peer with the configured endpoint. wireguard resolves a host
+// name when the interface is set up and only reports the IP address, so only the port is compared for host names
+func endpointMatches(actual, expected string) bool {
+	host, port, err := net.SplitHostPort(expected)
+	if err != nil || net.ParseIP(host) != nil {
+		return actual == expected
+	}
+
+	_, actualPort, err := net.SplitHostPort(actual)
+	return err == nil && actualPort == port
+}
+
+// checkConnectivity summarizes the ping results of a node
+func checkConnectivity(node Node, nodes []Node, connectivity map[string]bool) CheckResult {
+	result := CheckResult{Node: node.Name, Check: "connectivity"}
+	unreachable := []string{}
+	for _, peer := range nodes {
+		if peer.Name != node.Name && !connectivity[peer.Name] {
+			unreachable = append(unreachable, peer.Name)
+		}
+	}
+
+	if len(unreachable) > 0 {
+		result.Status = StatusCritical
+		result.Message = "unable to ping " + strings.Join(unreachable, ", ")
+	} else {
+		result.Status = StatusOK
+		result.Message = fmt.Sprintf("all %d peers reachable", len(connectivity))
+	}
+
+	return result
+}
+
+// parseWireguardDump parses the output of 'wg show <interface> dump'. The first line describes the interface, every
+// further line a peer
+func parseWireguardDump(out string) WireguardInterfaceState {
+	state := WireguardInterfaceState{Peers: make(map[string]WireguardPeerState)}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	for i, line := range lines {
+		fields := strings.Split(line, "\t")
+		if i == 0 {
+			if len(fields) >= 3 {
+				state.PublicKey = fields[1]
+				state.ListenPort, _ = strconv.Atoi(fields[2])
+			}
+			continue
+		}
+
+		if len(fields) < 5 {
+			continue
+		}
+
+		peer := WireguardPeerState{
+			PublicKey:    fields[0],
+			PresharedKey: noneToEmpty(fields[1]),
+			Endpoint:     noneToEmpty(fields[2]),
+			AllowedIPs:   []string{},
+		}
+
+		if allowedIPs := noneToEmpty(fields[3]); allowedIPs != "" {
+			peer.AllowedIPs = strings.Split(allowedIPs, ",")
+		}
+
+		if timestamp, err := strconv.ParseInt(fields[4], 10, 64); err == nil && timestamp > 0 {
+			peer.LatestHandshake = time.Unix(timestamp, 0)
+		}
+
+		state.Peers[peer.PublicKey] = peer
+	}
+
+	return state
+}
+
+// parsePingResults parses the '<ip> ok|failed' lines of the ping loop and returns the reachability by IP address
+func parsePingResults(out string) map[string]bool {
+	reachable := make(map[string]bool)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 {
+			reachable[fields[0]] = fields[1] == "ok"
+		}
+	}
+
+	return reachable
+}
+
+// noneToEmpty returns an empty string for values wg reports as '(none)'
+func noneToEmpty(value string) string {
+	if value == "(none)" {
+		return ""
+	}
+
+	return value
+}
+
+// sameStrings returns true, if both slices contain the same strings in any order
+func sameStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	sortedA := append([]string{}, a...)
+	sortedB := append([]string{}, b...)
+	sort.Strings(sortedA)
+	sort.Strings(sortedB)
+	for i := range sortedA {
+		if sortedA[i] != sortedB[i] {
+			return false
+		}
+	}
+
+	return true
+}
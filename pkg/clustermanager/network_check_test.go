@@ -0,0 +1,103 @@
+package clustermanager
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseWireguardDump(t *testing.T) {
+	out := "node1priv\tnode1pub\t51820\toff\n" +
+		"node2pub\t(none)\t1.1.1.2:51820\t10.0.1.2/32\t1600000000\t100\t200\toff\n" +
+		"node3pub\tpsk\t(none)\t(none)\t0\t0\t0\toff\n"
+
+	state := parseWireguardDump(out)
+
+	if state.PublicKey != "node1pub" || state.ListenPort != 51820 {
+		t.Errorf("unexpected interface state %+v", state)
+	}
+
+	node2 := state.Peers["node2pub"]
+	if node2.Endpoint != "1.1.1.2:51820" || node2.PresharedKey != "" || len(node2.AllowedIPs) != 1 || node2.LatestHandshake != time.Unix(1600000000, 0) {
+		t.Errorf("unexpected peer state %+v", node2)
+	}
+
+	node3 := state.Peers["node3pub"]
+	if node3.Endpoint != "" || node3.PresharedKey != "psk" || len(node3.AllowedIPs) != 0 || !node3.LatestHandshake.IsZero() {
+		t.Errorf("unexpected peer state %+v", node3)
+	}
+}
+
+func TestCheckWireguardState(t *testing.T) {
+	nodes := []Node{
+		{Name: "node1", IPAddress: "1.1.1.1", PrivateIPAddress: "10.0.1.1", WireGuardKeyPair: WgKeyPair{Public: "node1pub"}},
+		{Name: "node2", IPAddress: "1.1.1.2", PrivateIPAddress: "10.0.1.2", WireGuardKeyPair: WgKeyPair{Public: "node2pub"}},
+		{Name: "node3", IPAddress: "1.1.1.3", PrivateIPAddress: "10.0.1.3", WireGuardKeyPair: WgKeyPair{Public: "node3pub"}},
+	}
+
+	now := time.Now().Unix()
+	healthy := fmt.Sprintf("node1priv\tnode1pub\t51820\toff\n"+
+		"node2pub\t(none)\t1.1.1.2:51820\t10.0.1.2/32\t%d\t0\t0\toff\n"+
+		"node3pub\t(none)\t1.1.1.3:51820\t10.0.1.3/32\t%d\t0\t0\toff\n", now, now)
+
+	for _, result := range checkWireguardState(nodes[0], nodes, parseWireguardDump(healthy), WireGuardSettings{}) {
+		if result.Status != StatusOK {
+			t.Errorf("expected check %s to pass, got %s: %s", result.Check, result.Status, result.Message)
+		}
+	}
+
+	broken := fmt.Sprintf("node1priv\tnode1pub\t51820\toff\n"+
+		"node2pub\t(none)\t9.9.9.9:4711\t10.0.1.2/32\t%d\t0\t0\toff\n"+
+		"oldpub\t(none)\t1.1.1.3:51820\t10.0.1.3/32\t0\t0\t0\toff\n", now-3600)
+
+	expected := map[string]string{
+		"wireguard":            string(StatusOK),
+		"wireguard-peers":      "missing peers node3",
+		"wireguard-handshakes": "stale handshake with node2",
+	}
+
+	for _, result := range checkWireguardState(nodes[0], nodes, parseWireguardDump(broken), WireGuardSettings{}) {
+		if result.Check == "wireguard" && string(result.Status) != expected[result.Check] {
+			t.Errorf("expected the interface check to pass, got %s: %s", result.Status, result.Message)
+		}
+
+		if result.Check != "wireguard" && result.Message != expected[result.Check] {
+			t.Errorf("expected check %s to report %q, got %q", result.Check, expected[result.Check], result.Message)
+		}
+	}
+
+	wrongKey := strings.Replace(healthy, "node1pub", "otherpub", 1)
+	if result := checkWireguardState(nodes[0], nodes, parseWireguardDump(wrongKey), WireGuardSettings{})[0]; result.Status != StatusCritical {
+		t.Errorf("expected a wrong interface key to be critical, got %s", result.Status)
+	}
+}
+
+func TestEndpointMatches(t *testing.T) {
+	tests := []struct {
+		actual   string
+		expected string
+		matches  bool
+	}{
+		{"1.1.1.2:51820", "1.1.1.2:51820", true},
+		{"9.9.9.9:51820", "1.1.1.2:51820", false},
+		{"[2001:db8::2]:51820", "[2001:db8::2]:51820", true},
+		{"1.1.1.2:51820", "node2.example.com:51820", true},
+		{"1.1.1.2:4711", "node2.example.com:51820", false},
+		{"", "node2.example.com:51820", false},
+	}
+
+	for _, test := range tests {
+		if matches := endpointMatches(test.actual, test.expected); matches != test.matches {
+			t.Errorf("expected endpointMatches(%q, %q) to be %v", test.actual, test.expected, test.matches)
+		}
+	}
+}
+
+func TestParsePingResults(t *testing.T) {
+	reachable := parsePingResults("10.0.1.2 ok\n10.0.1.3 failed\n")
+
+	if !reachable["10.0.1.2"] || reachable["10.0.1.3"] {
+		t.Errorf("unexpected ping results %v", reachable)
+	}
+}
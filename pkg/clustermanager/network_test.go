@@ -0,0 +1,91 @@
+package clustermanager
+
+import "testing"
+
+func TestValidateNetworks(t *testing.T) {
+	tests := []struct {
+		nodeCIDR    string
+		podCIDR     string
+		serviceCIDR string
+		valid       bool
+	}{
+		{"10.0.1.0/24", DefaultPodCIDR, DefaultServiceCIDR, true},
+		{"172.16.0.0/16", "10.32.0.0/12", "10.96.0.0/16", true},
+		{"10.0.1.0/24", "10.0.0.0/8", DefaultServiceCIDR, false},
+		{"10.0.1.0/24", DefaultPodCIDR, "10.244.128.0/20", false},
+		{"10.0.1.0/24", "bullshit", DefaultServiceCIDR, false},
+	}
+
+	for _, test := range tests {
+		err := ValidateNetworks(test.nodeCIDR, test.podCIDR, test.serviceCIDR)
+		if test.valid && err != nil {
+			t.Errorf("expected networks %s, %s, %s to be valid, got %v", test.nodeCIDR, test.podCIDR, test.serviceCIDR, err)
+		}
+
+		if !test.valid && err == nil {
+			t.Errorf("expected networks %s, %s, %s to be invalid", test.nodeCIDR, test.podCIDR, test.serviceCIDR)
+		}
+	}
+}
+
+func TestValidateDNSDomain(t *testing.T) {
+	for _, domain := range []string{"cluster.local", "k8s.example.com", "local"} {
+		if err := ValidateDNSDomain(domain); err != nil {
+			t.Errorf("expected domain '%s' to be valid, got %v", domain, err)
+		}
+	}
+
+	for _, domain := range []string{"", ".local", "cluster..local", "Cluster_Local", "-cluster.local"} {
+		if err := ValidateDNSDomain(domain); err == nil {
+			t.Errorf("expected domain '%s' to be invalid", domain)
+		}
+	}
+}
+
+func TestValidateIPv6Networks(t *testing.T) {
+	if err := ValidateIPv6Networks(DefaultNodeIPv6CIDR, DefaultPodIPv6CIDR, DefaultServiceIPv6CIDR); err != nil {
+		t.Errorf("expected the default IPv6 networks to be valid, got %v", err)
+	}
+
+	invalid := [][]string{
+		{"10.0.1.0/24", DefaultPodIPv6CIDR, DefaultServiceIPv6CIDR},
+		{"fd00:10:0:1::/112", DefaultPodIPv6CIDR, DefaultServiceIPv6CIDR},
+		{DefaultNodeIPv6CIDR, DefaultPodIPv6CIDR, "fd00:10:96::/64"},
+		{DefaultNodeIPv6CIDR, "fd00:10::/32", DefaultServiceIPv6CIDR},
+	}
+
+	for _, networks := range invalid {
+		if err := ValidateIPv6Networks(networks[0], networks[1], networks[2]); err == nil {
+			t.Errorf("expected IPv6 networks %v to be invalid", networks)
+		}
+	}
+}
+
+func TestValidateIPFamily(t *testing.T) {
+	for _, ipFamily := range []string{"", IPFamilyIPv4, IPFamilyDualStack} {
+		if err := ValidateIPFamily(ipFamily); err != nil {
+			t.Errorf("expected IP family '%s' to be valid, got %v", ipFamily, err)
+		}
+	}
+
+	for _, ipFamily := range []string{IPFamilyIPv6, "ipv5"} {
+		if err := ValidateIPFamily(ipFamily); err == nil {
+			t.Errorf("expected IP family '%s' to be invalid", ipFamily)
+		}
+	}
+}
+
+func TestOverlayIPv6Address(t *testing.T) {
+	address, err := OverlayIPv6Address(DefaultNodeIPv6CIDR, "10.0.1.21")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if address != "fd00:10:0:1::a00:115" {
+		t.Errorf("expected overlay address fd00:10:0:1::a00:115, got %s", address)
+	}
+
+	if _, err := OverlayIPv6Address("fd00:10:0:1::/120", "10.0.1.21"); err == nil {
+		t.Error("expected an error for a node network too small to embed IPv4 addresses")
+	}
+}
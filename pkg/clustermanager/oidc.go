@@ -0,0 +1,86 @@
+package clustermanager
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+// oidcCAPath is the path of the CA of the OIDC provider on the masters. The PKI directory is mounted into the api
+// server pod by kubeadm
+const oidcCAPath = "/etc/kubernetes/pki/oidc-ca.crt"
+
+// OIDCSettings configure the api server to authenticate users with the ID tokens of an OIDC provider
+type OIDCSettings struct {
+	IssuerURL     string `json:"issuer_url"`
+	ClientID      string `json:"client_id"`
+	UsernameClaim string `json:"username_claim"`
+	GroupsClaim   string `json:"groups_claim"`
+	// CA is the PEM encoded CA of the OIDC provider, if it is not signed by a CA trusted by the masters
+	CA string `json:"ca"`
+}
+
+// Enabled checks if OIDC authentication is configured
+func (settings OIDCSettings) Enabled() bool {
+	return settings.IssuerURL != ""
+}
+
+// ValidateOIDCSettings checks that the issuer is a https URL, which is required by the api server, and that a
+// client ID is given
+func ValidateOIDCSettings(settings OIDCSettings) error {
+	if !settings.Enabled() {
+		return nil
+	}
+
+	issuerURL, err := url.Parse(settings.IssuerURL)
+	if err != nil || issuerURL.Scheme != "https" || issuerURL.Host == "" {
+		return fmt.Errorf("invalid OIDC issuer URL '%s', must be a https URL", settings.IssuerURL)
+	}
+
+	if settings.ClientID == "" {
+		return errors.New("an OIDC client ID is required")
+	}
+
+	if settings.CA != "" {
+		if _, err := parseCertificate(settings.CA); err != nil {
+			return fmt.Errorf("invalid OIDC CA: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// OIDCAPIServerArgs returns the arguments of the api server for the OIDC settings. They are part of the api server
+// extra args of the kubeadm configuration
+func OIDCAPIServerArgs(settings OIDCSettings) [][2]string {
+	if !settings.Enabled() {
+		return nil
+	}
+
+	args := [][2]string{
+		{"oidc-issuer-url", settings.IssuerURL},
+		{"oidc-client-id", settings.ClientID},
+	}
+
+	if settings.UsernameClaim != "" {
+		args = append(args, [2]string{"oidc-username-claim", settings.UsernameClaim})
+	}
+
+	if settings.GroupsClaim != "" {
+		args = append(args, [2]string{"oidc-groups-claim", settings.GroupsClaim})
+	}
+
+	if settings.CA != "" {
+		args = append(args, [2]string{"oidc-ca-file", oidcCAPath})
+	}
+
+	return args
+}
+
+// ConfigureOIDC changes the OIDC settings of the api servers on one master after another. The settings are part of the
+// kubeadm configuration, so they are kept on upgrades and new masters
+func (manager *Manager) ConfigureOIDC(settings OIDCSettings) error {
+	manager.oidc = settings
+
+	return manager.UpdateControlPlane()
+}
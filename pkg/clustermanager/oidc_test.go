@@ -0,0 +1,22 @@
+package clustermanager
+
+import "testing"
+
+func TestValidateOIDCSettings(t *testing.T) {
+	tests := []struct {
+		settings OIDCSettings
+		valid    bool
+	}{
+		{OIDCSettings{}, true},
+		{OIDCSettings{IssuerURL: "https://accounts.example.com", ClientID: "kubernetes"}, true},
+		{OIDCSettings{IssuerURL: "http://accounts.example.com", ClientID: "kubernetes"}, false},
+		{OIDCSettings{IssuerURL: "https://accounts.example.com"}, false},
+		{OIDCSettings{IssuerURL: "https://accounts.example.com", ClientID: "kubernetes", CA: "no certificate"}, false},
+	}
+
+	for _, test := range tests {
+		if err := ValidateOIDCSettings(test.settings); (err == nil) != test.valid {
+			t.Errorf("settings %+v: expected valid=%v, got %v", test.settings, test.valid, err)
+		}
+	}
+}
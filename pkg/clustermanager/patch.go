@@ -0,0 +1,345 @@
+package clustermanager
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// heldPackages are kept at their installed version while patching, as they must only change with a cluster upgrade
+var heldPackages = []string{"kubelet", "kubeadm", "kubectl", "kubernetes-cni", "docker-ce", "docker-ce-cli", "containerd.io"}
+
+const patchTimeout = 10 * time.Minute
+
+// readyHeartbeatJSONPath prints status and last heartbeat time of the Ready condition of a node
+const readyHeartbeatJSONPath = `{range .status.conditions[?(@.type=="Ready")]}{.status}{"\t"}{.lastHeartbeatTime}{end}`
+
+var aptUpgradedPattern = regexp.MustCompile(`(\d+) upgraded`)
+
+// PatchResult is the outcome of patching a single node
+type PatchResult struct {
+	Node     string
+	Status   string
+	Upgraded int
+	Rebooted bool
+	Duration time.Duration
+	Err      error
+}
+
+const (
+	// PatchStatusPatched indicates a successfully patched node
+	PatchStatusPatched = "patched"
+	// PatchStatusFailed indicates a node which failed to patch
+	PatchStatusFailed = "failed"
+	// PatchStatusSkipped indicates a node which was not patched, as the rollout was stopped before
+	PatchStatusSkipped = "skipped"
+)
+
+// PatchNodes installs OS updates on all nodes and reboots them if required. Workers are patched first, with at most
+// maxUnavailable at a time, followed by isolated etcd nodes and the masters one by one. The rollout stops at the
+// first failure
+func (manager *Manager) PatchNodes(maxUnavailable int) []PatchResult {
+	results := []PatchResult{}
+	failed := false
+
+	for _, batch := range patchBatches(manager.nodes, maxUnavailable) {
+		if failed {
+			for _, node := range batch {
+				results = append(results, PatchResult{Node: node.Name, Status: PatchStatusSkipped})
+			}
+			continue
+		}
+
+		batchResults := make([]PatchResult, len(batch))
+		var wg sync.WaitGroup
+		for i, node := range batch {
+			wg.Add(1)
+			go func(i int, node Node) {
+				defer wg.Done()
+				batchResults[i] = manager.PatchNode(node)
+			}(i, node)
+		}
+		wg.Wait()
+
+		for _, result := range batchResults {
+			failed = failed || result.Status == PatchStatusFailed
+			results = append(results, result)
+		}
+	}
+
+	return results
+}
+
+// PatchNode cordons and drains a node, upgrades its packages, reboots it if required and waits until it is back
+// in the encrypted network and the cluster
+func (manager *Manager) PatchNode(node Node) PatchResult {
+	start := time.Now()
+	result := PatchResult{Node: node.Name, Status: PatchStatusPatched}
+
+	err := manager.patchNode(node, &result)
+	if err != nil {
+		manager.eventService.AddEvent(node.Name, "patching failed: "+err.Error())
+		result.Status = PatchStatusFailed
+		result.Err = err
+	} else {
+		manager.eventService.AddEvent(node.Name, "patched")
+	}
+	result.Duration = time.Since(start).Round(time.Second)
+
+	return result
+}
+
+func (manager *Manager) patchNode(node Node, result *PatchResult) error {
+	isKubernetesNode := isKubernetesNode(node, manager.haEnabled)
+	isEtcdMember := manager.haEnabled && node.IsEtcd
+
+	if isEtcdMember {
+		manager.eventService.AddEvent(node.Name, "check etcd quorum")
+		if err := NewEtcdManager(manager.clusterProvider, manager.nodeCommunicator).CheckMemberDowntime(node); err != nil {
+			return err
+		}
+	}
+
+	// a single master cannot be managed from another node, so it is neither cordoned nor drained
+	controlNode, err := manager.findMasterExcluding([]Node{node})
+	hasControlNode := err == nil
+	if isKubernetesNode && hasControlNode {
+		manager.eventService.AddEvent(node.Name, "drain node")
+		_, err := manager.nodeCommunicator.RunCmd(controlNode, fmt.Sprintf("kubectl drain %s --ignore-daemonsets --delete-local-data --force --timeout=300s", node.Name))
+		if err != nil {
+			return err
+		}
+	}
+
+	manager.eventService.AddEvent(node.Name, "upgrade packages")
+	out, err := manager.nodeCommunicator.RunCmd(node, "apt-mark hold "+strings.Join(heldPackages, " ")+
+		" && apt-get update && DEBIAN_FRONTEND=noninteractive apt-get upgrade -y -o Dpkg::Options::=--force-confdef -o Dpkg::Options::=--force-confold")
+	if err != nil {
+		return err
+	}
+	result.Upgraded = parseAptUpgradeCount(out)
+
+	out, err = manager.nodeCommunicator.RunCmd(node, "test -f /var/run/reboot-required && echo yes || echo no")
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(out) == "yes" {
+		if err := manager.rebootNode(node); err != nil {
+			return err
+		}
+		result.Rebooted = true
+	}
+
+	if err := manager.waitForWireguard(node); err != nil {
+		return err
+	}
+
+	if isEtcdMember {
+		manager.eventService.AddEvent(node.Name, "wait for etcd")
+		endpoint := EtcdEndpoints([]Node{node})[0]
+		err := waitUntil(patchTimeout, func() bool {
+			out, err := manager.nodeCommunicator.RunCmd(node, fmt.Sprintf("%s endpoint health --endpoints=%s 2>&1 || true", etcdctl, endpoint))
+			return err == nil && parseEtcdEndpointHealth(out)[endpoint]
+		})
+		if err != nil {
+			return fmt.Errorf("etcd did not become healthy: %v", err)
+		}
+	}
+
+	if !isKubernetesNode {
+		return nil
+	}
+
+	if !hasControlNode {
+		controlNode = node
+	}
+
+	// the node stays Ready until the node controller notices that the kubelet is gone, which might not happen during a
+	// quick reboot. Only a heartbeat the kubelet sent since the boot tells that it is ready again
+	var bootTime time.Time
+	if result.Rebooted {
+		out, err := manager.nodeCommunicator.RunCmd(node, "echo $(( $(date +%s) - $(cut -d. -f1 /proc/uptime) ))")
+		if err != nil {
+			return err
+		}
+
+		seconds, err := strconv.ParseInt(strings.TrimSpace(out), 10, 64)
+		if err != nil {
+			return fmt.Errorf("unable to parse boot time %q: %v", out, err)
+		}
+		bootTime = time.Unix(seconds, 0)
+	}
+
+	manager.eventService.AddEvent(node.Name, "wait for node to be ready")
+	err = waitUntil(patchTimeout, func() bool {
+		out, err := manager.nodeCommunicator.RunCmd(controlNode, fmt.Sprintf("kubectl get node %s -o jsonpath='%s'", node.Name, readyHeartbeatJSONPath))
+		if err != nil {
+			return false
+		}
+
+		ready, heartbeat, err := parseReadyHeartbeat(out)
+		return err == nil && ready && !heartbeat.Before(bootTime)
+	})
+	if err != nil {
+		return fmt.Errorf("node did not become ready: %v", err)
+	}
+
+	if hasControlNode {
+		manager.eventService.AddEvent(node.Name, "uncordon node")
+		_, err = manager.nodeCommunicator.RunCmd(controlNode, "kubectl uncordon "+node.Name)
+	}
+
+	return err
+}
+
+// parseReadyHeartbeat parses the output of kubectl with readyHeartbeatJSONPath
+func parseReadyHeartbeat(out string) (bool, time.Time, error) {
+	fields := strings.Fields(out)
+	if len(fields) != 2 {
+		return false, time.Time{}, fmt.Errorf("unable to parse ready condition %q", out)
+	}
+
+	heartbeat, err := time.Parse(time.RFC3339, fields[1])
+	if err != nil {
+		return false, time.Time{}, fmt.Errorf("unable to parse heartbeat time: %v", err)
+	}
+
+	return fields[0] == "True", heartbeat, nil
+}
+
+// rebootNode reboots a node and waits until it is reachable again
+func (manager *Manager) rebootNode(node Node) error {
+	manager.eventService.AddEvent(node.Name, "reboot")
+	bootID, err := manager.nodeCommunicator.RunCmd(node, "cat /proc/sys/kernel/random/boot_id")
+	if err != nil {
+		return err
+	}
+
+	// the reboot is delayed, so the SSH session terminates cleanly
+	_, err = manager.nodeCommunicator.RunCmd(node, "nohup sh -c 'sleep 2 && reboot' > /dev/null 2>&1 &")
+	if err != nil {
+		return err
+	}
+
+	manager.eventService.AddEvent(node.Name, "wait for reboot")
+	err = waitUntil(patchTimeout, func() bool {
+		newBootID, err := manager.nodeCommunicator.RunCmd(node, "cat /proc/sys/kernel/random/boot_id")
+		return err == nil && newBootID != bootID
+	})
+	if err != nil {
+		return fmt.Errorf("node did not come back after reboot: %v", err)
+	}
+
+	return nil
+}
+
+// waitForWireguard waits until the node has a handshake with all of its peers. As wireguard only handshakes on
+// traffic, every peer is pinged once before
+func (manager *Manager) waitForWireguard(node Node) error {
+	manager.eventService.AddEvent(node.Name, "wait for wireguard handshakes")
+	pingCommands := []string{}
+	for _, peer := range manager.nodes {
+		if peer.Name != node.Name {
+			pingCommands = append(pingCommands, fmt.Sprintf("ping -c 1 -W 2 %s > /dev/null", peer.PrivateIPAddress))
+		}
+	}
+
+	if len(pingCommands) == 0 {
+		return nil
+	}
+
+	err := waitUntil(patchTimeout, func() bool {
+		manager.nodeCommunicator.RunCmd(node, strings.Join(pingCommands, "; ")+"; true")
+		out, err := manager.nodeCommunicator.RunCmd(node, "wg show wg0 latest-handshakes")
+		if err != nil {
+			return false
+		}
+
+		handshakes := parseWireguardHandshakes(out)
+		for _, peer := range manager.nodes {
+			if peer.Name == node.Name {
+				continue
+			}
+
+			if handshake := handshakes[peer.WireGuardKeyPair.Public]; handshake.IsZero() || time.Since(handshake) > staleHandshakeAge {
+				return false
+			}
+		}
+
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("wireguard peers are not connected: %v", err)
+	}
+
+	return nil
+}
+
+// waitUntil checks the condition every 5 seconds until it is true or the timeout is exceeded
+func waitUntil(timeout time.Duration, condition func() bool) error {
+	deadline := time.Now().Add(timeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %s", timeout)
+		}
+
+		time.Sleep(5 * time.Second)
+	}
+
+	return nil
+}
+
+// patchBatches returns the order in which the nodes are patched. Workers come first, in batches of at most
+// maxUnavailable nodes. Nodes running etcd or the control plane follow one by one, masters last
+func patchBatches(nodes []Node, maxUnavailable int) [][]Node {
+	if maxUnavailable < 1 {
+		maxUnavailable = 1
+	}
+
+	batches := [][]Node{}
+	batch := []Node{}
+	for _, node := range nodes {
+		if node.IsMaster || node.IsEtcd {
+			continue
+		}
+
+		batch = append(batch, node)
+		if len(batch) == maxUnavailable {
+			batches = append(batches, batch)
+			batch = []Node{}
+		}
+	}
+
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+
+	for _, node := range nodes {
+		if node.IsEtcd && !node.IsMaster {
+			batches = append(batches, []Node{node})
+		}
+	}
+
+	for _, node := range nodes {
+		if node.IsMaster {
+			batches = append(batches, []Node{node})
+		}
+	}
+
+	return batches
+}
+
+// parseAptUpgradeCount returns the number of upgraded packages from the output of apt-get upgrade
+func parseAptUpgradeCount(out string) int {
+	match := aptUpgradedPattern.FindStringSubmatch(out)
+	if match == nil {
+		return 0
+	}
+
+	count, _ := strconv.Atoi(match[1])
+	return count
+}
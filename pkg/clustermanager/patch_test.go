@@ -0,0 +1,76 @@
+package clustermanager
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPatchBatches(t *testing.T) {
+	nodes := []Node{
+		{Name: "master1", IsMaster: true, IsEtcd: true},
+		{Name: "etcd1", IsEtcd: true},
+		{Name: "worker1"},
+		{Name: "master2", IsMaster: true, IsEtcd: true},
+		{Name: "worker2"},
+		{Name: "worker3"},
+	}
+
+	batches := patchBatches(nodes, 2)
+	names := [][]string{}
+	for _, batch := range batches {
+		batchNames := []string{}
+		for _, node := range batch {
+			batchNames = append(batchNames, node.Name)
+		}
+		names = append(names, batchNames)
+	}
+
+	expected := [][]string{
+		{"worker1", "worker2"},
+		{"worker3"},
+		{"etcd1"},
+		{"master1"},
+		{"master2"},
+	}
+
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("unexpected patch order\nexpected: %v\ngot: %v", expected, names)
+	}
+}
+
+func TestParseAptUpgradeCount(t *testing.T) {
+	tests := []struct {
+		out      string
+		expected int
+	}{
+		{"Calculating upgrade... Done\n12 upgraded, 0 newly installed, 0 to remove and 3 not upgraded.\n", 12},
+		{"0 upgraded, 0 newly installed, 0 to remove and 0 not upgraded.\n", 0},
+		{"", 0},
+	}
+
+	for _, test := range tests {
+		if count := parseAptUpgradeCount(test.out); count != test.expected {
+			t.Errorf("expected %d upgraded packages for %q, got %d", test.expected, test.out, count)
+		}
+	}
+}
+
+func TestParseReadyHeartbeat(t *testing.T) {
+	ready, heartbeat, err := parseReadyHeartbeat("True\t2020-09-21T08:30:00Z")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !ready || !heartbeat.Equal(time.Date(2020, 9, 21, 8, 30, 0, 0, time.UTC)) {
+		t.Errorf("expected a ready node with heartbeat 2020-09-21T08:30:00Z, got %v and %s", ready, heartbeat)
+	}
+
+	if ready, _, err := parseReadyHeartbeat("Unknown\t2020-09-21T08:30:00Z"); err != nil || ready {
+		t.Errorf("expected a node which is not ready, got %v and error %v", ready, err)
+	}
+
+	if _, _, err := parseReadyHeartbeat(""); err == nil {
+		t.Error("expected an error for a node without ready condition")
+	}
+}
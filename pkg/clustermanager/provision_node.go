@@ -9,13 +9,14 @@ import (
 
 const maxErrors = 3
 
-// NodeProvisioner provisions all basic packages to install docker, kubernetes and wireguard
+// NodeProvisioner provisions all basic packages to install the container runtime, kubernetes and wireguard
 type NodeProvisioner struct {
 	clusterName       string
 	node              Node
 	communicator      NodeCommunicator
 	eventService      EventService
 	kubernetesVersion string
+	containerRuntime  string
 }
 
 // NewNodeProvisioner creates a NodeProvisioner instance
@@ -26,6 +27,7 @@ func NewNodeProvisioner(node Node, manager *Manager) *NodeProvisioner {
 		communicator:      manager.nodeCommunicator,
 		eventService:      manager.eventService,
 		kubernetesVersion: manager.Cluster().KubernetesVersion,
+		containerRuntime:  manager.containerRuntime,
 	}
 }
 
@@ -85,6 +87,12 @@ func (provisioner *NodeProvisioner) prepareAndInstall() error {
 	if err != nil {
 		return err
 	}
+	if provisioner.containerRuntime == ContainerRuntimeContainerd {
+		err = provisioner.configureContainerd()
+		if err != nil {
+			return err
+		}
+	}
 	err = provisioner.setSystemWideEnvironment()
 	if err != nil {
 		return err
@@ -167,7 +175,7 @@ func (provisioner *NodeProvisioner) installTransportTools() error {
 func (provisioner *NodeProvisioner) preparePackages() error {
 	provisioner.eventService.AddEvent(provisioner.node.Name, "prepare packages")
 
-	err := provisioner.prepareDocker()
+	err := provisioner.prepareContainerRuntime()
 	if err != nil {
 		return err
 	}
@@ -202,19 +210,22 @@ func (provisioner *NodeProvisioner) prepareKubernetes() error {
 	return nil
 }
 
-func (provisioner *NodeProvisioner) prepareDocker() error {
-	// docker-ce
-	aptPreferencesDocker := `
+// prepareContainerRuntime adds the docker repository, which also provides containerd
+func (provisioner *NodeProvisioner) prepareContainerRuntime() error {
+	if provisioner.containerRuntime != ContainerRuntimeContainerd {
+		// docker-ce
+		aptPreferencesDocker := `
 Package: docker-ce
 Pin: version 19.03.13~3-0~ubuntu-focal
 Pin-Priority: 1000
 	`
-	err := provisioner.communicator.WriteFile(provisioner.node, "/etc/apt/preferences.d/docker-ce", aptPreferencesDocker, AllRead)
-	if err != nil {
-		return err
+		err := provisioner.communicator.WriteFile(provisioner.node, "/etc/apt/preferences.d/docker-ce", aptPreferencesDocker, AllRead)
+		if err != nil {
+			return err
+		}
 	}
 
-	_, err = provisioner.communicator.RunCmd(provisioner.node, `curl -fsSL https://download.docker.com/linux/$(. /etc/os-release; echo "$ID")/gpg | apt-key add -`)
+	_, err := provisioner.communicator.RunCmd(provisioner.node, `curl -fsSL https://download.docker.com/linux/$(. /etc/os-release; echo "$ID")/gpg | apt-key add -`)
 	if err != nil {
 		return err
 	}
@@ -235,8 +246,13 @@ func (provisioner *NodeProvisioner) updateAndInstall() error {
 	}
 
 	provisioner.eventService.AddEvent(provisioner.node.Name, "installing packages")
-	command := fmt.Sprintf("apt-get install -y docker-ce kubelet=%s-00 kubeadm=%s-00 kubectl=%s-00 kubernetes-cni=0.8.7-00 wireguard linux-headers-generic linux-headers-virtual",
-		provisioner.kubernetesVersion, provisioner.kubernetesVersion, provisioner.kubernetesVersion)
+	runtimePackage := "docker-ce"
+	if provisioner.containerRuntime == ContainerRuntimeContainerd {
+		runtimePackage = "containerd.io"
+	}
+
+	command := fmt.Sprintf("apt-get install -y %s kubelet=%s-00 kubeadm=%s-00 kubectl=%s-00 %s wireguard linux-headers-generic linux-headers-virtual",
+		runtimePackage, provisioner.kubernetesVersion, provisioner.kubernetesVersion, provisioner.kubernetesVersion, kubernetesCNIPackage(provisioner.kubernetesVersion))
 	_, err = provisioner.communicator.RunCmd(provisioner.node, command)
 	if err != nil {
 		return err
@@ -245,6 +261,45 @@ func (provisioner *NodeProvisioner) updateAndInstall() error {
 	return nil
 }
 
+// kubernetesCNIPackage returns the kubernetes-cni package installed with the kubelet. Newer kubelet packages depend
+// on newer versions of kubernetes-cni, so apt installs the version they depend on
+func kubernetesCNIPackage(kubernetesVersion string) string {
+	if kubernetesMinorVersion(kubernetesVersion) < 24 {
+		return "kubernetes-cni=0.8.7-00"
+	}
+
+	return "kubernetes-cni"
+}
+
+// configureContainerd loads the kernel modules and sysctls required by containerd and enables the systemd cgroup driver
+func (provisioner *NodeProvisioner) configureContainerd() error {
+	provisioner.eventService.AddEvent(provisioner.node.Name, "configure containerd")
+
+	err := provisioner.communicator.WriteFile(provisioner.node, "/etc/modules-load.d/containerd.conf", "overlay\nbr_netfilter\n", AllRead)
+	if err != nil {
+		return err
+	}
+
+	sysctls := "net.bridge.bridge-nf-call-iptables = 1\nnet.ipv4.ip_forward = 1\nnet.bridge.bridge-nf-call-ip6tables = 1\n"
+	err = provisioner.communicator.WriteFile(provisioner.node, "/etc/sysctl.d/99-kubernetes-cri.conf", sysctls, AllRead)
+	if err != nil {
+		return err
+	}
+
+	err = provisioner.communicator.WriteFile(provisioner.node, "/etc/containerd/config.toml", GenerateContainerdConfig(), AllRead)
+	if err != nil {
+		return err
+	}
+
+	err = provisioner.communicator.WriteFile(provisioner.node, "/etc/crictl.yaml", fmt.Sprintf("runtime-endpoint: unix://%s\n", containerdSocket), AllRead)
+	if err != nil {
+		return err
+	}
+
+	_, err = provisioner.communicator.RunCmd(provisioner.node, "modprobe overlay && modprobe br_netfilter && sysctl --system && systemctl restart containerd")
+	return err
+}
+
 // Last step because otherwise we need create script to check if variables already set and replaces them
 // As soon as it is last step we are ok to set them in basic way
 func (provisioner *NodeProvisioner) setSystemWideEnvironment() error {
@@ -0,0 +1,145 @@
+package clustermanager
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// readyConditionJSONPath prints name, status and last transition time of the Ready condition for every node
+const readyConditionJSONPath = `{range .items[*]}{.metadata.name}{"\t"}{range .status.conditions[?(@.type=="Ready")]}{.status}{"\t"}{.lastTransitionTime}{end}{"\n"}{end}`
+
+// NodeReadiness describes the Ready condition of a kubernetes node
+type NodeReadiness struct {
+	Ready bool
+	Since time.Time
+}
+
+// UnhealthyNode is a node which needs to be repaired, with the reason why
+type UnhealthyNode struct {
+	Node   Node
+	Reason string
+}
+
+// UnhealthyWorkers returns all workers, which are not ready for longer than the given threshold. Workers whose
+// readiness is unknown, as the api server is not available or they are not registered, are unhealthy if they are
+// unreachable via SSH for the whole threshold. External workers are skipped, as their servers cannot be recreated
+func (manager *Manager) UnhealthyWorkers(threshold time.Duration) ([]UnhealthyNode, error) {
+	masterNode, err := manager.clusterProvider.GetMasterNode()
+	if err != nil {
+		return nil, err
+	}
+
+	// if the api server is not available, we can't tell anything about the workers' readiness and only rely on SSH
+	readiness := map[string]NodeReadiness{}
+	out, err := manager.nodeCommunicator.RunCmd(*masterNode, fmt.Sprintf("kubectl get nodes -o jsonpath='%s'", readyConditionJSONPath))
+	if err == nil {
+		readiness, err = parseNodeReadiness(out)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	unhealthy := []UnhealthyNode{}
+	unknown := []Node{}
+	for _, node := range manager.clusterProvider.GetWorkerNodes() {
+		if node.Type == "" {
+			continue
+		}
+
+		state, isRegistered := readiness[node.Name]
+		if !isRegistered {
+			unknown = append(unknown, node)
+			continue
+		}
+
+		if !state.Ready && time.Since(state.Since) > threshold {
+			unhealthy = append(unhealthy, UnhealthyNode{
+				Node:   node,
+				Reason: fmt.Sprintf("not ready since %s", state.Since.Format(time.RFC3339)),
+			})
+		}
+	}
+
+	for _, node := range manager.unreachableNodes(unknown, threshold) {
+		unhealthy = append(unhealthy, UnhealthyNode{Node: node, Reason: fmt.Sprintf("unreachable via SSH for %s", threshold)})
+	}
+
+	return unhealthy, nil
+}
+
+// unreachableNodes returns the nodes which are not reachable via SSH at all within the timeout. A single failed
+// connection might just be a timeout, so the nodes are checked again until they respond
+func (manager *Manager) unreachableNodes(nodes []Node, timeout time.Duration) []Node {
+	unreachable := nodes
+	// the error only tells that some nodes did not respond in time, which are the remaining ones
+	_ = waitUntil(timeout, func() bool {
+		remaining := []Node{}
+		for _, node := range unreachable {
+			if _, err := manager.nodeCommunicator.RunCmd(node, "true"); err != nil {
+				remaining = append(remaining, node)
+			}
+		}
+
+		unreachable = remaining
+		return len(unreachable) == 0
+	})
+
+	return unreachable
+}
+
+// DrainAndDeleteNode evicts all pods from a node and removes it from kubernetes. Failures are reported as events
+// only, as the node might be dead already
+func (manager *Manager) DrainAndDeleteNode(node Node) error {
+	masterNode, err := manager.clusterProvider.GetMasterNode()
+	if err != nil {
+		return err
+	}
+
+	manager.eventService.AddEvent(node.Name, "drain node")
+	_, err = manager.nodeCommunicator.RunCmd(*masterNode, fmt.Sprintf("kubectl drain %s --ignore-daemonsets --delete-local-data --force --timeout=120s", node.Name))
+	if err != nil {
+		manager.eventService.AddEvent(node.Name, "drain failed")
+	}
+
+	manager.eventService.AddEvent(node.Name, "delete node from kubernetes")
+	_, err = manager.nodeCommunicator.RunCmd(*masterNode, fmt.Sprintf("kubectl delete node %s --ignore-not-found", node.Name))
+
+	return err
+}
+
+// ReplaceNode replaces the node with the same name in the node list of the manager and the provider,
+// e.g. after its server was recreated
+func (manager *Manager) ReplaceNode(node Node) {
+	for i := range manager.nodes {
+		if manager.nodes[i].Name == node.Name {
+			manager.nodes[i] = node
+		}
+	}
+
+	manager.clusterProvider.SetNodes(manager.nodes)
+}
+
+// parseNodeReadiness parses the output of kubectl with readyConditionJSONPath
+func parseNodeReadiness(out string) (map[string]NodeReadiness, error) {
+	readiness := make(map[string]NodeReadiness)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("unable to parse node readiness %q", line)
+		}
+
+		since, err := time.Parse(time.RFC3339, fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse transition time of node '%s': %v", fields[0], err)
+		}
+
+		readiness[fields[0]] = NodeReadiness{Ready: fields[1] == "True", Since: since}
+	}
+
+	return readiness, nil
+}
@@ -0,0 +1,30 @@
+package clustermanager
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseNodeReadiness(t *testing.T) {
+	out := "kube-master-01\tTrue\t2020-09-20T10:00:00Z\nkube-worker-01\tFalse\t2020-09-21T08:30:00Z\n"
+	expected := map[string]NodeReadiness{
+		"kube-master-01": {Ready: true, Since: time.Date(2020, 9, 20, 10, 0, 0, 0, time.UTC)},
+		"kube-worker-01": {Ready: false, Since: time.Date(2020, 9, 21, 8, 30, 0, 0, time.UTC)},
+	}
+
+	readiness, err := parseNodeReadiness(out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(readiness, expected) {
+		t.Errorf("parsed readiness does not match expected\nexpected: %v\ngot: %v", expected, readiness)
+	}
+}
+
+func TestParseNodeReadinessInvalid(t *testing.T) {
+	if _, err := parseNodeReadiness("kube-worker-01\tFalse\n"); err == nil {
+		t.Error("expected an error for a line without transition time")
+	}
+}
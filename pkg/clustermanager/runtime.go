@@ -0,0 +1,51 @@
+package clustermanager
+
+import "fmt"
+
+const (
+	// ContainerRuntimeDocker runs the containers with docker-ce and dockershim
+	ContainerRuntimeDocker = "docker"
+	// ContainerRuntimeContainerd runs the containers with containerd through its CRI plugin
+	ContainerRuntimeContainerd = "containerd"
+)
+
+// ContainerRuntimes contains all supported container runtimes
+var ContainerRuntimes = []string{ContainerRuntimeDocker, ContainerRuntimeContainerd}
+
+const containerdSocket = "/run/containerd/containerd.sock"
+
+// ContainerRuntimeOrDefault returns the given container runtime, or docker for clusters created before the
+// container runtime was configurable
+func ContainerRuntimeOrDefault(containerRuntime string) string {
+	if containerRuntime == "" {
+		return ContainerRuntimeDocker
+	}
+
+	return containerRuntime
+}
+
+// RestartKubeletCommand returns the command restarting the container runtime and the kubelet afterwards
+func RestartKubeletCommand(containerRuntime string) string {
+	return fmt.Sprintf("systemctl restart %s && systemctl restart kubelet", ContainerRuntimeOrDefault(containerRuntime))
+}
+
+// CRISocket returns the CRI socket kubeadm must use, or an empty string to let kubeadm use dockershim
+func CRISocket(containerRuntime string) string {
+	if containerRuntime == ContainerRuntimeContainerd {
+		return containerdSocket
+	}
+
+	return ""
+}
+
+// GenerateContainerdConfig generates the containerd configuration, which runs containers in systemd cgroups
+// like the kubelet does
+func GenerateContainerdConfig() string {
+	return `version = 2
+
+[plugins."io.containerd.grpc.v1.cri".containerd.runtimes.runc]
+  runtime_type = "io.containerd.runc.v2"
+  [plugins."io.containerd.grpc.v1.cri".containerd.runtimes.runc.options]
+    SystemdCgroup = true
+`
+}
@@ -0,0 +1,381 @@
+package clustermanager
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CheckStatus is the outcome of a single health check
+type CheckStatus string
+
+const (
+	// StatusOK indicates a passed check
+	StatusOK CheckStatus = "OK"
+	// StatusWarning indicates a check which passed with limitations
+	StatusWarning CheckStatus = "WARNING"
+	// StatusCritical indicates a failed check
+	StatusCritical CheckStatus = "CRITICAL"
+)
+
+// staleHandshakeAge is the age after which a wireguard handshake is considered stale. Wireguard renews
+// sessions every 2 minutes while traffic flows
+const staleHandshakeAge = 5 * time.Minute
+
+// CheckResult is the result of a health check on a node
+type CheckResult struct {
+	Node    string      `json:"node"`
+	Check   string      `json:"check"`
+	Status  CheckStatus `json:"status"`
+	Message string      `json:"message"`
+}
+
+// StatusChecker runs health checks on all nodes of a cluster
+type StatusChecker struct {
+	provider         ClusterProvider
+	nodeCommunicator NodeCommunicator
+	haEnabled        bool
+	containerRuntime string
+}
+
+// NewStatusChecker creates a StatusChecker instance
+func NewStatusChecker(provider ClusterProvider, nodeCommunicator NodeCommunicator, cluster Cluster) *StatusChecker {
+	return &StatusChecker{
+		provider:         provider,
+		nodeCommunicator: nodeCommunicator,
+		haEnabled:        cluster.HaEnabled,
+		containerRuntime: ContainerRuntimeOrDefault(cluster.ContainerRuntime),
+	}
+}
+
+// Run performs all checks on all nodes in parallel
+func (checker *StatusChecker) Run() []CheckResult {
+	nodes := checker.provider.GetAllNodes()
+	kubernetesNodes, kubernetesErr := checker.kubernetesNodeStates()
+
+	resultChan := make(chan []CheckResult)
+	for _, node := range nodes {
+		go func(node Node) {
+			resultChan <- checker.checkNode(node, nodes, kubernetesNodes, kubernetesErr)
+		}(node)
+	}
+
+	results := []CheckResult{}
+	for range nodes {
+		results = append(results, <-resultChan...)
+	}
+
+	// keep the order of the nodes for a stable output
+	sorted := []CheckResult{}
+	for _, node := range nodes {
+		for _, result := range results {
+			if result.Node == node.Name {
+				sorted = append(sorted, result)
+			}
+		}
+	}
+
+	return sorted
+}
+
+// checkNode runs all checks for a single node
+func (checker *StatusChecker) checkNode(node Node, nodes []Node, kubernetesNodes map[string]string, kubernetesErr error) []CheckResult {
+	_, err := checker.nodeCommunicator.RunCmd(node, "true")
+	if err != nil {
+		return []CheckResult{{Node: node.Name, Check: "ssh", Status: StatusCritical, Message: "node is unreachable"}}
+	}
+
+	results := []CheckResult{
+		{Node: node.Name, Check: "ssh", Status: StatusOK, Message: "reachable"},
+		checker.checkWireguard(node, nodes),
+		checker.checkServices(node),
+	}
+
+	if checker.haEnabled && node.IsEtcd {
+		results = append(results, checker.checkEtcd(node))
+	}
+
+	if isKubernetesNode(node, checker.haEnabled) {
+		results = append(results, checkKubernetesNode(node, kubernetesNodes, kubernetesErr))
+
+		if checker.haEnabled {
+			results = append(results, checker.checkLoadBalancer(node))
+		}
+	}
+
+	return results
+}
+
+// checkWireguard verifies that there are recent handshakes with all peers. Wireguard only does handshakes while
+// there is traffic, so peers without a recent handshake are pinged before they are reported
+func (checker *StatusChecker) checkWireguard(node Node, nodes []Node) CheckResult {
+	result := CheckResult{Node: node.Name, Check: "wireguard"}
+	out, err := checker.nodeCommunicator.RunCmd(node, "wg show wg0 latest-handshakes")
+	if err != nil {
+		result.Status = StatusCritical
+		result.Message = "wireguard interface wg0 is not up"
+		return result
+	}
+
+	missing, stale := inactiveWireguardPeers(node, nodes, parseWireguardHandshakes(out), time.Now())
+	if len(missing)+len(stale) > 0 {
+		out, err = checker.nodeCommunicator.RunCmd(node, wireguardPingCommand(append(missing, stale...))+" wg show wg0 latest-handshakes")
+		if err != nil {
+			result.Status = StatusCritical
+			result.Message = err.Error()
+			return result
+		}
+
+		missing, stale = inactiveWireguardPeers(node, nodes, parseWireguardHandshakes(out), time.Now())
+	}
+
+	switch {
+	case len(missing) > 0:
+		result.Status = StatusCritical
+		result.Message = "no handshake with " + strings.Join(nodeNames(missing), ", ")
+	case len(stale) > 0:
+		result.Status = StatusWarning
+		result.Message = "stale handshake with " + strings.Join(nodeNames(stale), ", ")
+	default:
+		result.Status = StatusOK
+		result.Message = fmt.Sprintf("%d peers connected", len(nodes)-1)
+	}
+
+	return result
+}
+
+// inactiveWireguardPeers returns the peers of a node without any handshake, and the peers whose latest handshake is
+// stale
+func inactiveWireguardPeers(node Node, nodes []Node, handshakes map[string]time.Time, now time.Time) ([]Node, []Node) {
+	missing := []Node{}
+	stale := []Node{}
+	for _, peer := range nodes {
+		if peer.Name == node.Name {
+			continue
+		}
+
+		handshake, isPeer := handshakes[peer.WireGuardKeyPair.Public]
+		if !isPeer || handshake.IsZero() {
+			missing = append(missing, peer)
+		} else if now.Sub(handshake) > staleHandshakeAge {
+			stale = append(stale, peer)
+		}
+	}
+
+	return missing, stale
+}
+
+// wireguardPingCommand returns the command pinging the peers in parallel through the wireguard network, which makes
+// wireguard do a handshake with every reachable peer. Unreachable peers are reported by the handshakes
+func wireguardPingCommand(peers []Node) string {
+	ips := []string{}
+	for _, peer := range peers {
+		ips = append(ips, peer.PrivateIPAddress)
+	}
+
+	return fmt.Sprintf("for ip in %s; do ping -c 1 -W 2 $ip > /dev/null 2>&1 & done; wait;", strings.Join(ips, " "))
+}
+
+// nodeNames returns the names of the nodes
+func nodeNames(nodes []Node) []string {
+	names := []string{}
+	for _, node := range nodes {
+		names = append(names, node.Name)
+	}
+
+	return names
+}
+
+// checkServices verifies that the systemd services required on the node are active
+func (checker *StatusChecker) checkServices(node Node) CheckResult {
+	result := CheckResult{Node: node.Name, Check: "services"}
+	services := []string{}
+	if isKubernetesNode(node, checker.haEnabled) {
+		services = append(services, checker.containerRuntime, "kubelet")
+	}
+
+	if checker.haEnabled && node.IsEtcd {
+		services = append(services, "etcd")
+	}
+
+	// is-active exits non-zero if any service is inactive, so we just collect the output
+	out, err := checker.nodeCommunicator.RunCmd(node, "systemctl is-active "+strings.Join(services, " ")+" 2>&1 || true")
+	if err != nil {
+		result.Status = StatusCritical
+		result.Message = err.Error()
+		return result
+	}
+
+	states := strings.Fields(out)
+	inactive := []string{}
+	for i, service := range services {
+		if i >= len(states) || states[i] != "active" {
+			inactive = append(inactive, service)
+		}
+	}
+
+	if len(inactive) > 0 {
+		result.Status = StatusCritical
+		result.Message = "inactive: " + strings.Join(inactive, ", ")
+	} else {
+		result.Status = StatusOK
+		result.Message = strings.Join(services, ", ") + " active"
+	}
+
+	return result
+}
+
+// checkEtcd verifies the health of the etcd member on the node
+func (checker *StatusChecker) checkEtcd(node Node) CheckResult {
+	result := CheckResult{Node: node.Name, Check: "etcd"}
+	endpoint := EtcdEndpoints([]Node{node})[0]
+	out, err := checker.nodeCommunicator.RunCmd(node, fmt.Sprintf("%s endpoint health --endpoints=%s 2>&1 || true", etcdctl, endpoint))
+	if err != nil {
+		result.Status = StatusCritical
+		result.Message = err.Error()
+		return result
+	}
+
+	if parseEtcdEndpointHealth(out)[endpoint] {
+		result.Status = StatusOK
+		result.Message = "healthy"
+	} else {
+		result.Status = StatusCritical
+		result.Message = "unhealthy"
+	}
+
+	return result
+}
+
+// checkLoadBalancer verifies that the master load balancer on the node forwards to a healthy api server
+func (checker *StatusChecker) checkLoadBalancer(node Node) CheckResult {
+	result := CheckResult{Node: node.Name, Check: "master-lb"}
+	out, err := checker.nodeCommunicator.RunCmd(node, fmt.Sprintf("curl -sk -o /dev/null -w '%%{http_code}' https://%s/healthz || true", controlPlaneEndpoint))
+	if err != nil {
+		result.Status = StatusCritical
+		result.Message = err.Error()
+		return result
+	}
+
+	switch code := strings.TrimSpace(out); code {
+	case "200":
+		result.Status = StatusOK
+		result.Message = "healthy"
+	case "000", "":
+		result.Status = StatusCritical
+		result.Message = "master-lb is not reachable"
+	default:
+		result.Status = StatusCritical
+		result.Message = "api server health check returned HTTP " + code
+	}
+
+	return result
+}
+
+// kubernetesNodeStates returns the readiness of all kubernetes nodes, queried from the first reachable master
+func (checker *StatusChecker) kubernetesNodeStates() (map[string]string, error) {
+	var err error
+	var out string
+	for _, master := range checker.provider.GetMasterNodes() {
+		out, err = checker.nodeCommunicator.RunCmd(master, "kubectl get nodes --no-headers")
+		if err == nil {
+			return parseKubectlNodes(out), nil
+		}
+	}
+
+	if err == nil {
+		err = fmt.Errorf("no master node found")
+	}
+
+	return nil, err
+}
+
+// checkKubernetesNode verifies that the node is registered and ready in kubernetes
+func checkKubernetesNode(node Node, kubernetesNodes map[string]string, kubernetesErr error) CheckResult {
+	result := CheckResult{Node: node.Name, Check: "kubernetes"}
+	if kubernetesErr != nil {
+		result.Status = StatusCritical
+		result.Message = "unable to query the api server"
+		return result
+	}
+
+	state, isRegistered := kubernetesNodes[node.Name]
+	switch {
+	case !isRegistered:
+		result.Status = StatusCritical
+		result.Message = "node is not registered"
+	case state == "Ready":
+		result.Status = StatusOK
+		result.Message = state
+	case strings.HasPrefix(state, "Ready,"):
+		result.Status = StatusWarning
+		result.Message = state
+	default:
+		result.Status = StatusCritical
+		result.Message = state
+	}
+
+	return result
+}
+
+// isKubernetesNode returns true, if the node is part of the kubernetes cluster, i.e. not an isolated etcd node
+func isKubernetesNode(node Node, haEnabled bool) bool {
+	return node.IsMaster || !node.IsEtcd || !haEnabled
+}
+
+// OverallStatus returns the worst status of all results
+func OverallStatus(results []CheckResult) CheckStatus {
+	status := StatusOK
+	for _, result := range results {
+		if result.Status == StatusCritical {
+			return StatusCritical
+		}
+
+		if result.Status == StatusWarning {
+			status = StatusWarning
+		}
+	}
+
+	return status
+}
+
+// parseWireguardHandshakes parses the output of 'wg show <interface> latest-handshakes' and returns the time of
+// the latest handshake by public key. Peers without any handshake get the zero time
+func parseWireguardHandshakes(out string) map[string]time.Time {
+	handshakes := make(map[string]time.Time)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+
+		timestamp, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		if timestamp == 0 {
+			handshakes[fields[0]] = time.Time{}
+		} else {
+			handshakes[fields[0]] = time.Unix(timestamp, 0)
+		}
+	}
+
+	return handshakes
+}
+
+// parseKubectlNodes parses the output of 'kubectl get nodes --no-headers' and returns the status by node name
+func parseKubectlNodes(out string) map[string]string {
+	nodes := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		nodes[fields[0]] = fields[1]
+	}
+
+	return nodes
+}
@@ -0,0 +1,83 @@
+package clustermanager
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseWireguardHandshakes(t *testing.T) {
+	out := "node1pub=\t1600000000\nnode2pub=\t0\n"
+	expected := map[string]time.Time{
+		"node1pub=": time.Unix(1600000000, 0),
+		"node2pub=": {},
+	}
+
+	handshakes := parseWireguardHandshakes(out)
+	if !reflect.DeepEqual(handshakes, expected) {
+		t.Errorf("parsed handshakes do not match expected\nexpected: %v\ngot: %v", expected, handshakes)
+	}
+}
+
+func TestInactiveWireguardPeers(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	nodes := []Node{
+		{Name: "node1", PrivateIPAddress: "10.0.1.11", WireGuardKeyPair: WgKeyPair{Public: "node1pub="}},
+		{Name: "node2", PrivateIPAddress: "10.0.1.12", WireGuardKeyPair: WgKeyPair{Public: "node2pub="}},
+		{Name: "node3", PrivateIPAddress: "10.0.1.13", WireGuardKeyPair: WgKeyPair{Public: "node3pub="}},
+		{Name: "node4", PrivateIPAddress: "10.0.1.14", WireGuardKeyPair: WgKeyPair{Public: "node4pub="}},
+	}
+	handshakes := map[string]time.Time{
+		"node2pub=": now.Add(-time.Minute),
+		"node3pub=": now.Add(-time.Hour),
+		"node4pub=": {},
+	}
+
+	missing, stale := inactiveWireguardPeers(nodes[0], nodes, handshakes, now)
+	if !reflect.DeepEqual(nodeNames(missing), []string{"node4"}) || !reflect.DeepEqual(nodeNames(stale), []string{"node3"}) {
+		t.Errorf("expected node4 without handshake and node3 with a stale one, got %v and %v", nodeNames(missing), nodeNames(stale))
+	}
+
+	expectedCommand := "for ip in 10.0.1.14 10.0.1.13; do ping -c 1 -W 2 $ip > /dev/null 2>&1 & done; wait;"
+	if command := wireguardPingCommand(append(missing, stale...)); command != expectedCommand {
+		t.Errorf("expected ping command %q, got %q", expectedCommand, command)
+	}
+}
+
+func TestParseKubectlNodes(t *testing.T) {
+	out := `kube-master-01   Ready                      master   10d   v1.19.2
+kube-worker-01   NotReady                   <none>   10d   v1.19.2
+kube-worker-02   Ready,SchedulingDisabled   <none>   1d    v1.19.2
+`
+	expected := map[string]string{
+		"kube-master-01": "Ready",
+		"kube-worker-01": "NotReady",
+		"kube-worker-02": "Ready,SchedulingDisabled",
+	}
+
+	nodes := parseKubectlNodes(out)
+	if !reflect.DeepEqual(nodes, expected) {
+		t.Errorf("parsed nodes do not match expected\nexpected: %v\ngot: %v", expected, nodes)
+	}
+}
+
+func TestOverallStatus(t *testing.T) {
+	testCases := []struct {
+		name     string
+		results  []CheckResult
+		expected CheckStatus
+	}{
+		{name: "no results", results: []CheckResult{}, expected: StatusOK},
+		{name: "all ok", results: []CheckResult{{Status: StatusOK}, {Status: StatusOK}}, expected: StatusOK},
+		{name: "warning", results: []CheckResult{{Status: StatusOK}, {Status: StatusWarning}}, expected: StatusWarning},
+		{name: "critical", results: []CheckResult{{Status: StatusCritical}, {Status: StatusWarning}}, expected: StatusCritical},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.name, func(t *testing.T) {
+			if status := OverallStatus(tC.results); status != tC.expected {
+				t.Errorf("expected status %s, got %s", tC.expected, status)
+			}
+		})
+	}
+}
@@ -2,25 +2,53 @@ package clustermanager
 
 // Node is the structure used to define a node
 type Node struct {
-	Name             string    `json:"name"`
-	Type             string    `json:"type"`
-	IsMaster         bool      `json:"is_master"`
-	IsEtcd           bool      `json:"is_etcd"`
-	IPAddress        string    `json:"ip_address"`
-	PrivateIPAddress string    `json:"private_ip_address"`
-	SSHKeyName       string    `json:"ssh_key_name"`
-	WireGuardKeyPair WgKeyPair `json:"wire_guard_key_pair"`
+	Name               string    `json:"name"`
+	Type               string    `json:"type"`
+	IsMaster           bool      `json:"is_master"`
+	IsEtcd             bool      `json:"is_etcd"`
+	IPAddress          string    `json:"ip_address"`
+	PrivateIPAddress   string    `json:"private_ip_address"`
+	IPv6Address        string    `json:"ipv6_address"`
+	PrivateIPv6Address string    `json:"private_ipv6_address"`
+	SSHKeyName         string    `json:"ssh_key_name"`
+	WireGuardEndpoint  string    `json:"wireguard_endpoint"`
+	WireGuardKeyPair   WgKeyPair `json:"wire_guard_key_pair"`
 }
 
 // Cluster is the structure used to define a cluster
 type Cluster struct {
-	Name              string `json:"name"`
-	Nodes             []Node `json:"nodes"`
-	HaEnabled         bool   `json:"ha_enabled"`
-	IsolatedEtcd      bool   `json:"isolated_etcd"`
-	CloudInitFile     string `json:"cloud_init_file"`
-	NodeCIDR          string `json:"node_cidr"`
-	KubernetesVersion string `json:"kubernetes_version"`
+	Name              string                    `json:"name"`
+	Nodes             []Node                    `json:"nodes"`
+	HaEnabled         bool                      `json:"ha_enabled"`
+	IsolatedEtcd      bool                      `json:"isolated_etcd"`
+	CloudInitFile     string                    `json:"cloud_init_file"`
+	NodeCIDR          string                    `json:"node_cidr"`
+	KubernetesVersion string                    `json:"kubernetes_version"`
+	ContainerRuntime  string                    `json:"container_runtime"`
+	CNI               string                    `json:"cni"`
+	PodCIDR           string                    `json:"pod_cidr"`
+	ServiceCIDR       string                    `json:"service_cidr"`
+	DNSDomain         string                    `json:"dns_domain"`
+	IPAllocations     map[string]string         `json:"ip_allocations"`
+	IPFamily          string                    `json:"ip_family"`
+	NodeIPv6CIDR      string                    `json:"node_ipv6_cidr"`
+	PodIPv6CIDR       string                    `json:"pod_ipv6_cidr"`
+	ServiceIPv6CIDR   string                    `json:"service_ipv6_cidr"`
+	WireGuard         WireGuardSettings         `json:"wireguard"`
+	Users             []ClusterUser             `json:"users"`
+	OIDC              OIDCSettings              `json:"oidc"`
+	SecretsEncryption SecretsEncryptionSettings `json:"secrets_encryption"`
+	Audit             AuditSettings             `json:"audit"`
+	KubeadmPatches    string                    `json:"kubeadm_patches"`
+}
+
+// EtcdMember is the structure used to define a member of an etcd cluster
+type EtcdMember struct {
+	ID         string
+	Name       string
+	Started    bool
+	PeerURLs   string
+	ClientURLs string
 }
 
 // NodeCommand is the structure used to define acommand to execute on a node
@@ -0,0 +1,198 @@
+package clustermanager
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// userNamePattern matches the user names, which are used in the names of role bindings
+var userNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9.]*[a-z0-9])?$`)
+
+// namespacePattern matches namespace names, which are DNS labels
+var namespacePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// rolePattern matches the names of cluster roles, e.g. edit or system:aggregate-to-view
+var rolePattern = regexp.MustCompile(`^[a-zA-Z0-9][-a-zA-Z0-9:._]*$`)
+
+// ClusterUser is a user which was issued a client certificate signed by the cluster CA. Client certificates cannot
+// be revoked, so the users are tracked to know which certificates are valid until when
+type ClusterUser struct {
+	Name      string    `json:"name"`
+	Groups    []string  `json:"groups"`
+	Role      string    `json:"role"`
+	Namespace string    `json:"namespace"`
+	Serial    string    `json:"serial"`
+	Expires   time.Time `json:"expires"`
+}
+
+// UserCredentials are the client certificate and private key of a user, PEM encoded
+type UserCredentials struct {
+	Certificate []byte
+	Key         []byte
+}
+
+// AddUser issues a client certificate for a user, which is valid for the given duration rounded up to full days.
+// The private key is generated locally and only the certificate signing request is signed with the CA on the first
+// master. If a role is given, it is bound to the user in the namespace, or cluster wide without a namespace
+func (manager *Manager) AddUser(user ClusterUser, ttl time.Duration) (ClusterUser, UserCredentials, error) {
+	if err := ValidateUserName(user.Name); err != nil {
+		return user, UserCredentials{}, err
+	}
+
+	if err := ValidateUserRoleBinding(user.Role, user.Namespace); err != nil {
+		return user, UserCredentials{}, err
+	}
+
+	masterNode, err := manager.clusterProvider.GetMasterNode()
+	if err != nil {
+		return user, UserCredentials{}, err
+	}
+
+	key, csr, err := generateUserCSR(user.Name, user.Groups)
+	if err != nil {
+		return user, UserCredentials{}, err
+	}
+
+	csrPath := fmt.Sprintf("/root/user-%s.csr", user.Name)
+	if err := manager.nodeCommunicator.WriteFile(*masterNode, csrPath, string(csr), OwnerRead); err != nil {
+		return user, UserCredentials{}, err
+	}
+
+	// openssl reports the signed subject on stderr, which is not part of the certificate
+	signCommand := fmt.Sprintf("trap 'rm -f %s' EXIT; openssl x509 -req -sha256 -in %s -CA /etc/kubernetes/pki/ca.crt -CAkey /etc/kubernetes/pki/ca.key "+
+		"-CAcreateserial -CAserial /etc/kubernetes/pki/ca.srl -days %d 2>/dev/null", csrPath, csrPath, certificateDays(ttl))
+	out, err := manager.nodeCommunicator.RunCmd(*masterNode, signCommand)
+	if err != nil {
+		return user, UserCredentials{}, fmt.Errorf("unable to sign the certificate of '%s': %v", user.Name, err)
+	}
+
+	certificate, err := parseCertificate(out)
+	if err != nil {
+		return user, UserCredentials{}, err
+	}
+	user.Serial = certificate.SerialNumber.Text(16)
+	user.Expires = certificate.NotAfter.UTC()
+
+	if user.Role != "" {
+		if _, err := manager.nodeCommunicator.RunCmd(*masterNode, userRoleBindingCommand(user)); err != nil {
+			return user, UserCredentials{}, fmt.Errorf("unable to bind role '%s' to '%s': %v", user.Role, user.Name, err)
+		}
+	}
+
+	// a user issued a new certificate keeps the old one until it expires, but only the latest one is tracked
+	users := []ClusterUser{}
+	for _, existing := range manager.users {
+		if existing.Name != user.Name {
+			users = append(users, existing)
+		}
+	}
+	manager.users = append(users, user)
+
+	return user, UserCredentials{Certificate: []byte(strings.TrimSpace(out) + "\n"), Key: key}, nil
+}
+
+// UserKubeConfig creates a kubeconfig for a user from the admin kubeconfig of the cluster, replacing the admin
+// credentials with the client certificate of the user
+func UserKubeConfig(adminConfig KubeConfig, clusterName string, user ClusterUser, credentials UserCredentials) KubeConfig {
+	name := fmt.Sprintf("%s@%s", user.Name, clusterName)
+	config := RenameKubeConfig(adminConfig, clusterName)
+
+	contextFields := map[interface{}]interface{}{"cluster": clusterName, "user": name}
+	if user.Namespace != "" {
+		contextFields["namespace"] = user.Namespace
+	}
+
+	config.Users = []KubeConfigEntry{{Name: name, Fields: map[string]interface{}{
+		"user": map[interface{}]interface{}{
+			"client-certificate-data": base64.StdEncoding.EncodeToString(credentials.Certificate),
+			"client-key-data":         base64.StdEncoding.EncodeToString(credentials.Key),
+		},
+	}}}
+	config.Contexts = []KubeConfigEntry{{Name: name, Fields: map[string]interface{}{"context": contextFields}}}
+	config.CurrentContext = name
+
+	return config
+}
+
+// ValidateUserName checks that a user name can be used as common name and in the names of the role bindings
+func ValidateUserName(name string) error {
+	if len(name) > 200 || !userNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid user name '%s', must consist of lower case alphanumeric characters, '-' or '.'", name)
+	}
+
+	return nil
+}
+
+// ValidateUserRoleBinding checks that the role is the name of a cluster role and the namespace a DNS label, as both
+// are passed to kubectl on the master. Both are optional
+func ValidateUserRoleBinding(role string, namespace string) error {
+	if role != "" && (len(role) > 253 || !rolePattern.MatchString(role)) {
+		return fmt.Errorf("invalid role '%s', must consist of alphanumeric characters, '-', '.', '_' or ':'", role)
+	}
+
+	if namespace != "" && (len(namespace) > 63 || !namespacePattern.MatchString(namespace)) {
+		return fmt.Errorf("invalid namespace '%s', must consist of lower case alphanumeric characters or '-'", namespace)
+	}
+
+	return nil
+}
+
+// userRoleBindingCommand returns the command binding the role of a user, as role binding in its namespace or as
+// cluster role binding. The role is always a cluster role, like view, edit or admin. The role of a binding cannot be
+// changed, so a binding of another role is deleted and created again
+func userRoleBindingCommand(user ClusterUser) string {
+	binding := fmt.Sprintf("clusterrolebinding hetzner-kube:user:%s", user.Name)
+	if user.Namespace != "" {
+		binding = fmt.Sprintf("rolebinding hetzner-kube:user:%s --namespace='%s'", user.Name, user.Namespace)
+	}
+
+	return fmt.Sprintf("kubectl get %[1]s --ignore-not-found -o jsonpath='{.roleRef.name}' | grep -qx '%[2]s' || "+
+		"(kubectl delete %[1]s --ignore-not-found && kubectl create %[1]s --clusterrole='%[2]s' --user=%[3]s)", binding, user.Role, user.Name)
+}
+
+// certificateDays returns the validity of a certificate in full days, as openssl does not support shorter periods
+func certificateDays(ttl time.Duration) int {
+	return int(math.Max(1, math.Ceil(ttl.Hours()/24)))
+}
+
+// generateUserCSR generates a private key and a certificate signing request with the user as common name and
+// the groups as organizations, which kubernetes uses as user name and groups
+func generateUserCSR(name string, groups []string) ([]byte, []byte, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to generate a private key: %v", err)
+	}
+
+	template := &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: name, Organization: groups},
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to create a certificate signing request: %v", err)
+	}
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	csrPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})
+
+	return keyPEM, csrPEM, nil
+}
+
+// parseCertificate parses a PEM encoded certificate
+func parseCertificate(content string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(strings.TrimSpace(content)))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("no certificate was signed")
+	}
+
+	return x509.ParseCertificate(block.Bytes)
+}
@@ -5,60 +5,209 @@ import (
 	"encoding/base64"
 	"fmt"
 	"net"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"golang.org/x/crypto/curve25519"
 )
 
 // WgKeyPair containse key pairs
 type WgKeyPair struct {
-	Private string `json:"private"`
-	Public  string `json:"public"`
+	Private   string    `json:"private"`
+	Public    string    `json:"public"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const (
+	// DefaultWireguardPort is the port wireguard listens on, if no other port is configured
+	DefaultWireguardPort = 51820
+	// DefaultWireguardMTU is the MTU of the wireguard interface, which is 80 bytes smaller than the MTU of the public
+	// interface
+	DefaultWireguardMTU = 1420
+	// natKeepalive is the keepalive interval in seconds of nodes behind a NAT, if no other interval is configured
+	natKeepalive = 25
+)
+
+// WireGuardSettings contains the cluster wide settings of the encrypted network
+type WireGuardSettings struct {
+	// PresharedKeys contains the preshared keys of the connections between two nodes, see PresharedKeyID
+	PresharedKeys map[string]string `json:"preshared_keys"`
+	// Port is the port all nodes listen on, 0 for the default port
+	Port int `json:"port"`
+	// MTU is the MTU of the wireguard interfaces, 0 to let wg-quick derive it from the public interface
+	MTU int `json:"mtu"`
+	// PersistentKeepalive is the interval in seconds in which all peers are sent keepalive packets, 0 to send them
+	// from nodes behind a NAT only
+	PersistentKeepalive int `json:"persistent_keepalive"`
+}
+
+// PortOrDefault returns the configured port or the default port
+func (settings WireGuardSettings) PortOrDefault() int {
+	if settings.Port == 0 {
+		return DefaultWireguardPort
+	}
+
+	return settings.Port
+}
+
+// MTUOrDefault returns the configured MTU or the MTU wg-quick derives from a public interface with a MTU of 1500
+func (settings WireGuardSettings) MTUOrDefault() int {
+	if settings.MTU == 0 {
+		return DefaultWireguardMTU
+	}
+
+	return settings.MTU
+}
+
+// ValidateWireGuardSettings checks that the port, MTU and keepalive interval are in their valid ranges
+func ValidateWireGuardSettings(settings WireGuardSettings) error {
+	if settings.Port < 0 || settings.Port > 65535 {
+		return fmt.Errorf("invalid wireguard port %d", settings.Port)
+	}
+
+	// IPv6 requires a MTU of at least 1280 bytes
+	if settings.MTU != 0 && (settings.MTU < 1280 || settings.MTU > 1500) {
+		return fmt.Errorf("invalid wireguard MTU %d, must be between 1280 and 1500", settings.MTU)
+	}
+
+	if settings.PersistentKeepalive < 0 || settings.PersistentKeepalive > 65535 {
+		return fmt.Errorf("invalid wireguard keepalive interval %d", settings.PersistentKeepalive)
+	}
+
+	return nil
+}
+
+// ValidateWireguardEndpoint checks that an endpoint override is a host and port
+func ValidateWireguardEndpoint(endpoint string) error {
+	host, port, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid wireguard endpoint '%s': %v", endpoint, err)
+	}
+
+	if portNumber, err := strconv.Atoi(port); err != nil || host == "" || portNumber < 1 || portNumber > 65535 {
+		return fmt.Errorf("invalid wireguard endpoint '%s', must be <host>:<port>", endpoint)
+	}
+
+	return nil
+}
+
+// PresharedKeyID returns the key of the connection between two nodes in WireGuardSettings.PresharedKeys
+func PresharedKeyID(nodeName string, peerName string) string {
+	names := []string{nodeName, peerName}
+	sort.Strings(names)
+
+	return strings.Join(names, "/")
 }
 
 // GenerateWireguardConf generate wireguard configuration file
-func GenerateWireguardConf(node Node, nodes []Node) string {
+func GenerateWireguardConf(node Node, nodes []Node, settings WireGuardSettings) string {
 	var output string
 	// print header block
 	headerTpl := `[Interface]
 Address = %s
 PrivateKey = %s
-ListenPort = 51820
-`
+ListenPort = %d
+%s`
 	peerTpl := `# %s
 [Peer]
 PublicKey = %s
-AllowedIps = %s/32
-Endpoint = %s:51820
-`
-	output = fmt.Sprintf(headerTpl, node.PrivateIPAddress, node.WireGuardKeyPair.Private)
+AllowedIps = %s
+Endpoint = %s
+%s%s`
+	address := node.PrivateIPAddress
+	if node.PrivateIPv6Address != "" {
+		address += ", " + node.PrivateIPv6Address
+	}
+
+	mtu := ""
+	if settings.MTU != 0 {
+		mtu = fmt.Sprintf("MTU = %d\n", settings.MTU)
+	}
+
+	keepalive := ""
+	if interval := wireguardKeepalive(node, settings); interval > 0 {
+		keepalive = fmt.Sprintf("PersistentKeepalive = %d\n", interval)
+	}
+	output = fmt.Sprintf(headerTpl, address, node.WireGuardKeyPair.Private, settings.PortOrDefault(), mtu)
 
 	for _, peer := range nodes {
 		if peer.Name == node.Name {
 			continue
 		}
 
+		presharedKey := ""
+		if key := settings.PresharedKeys[PresharedKeyID(node.Name, peer.Name)]; key != "" {
+			presharedKey = fmt.Sprintf("PresharedKey = %s\n", key)
+		}
+
 		output = fmt.Sprintf("%s\n%s",
 			output,
-			fmt.Sprintf(peerTpl, peer.Name, peer.WireGuardKeyPair.Public, peer.PrivateIPAddress, peer.IPAddress),
+			fmt.Sprintf(peerTpl, peer.Name, peer.WireGuardKeyPair.Public, strings.Join(wireguardAllowedIPs(peer), ", "), wireguardEndpoint(node, peer, settings), presharedKey, keepalive),
 		)
 	}
 
 	return output
 }
 
-// PrivateIPPrefix extracts the first 3 digits of an IPv4 address from CIDR block
-func PrivateIPPrefix(cidr string) (string, error) {
-	ipAddress, _, err := net.ParseCIDR(cidr)
-	if err != nil {
-		return "", fmt.Errorf("unable to parse cidr %q", cidr)
+// wireguardAllowedIPs returns the overlay addresses of a peer
+func wireguardAllowedIPs(peer Node) []string {
+	allowedIPs := []string{peer.PrivateIPAddress + "/32"}
+	if peer.PrivateIPv6Address != "" {
+		allowedIPs = append(allowedIPs, peer.PrivateIPv6Address+"/128")
 	}
-	ipAddress = ipAddress.To4()
-	if ipAddress == nil {
-		return "", fmt.Errorf("unable to convert ip %q to IPv4s", ipAddress)
+
+	return allowedIPs
+}
+
+// wireguardEndpoint returns the public address and port a node reaches its peer on. Peers behind a NAT are reached
+// on their endpoint override. Nodes with IPv6 overlay addresses connect over IPv6, if both of them have a public IPv6
+// address
+func wireguardEndpoint(node Node, peer Node, settings WireGuardSettings) string {
+	if peer.WireGuardEndpoint != "" {
+		return peer.WireGuardEndpoint
 	}
 
-	return strings.Join(strings.Split(ipAddress.String(), ".")[:3], "."), nil
+	port := strconv.Itoa(settings.PortOrDefault())
+	if node.PrivateIPv6Address != "" && node.IPv6Address != "" && peer.IPv6Address != "" {
+		return net.JoinHostPort(peer.IPv6Address, port)
+	}
+
+	return net.JoinHostPort(peer.IPAddress, port)
+}
+
+// wireguardKeepalive returns the keepalive interval of the node for all of its peers. Nodes behind a NAT always
+// send keepalive packets, so the NAT keeps the mapping of their connections open
+func wireguardKeepalive(node Node, settings WireGuardSettings) int {
+	if settings.PersistentKeepalive == 0 && node.WireGuardEndpoint != "" {
+		return natKeepalive
+	}
+
+	return settings.PersistentKeepalive
+}
+
+// WireguardSyncCommand generates the command applying the configuration file of a node to its running wireguard
+// interface. Unlike a restart of wg-quick, it keeps the sessions of unchanged peers. As wg syncconf does not manage
+// routes, the routes to the overlay addresses of all peers are replaced. Routes to removed peers are left, as they
+// only lead into the interface and are replaced once the address is allocated again
+func WireguardSyncCommand(node Node, nodes []Node) string {
+	commands := []string{"bash -c 'wg syncconf wg0 <(wg-quick strip wg0)'"}
+	for _, peer := range nodes {
+		if peer.Name == node.Name {
+			continue
+		}
+
+		for _, allowedIP := range wireguardAllowedIPs(peer) {
+			if strings.Contains(allowedIP, ":") {
+				commands = append(commands, fmt.Sprintf("ip -6 route replace %s dev wg0", allowedIP))
+			} else {
+				commands = append(commands, fmt.Sprintf("ip route replace %s dev wg0", allowedIP))
+			}
+		}
+	}
+
+	return strings.Join(commands, " && ")
 }
 
 // GenerateKeyPair create a key-pair used to instantiate a wireguard connection
@@ -78,13 +227,26 @@ func GenerateKeyPair() (WgKeyPair, error) {
 	curve25519.ScalarBaseMult(&publicKey, &privateKey)
 
 	return WgKeyPair{
-		Private: base64.StdEncoding.EncodeToString(privateKey[:]),
-		Public:  base64.StdEncoding.EncodeToString(publicKey[:]),
+		Private:   base64.StdEncoding.EncodeToString(privateKey[:]),
+		Public:    base64.StdEncoding.EncodeToString(publicKey[:]),
+		CreatedAt: time.Now().UTC(),
 	}, nil
 }
 
-// GenerateOverlayRouteSystemdService generate configuration file used to manage overlay route service on systemd
-func GenerateOverlayRouteSystemdService(node Node) string {
+// GeneratePresharedKey creates a random key, which is mixed into the handshake of two peers as an additional layer
+// of symmetric encryption
+func GeneratePresharedKey() (string, error) {
+	var key [32]byte
+	if _, err := rand.Reader.Read(key[:]); err != nil {
+		return "", fmt.Errorf("unable to generate a preshared key: %v", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(key[:]), nil
+}
+
+// GenerateOverlayRouteSystemdService generate configuration file used to manage overlay route service on systemd.
+// The pod CIDR of dual-stack clusters contains the IPv4 and IPv6 network separated by a comma
+func GenerateOverlayRouteSystemdService(node Node, podCIDR string) string {
 	serviceTpls := `# /etc/systemd/system/overlay-route.service
 [Unit]
 Description=Overlay network route for Wireguard
@@ -93,12 +255,20 @@ After=wg-quick@wg0.service
 [Service]
 Type=oneshot
 User=root
-ExecStart=/sbin/ip route add 10.244.0.0/16 dev wg0 src %s
-
+%s
 [Install]
 WantedBy=multi-user.target
 `
-	service := fmt.Sprintf(serviceTpls, node.PrivateIPAddress)
+	routes := ""
+	for _, cidr := range strings.Split(podCIDR, ",") {
+		if !strings.Contains(cidr, ":") {
+			routes += fmt.Sprintf("ExecStart=/sbin/ip route add %s dev wg0 src %s\n", cidr, node.PrivateIPAddress)
+		} else if node.PrivateIPv6Address != "" {
+			routes += fmt.Sprintf("ExecStart=/sbin/ip -6 route add %s dev wg0 src %s\n", cidr, node.PrivateIPv6Address)
+		}
+	}
+
+	service := fmt.Sprintf(serviceTpls, routes)
 
 	return service
 }
@@ -2,7 +2,7 @@ package clustermanager_test
 
 import (
 	"encoding/base64"
-	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/xetys/hetzner-kube/pkg/clustermanager"
@@ -26,7 +26,7 @@ AllowedIps = 10.0.0.1/32
 Endpoint = 1.1.1.1:51820
 `
 
-	generatedConf := clustermanager.GenerateWireguardConf(nodes[1], nodes)
+	generatedConf := clustermanager.GenerateWireguardConf(nodes[1], nodes, clustermanager.WireGuardSettings{})
 
 	if generatedConf != expectedConf {
 		t.Errorf("The file was not rendered as expected\n%s\n\n", generatedConf)
@@ -34,6 +34,126 @@ Endpoint = 1.1.1.1:51820
 
 }
 
+func TestGenerateWireguardConfDualStack(t *testing.T) {
+	nodes := []clustermanager.Node{
+		{Name: "node1", IPAddress: "1.1.1.1", IPv6Address: "2001:db8:1::1", PrivateIPAddress: "10.0.0.1", PrivateIPv6Address: "fd00::a00:1", WireGuardKeyPair: clustermanager.WgKeyPair{Private: "node1priv", Public: "node1pub"}},
+		{Name: "node2", IPAddress: "1.1.1.2", IPv6Address: "2001:db8:2::1", PrivateIPAddress: "10.0.0.2", PrivateIPv6Address: "fd00::a00:2", WireGuardKeyPair: clustermanager.WgKeyPair{Private: "node2priv", Public: "node2pub"}},
+		{Name: "external", IPAddress: "1.1.1.3", PrivateIPAddress: "10.0.0.3", PrivateIPv6Address: "fd00::a00:3", WireGuardKeyPair: clustermanager.WgKeyPair{Private: "node3priv", Public: "node3pub"}},
+	}
+
+	expectedConf := `[Interface]
+Address = 10.0.0.2, fd00::a00:2
+PrivateKey = node2priv
+ListenPort = 51820
+
+# node1
+[Peer]
+PublicKey = node1pub
+AllowedIps = 10.0.0.1/32, fd00::a00:1/128
+Endpoint = [2001:db8:1::1]:51820
+
+# external
+[Peer]
+PublicKey = node3pub
+AllowedIps = 10.0.0.3/32, fd00::a00:3/128
+Endpoint = 1.1.1.3:51820
+`
+
+	generatedConf := clustermanager.GenerateWireguardConf(nodes[1], nodes, clustermanager.WireGuardSettings{})
+
+	if generatedConf != expectedConf {
+		t.Errorf("The file was not rendered as expected\n%s\n\n", generatedConf)
+	}
+}
+
+func TestGenerateWireguardConfWithSettings(t *testing.T) {
+	nodes := []clustermanager.Node{
+		{Name: "node1", IPAddress: "1.1.1.1", PrivateIPAddress: "10.0.0.1", WireGuardKeyPair: clustermanager.WgKeyPair{Private: "node1priv", Public: "node1pub"}},
+		{Name: "external", IPAddress: "192.168.0.5", PrivateIPAddress: "10.0.0.2", WireGuardEndpoint: "203.0.113.1:51821", WireGuardKeyPair: clustermanager.WgKeyPair{Private: "node2priv", Public: "node2pub"}},
+	}
+	settings := clustermanager.WireGuardSettings{Port: 51900, MTU: 1380}
+
+	expectedConf := `[Interface]
+Address = 10.0.0.1
+PrivateKey = node1priv
+ListenPort = 51900
+MTU = 1380
+
+# external
+[Peer]
+PublicKey = node2pub
+AllowedIps = 10.0.0.2/32
+Endpoint = 203.0.113.1:51821
+`
+
+	generatedConf := clustermanager.GenerateWireguardConf(nodes[0], nodes, settings)
+	if generatedConf != expectedConf {
+		t.Errorf("The file was not rendered as expected\n%s\n\n", generatedConf)
+	}
+
+	// the node behind the NAT keeps its connections open
+	generatedConf = clustermanager.GenerateWireguardConf(nodes[1], nodes, settings)
+	if !strings.Contains(generatedConf, "Endpoint = 1.1.1.1:51900\nPersistentKeepalive = 25\n") {
+		t.Errorf("expected a keepalive for the node behind a NAT\n%s", generatedConf)
+	}
+
+	settings.PersistentKeepalive = 10
+	generatedConf = clustermanager.GenerateWireguardConf(nodes[0], nodes, settings)
+	if !strings.Contains(generatedConf, "PersistentKeepalive = 10\n") {
+		t.Errorf("expected the configured keepalive\n%s", generatedConf)
+	}
+}
+
+func TestValidateWireGuardSettings(t *testing.T) {
+	tests := []struct {
+		settings clustermanager.WireGuardSettings
+		valid    bool
+	}{
+		{clustermanager.WireGuardSettings{}, true},
+		{clustermanager.WireGuardSettings{Port: 51821, MTU: 1280, PersistentKeepalive: 25}, true},
+		{clustermanager.WireGuardSettings{Port: 70000}, false},
+		{clustermanager.WireGuardSettings{MTU: 1000}, false},
+		{clustermanager.WireGuardSettings{MTU: 9000}, false},
+		{clustermanager.WireGuardSettings{PersistentKeepalive: -1}, false},
+	}
+
+	for _, test := range tests {
+		if err := clustermanager.ValidateWireGuardSettings(test.settings); (err == nil) != test.valid {
+			t.Errorf("settings %+v: expected valid=%v, got %v", test.settings, test.valid, err)
+		}
+	}
+}
+
+func TestValidateWireguardEndpoint(t *testing.T) {
+	for _, endpoint := range []string{"203.0.113.1:51820", "[2001:db8::1]:51820", "vpn.example.com:4500"} {
+		if err := clustermanager.ValidateWireguardEndpoint(endpoint); err != nil {
+			t.Errorf("expected endpoint %s to be valid, got %v", endpoint, err)
+		}
+	}
+
+	for _, endpoint := range []string{"203.0.113.1", ":51820", "203.0.113.1:0", "203.0.113.1:port"} {
+		if err := clustermanager.ValidateWireguardEndpoint(endpoint); err == nil {
+			t.Errorf("expected endpoint %s to be invalid", endpoint)
+		}
+	}
+}
+
+func TestGenerateWireguardConfWithPresharedKey(t *testing.T) {
+	nodes := []clustermanager.Node{
+		{Name: "node1", IPAddress: "1.1.1.1", PrivateIPAddress: "10.0.0.1", WireGuardKeyPair: clustermanager.WgKeyPair{Private: "node1priv", Public: "node1pub"}},
+		{Name: "node2", IPAddress: "1.1.1.2", PrivateIPAddress: "10.0.0.2", WireGuardKeyPair: clustermanager.WgKeyPair{Private: "node2priv", Public: "node2pub"}},
+	}
+	settings := clustermanager.WireGuardSettings{
+		PresharedKeys: map[string]string{clustermanager.PresharedKeyID("node2", "node1"): "psk"},
+	}
+
+	generatedConf := clustermanager.GenerateWireguardConf(nodes[1], nodes, settings)
+
+	if !strings.HasSuffix(generatedConf, "Endpoint = 1.1.1.1:51820\nPresharedKey = psk\n") {
+		t.Errorf("The preshared key was not rendered as expected\n%s\n\n", generatedConf)
+	}
+}
+
 func TestGenerateKeyPair(t *testing.T) {
 	wgKey, err := clustermanager.GenerateKeyPair()
 	if err != nil {
@@ -65,54 +185,41 @@ func TestGenerateKeyPair(t *testing.T) {
 	if len(publicBytes) != 32 {
 		t.Errorf("Public key is not 32 bytes len")
 	}
+
+	if wgKey.CreatedAt.IsZero() {
+		t.Errorf("Creation time is not set")
+	}
 }
 
-func TestPrivateIPPrefix(t *testing.T) {
-	testCases := []struct {
-		source   string
-		expected string
-	}{
-		{
-			source:   "10.5.3.6/24",
-			expected: "10.5.3",
-		},
-		{
-			source:   "10.20.30.60/16",
-			expected: "10.20.30",
-		},
-		{
-			source:   "250.251.252.253/32",
-			expected: "250.251.252",
-		},
-	}
-	for _, tC := range testCases {
-		t.Run(fmt.Sprintf("testing IP: %s", tC.source), func(t *testing.T) {
-			generated, err := clustermanager.PrivateIPPrefix(tC.source)
-			if err != nil {
-				t.Errorf("Unexpected error on parsing valid IP\nParsing IP: %s\nExpected: %s\nGenerated: %s\n", tC.source, tC.expected, generated)
-			}
-
-			if tC.expected != generated {
-				t.Errorf("\nParsing IP: %s\nExpected: %s\nGenerated: %s\n", tC.source, tC.expected, generated)
-			}
-		})
+func TestGenerateOverlayRouteSystemdService(t *testing.T) {
+	service := clustermanager.GenerateOverlayRouteSystemdService(clustermanager.Node{PrivateIPAddress: "10.0.1.11"}, "10.244.0.0/16")
+
+	if !strings.Contains(service, "ExecStart=/sbin/ip route add 10.244.0.0/16 dev wg0 src 10.0.1.11\n") {
+		t.Errorf("overlay route service does not route the pod network over wireguard\n%s", service)
 	}
 }
 
-func TestPrivateIPPrefixWithWrongIpAddress(t *testing.T) {
-	testCases := []struct{ source string }{
-		{source: "10.5.3"},
-		{source: "10.20.30.6000"},
-		{source: "250.251.252.253.254"},
-		{source: "10.0.1.100"},
-		{source: "10.0.1.100/33"},
-	}
-	for _, tC := range testCases {
-		t.Run(fmt.Sprintf("testing IP: %s", tC.source), func(t *testing.T) {
-			_, err := clustermanager.PrivateIPPrefix(tC.source)
-			if err == nil {
-				t.Errorf("we expect an error on parsing invalid IP %q", tC.source)
-			}
-		})
+func TestGenerateOverlayRouteSystemdServiceDualStack(t *testing.T) {
+	node := clustermanager.Node{PrivateIPAddress: "10.0.1.11", PrivateIPv6Address: "fd00::a00:10b"}
+	service := clustermanager.GenerateOverlayRouteSystemdService(node, "10.244.0.0/16,fd00:10:244::/56")
+
+	expected := "ExecStart=/sbin/ip route add 10.244.0.0/16 dev wg0 src 10.0.1.11\n" +
+		"ExecStart=/sbin/ip -6 route add fd00:10:244::/56 dev wg0 src fd00::a00:10b\n"
+	if !strings.Contains(service, expected) {
+		t.Errorf("overlay route service does not route both pod networks over wireguard\n%s", service)
+	}
+}
+
+func TestWireguardSyncCommand(t *testing.T) {
+	nodes := []clustermanager.Node{
+		{Name: "node1", PrivateIPAddress: "10.0.1.1"},
+		{Name: "node2", PrivateIPAddress: "10.0.1.2", PrivateIPv6Address: "fd00::a00:102"},
+	}
+
+	command := clustermanager.WireguardSyncCommand(nodes[0], nodes)
+	expected := "bash -c 'wg syncconf wg0 <(wg-quick strip wg0)' && ip route replace 10.0.1.2/32 dev wg0 && ip -6 route replace fd00::a00:102/128 dev wg0"
+
+	if command != expected {
+		t.Errorf("unexpected sync command\nexpected: %s\ngot: %s", expected, command)
 	}
 }
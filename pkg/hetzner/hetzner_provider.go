@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"log"
 	"math/rand"
+	"net"
 	"os"
 	"strings"
 	"time"
@@ -17,6 +18,9 @@ import (
 	"github.com/xetys/hetzner-kube/pkg/clustermanager"
 )
 
+// serverDeletionTimeout is the time a deleted server may take to disappear, before it is recreated with its name
+const serverDeletionTimeout = 5 * time.Minute
+
 // Provider contains provider information
 type Provider struct {
 	client        *hcloud.Client
@@ -27,6 +31,7 @@ type Provider struct {
 	wait          bool
 	token         string
 	nodeCidr      string
+	cluster       clustermanager.Cluster
 }
 
 // NewHetznerProvider returns an instance of hetzner.Provider
@@ -39,42 +44,23 @@ func NewHetznerProvider(context context.Context, client *hcloud.Client, cluster
 		clusterName:   cluster.Name,
 		cloudInitFile: cluster.CloudInitFile,
 		nodes:         cluster.Nodes,
+		cluster:       cluster,
 	}
 }
 
 // CreateNodes creates hetzner nodes
 func (provider *Provider) CreateNodes(suffix string, template clustermanager.Node, datacenters []string, count int, offset int) ([]clustermanager.Node, error) {
-	sshKey, _, err := provider.client.SSHKey.Get(provider.context, template.SSHKeyName)
-
+	serverNameTemplate := fmt.Sprintf("%s-%s-@idx", provider.clusterName, suffix)
+	serverOptsTemplate, err := provider.serverCreateOpts(serverNameTemplate, template)
 	if err != nil {
 		return nil, err
 	}
 
-	if sshKey == nil {
-		return nil, fmt.Errorf("we got some problem with the SSH-Key '%s', chances are you are in the wrong context", template.SSHKeyName)
-	}
-
-	serverNameTemplate := fmt.Sprintf("%s-%s-@idx", provider.clusterName, suffix)
-	serverOptsTemplate := hcloud.ServerCreateOpts{
-		Name: serverNameTemplate,
-		ServerType: &hcloud.ServerType{
-			Name: template.Type,
-		},
-		Image: &hcloud.Image{
-			Name: "ubuntu-20.04",
-		},
-	}
-
-	if len(provider.cloudInitFile) > 0 {
-		buf, err := ioutil.ReadFile(provider.cloudInitFile)
-		if err == nil {
-			serverOptsTemplate.UserData = string(buf)
-		}
-
+	ipam, err := clustermanager.NewClusterIPAM(provider.GetCluster())
+	if err != nil {
+		return nil, err
 	}
 
-	serverOptsTemplate.SSHKeys = append(serverOptsTemplate.SSHKeys, sshKey)
-
 	datacentersCount := len(datacenters)
 
 	//shuffle datacenters to make it more random
@@ -90,30 +76,21 @@ func (provider *Provider) CreateNodes(suffix string, template clustermanager.Nod
 			Name: datacenters[i%datacentersCount],
 		}
 
-		// create
-		server, err := provider.runCreateServer(&serverOpts)
-
+		// the address is allocated first, so no server is created if the node CIDR is exhausted
+		privateIPAddress, err := ipam.Allocate(serverOpts.Name)
 		if err != nil {
 			return nil, err
 		}
 
-		ipAddress := server.Server.PublicNet.IPv4.IP.String()
-		log.Printf("Created node '%s' with IP %s", server.Server.Name, ipAddress)
+		// create
+		server, err := provider.runCreateServer(&serverOpts)
 
-		// render private IP address
-		privateIPLastBlock := nodeNumber
-		if !template.IsEtcd {
-			privateIPLastBlock += 10
-			if !template.IsMaster {
-				privateIPLastBlock += 10
-			}
-		}
-		cidrPrefix, err := clustermanager.PrivateIPPrefix(provider.nodeCidr)
 		if err != nil {
 			return nil, err
 		}
 
-		privateIPAddress := fmt.Sprintf("%s.%d", cidrPrefix, privateIPLastBlock)
+		ipAddress := server.Server.PublicNet.IPv4.IP.String()
+		log.Printf("Created node '%s' with IP %s", server.Server.Name, ipAddress)
 
 		node := clustermanager.Node{
 			Name:             serverOpts.Name,
@@ -122,25 +99,126 @@ func (provider *Provider) CreateNodes(suffix string, template clustermanager.Nod
 			IsEtcd:           template.IsEtcd,
 			IPAddress:        ipAddress,
 			PrivateIPAddress: privateIPAddress,
+			IPv6Address:      publicIPv6Address(server.Server),
 			SSHKeyName:       template.SSHKeyName,
 		}
+
+		if clustermanager.IsDualStack(provider.cluster) {
+			node.PrivateIPv6Address, err = clustermanager.OverlayIPv6Address(provider.cluster.NodeIPv6CIDR, privateIPAddress)
+			if err != nil {
+				return nil, err
+			}
+		}
 		nodes = append(nodes, node)
 		provider.nodes = append(provider.nodes, node)
+		provider.cluster.IPAllocations = ipam.Allocations()
 	}
 
 	return nodes, nil
 }
 
+// RecreateNode deletes the server of a node and creates a new one with the same name, type and private IP address.
+// The server is placed in its previous datacenter, or in one of the given datacenters if the server is already gone
+func (provider *Provider) RecreateNode(node clustermanager.Node, datacenters []string) (clustermanager.Node, error) {
+	server, _, err := provider.client.Server.GetByName(provider.context, node.Name)
+	if err != nil {
+		return node, err
+	}
+
+	datacenter := datacenters[rand.Intn(len(datacenters))]
+	if server != nil {
+		datacenter = server.Datacenter.Name
+
+		log.Printf("deleting server '%s'...", node.Name)
+		if _, err := provider.client.Server.Delete(provider.context, server); err != nil {
+			return node, err
+		}
+
+		// the name must be free before the server can be created again
+		deadline := time.Now().Add(serverDeletionTimeout)
+		for server != nil {
+			if time.Now().After(deadline) {
+				return node, fmt.Errorf("server '%s' was not deleted within %s", node.Name, serverDeletionTimeout)
+			}
+
+			time.Sleep(2 * time.Second)
+			server, _, err = provider.client.Server.GetByName(provider.context, node.Name)
+			if err != nil {
+				return node, err
+			}
+		}
+	}
+
+	serverOpts, err := provider.serverCreateOpts(node.Name, node)
+	if err != nil {
+		return node, err
+	}
+	serverOpts.Datacenter = &hcloud.Datacenter{Name: datacenter}
+
+	result, err := provider.runCreateServer(&serverOpts)
+	if err != nil {
+		return node, err
+	}
+
+	node.IPAddress = result.Server.PublicNet.IPv4.IP.String()
+	node.IPv6Address = publicIPv6Address(result.Server)
+	node.WireGuardKeyPair = clustermanager.WgKeyPair{}
+	log.Printf("Recreated node '%s' with IP %s", node.Name, node.IPAddress)
+
+	for i := range provider.nodes {
+		if provider.nodes[i].Name == node.Name {
+			provider.nodes[i] = node
+		}
+	}
+
+	return node, nil
+}
+
+// serverCreateOpts returns the options to create a server for the given node template
+func (provider *Provider) serverCreateOpts(name string, template clustermanager.Node) (hcloud.ServerCreateOpts, error) {
+	sshKey, _, err := provider.client.SSHKey.Get(provider.context, template.SSHKeyName)
+
+	if err != nil {
+		return hcloud.ServerCreateOpts{}, err
+	}
+
+	if sshKey == nil {
+		return hcloud.ServerCreateOpts{}, fmt.Errorf("we got some problem with the SSH-Key '%s', chances are you are in the wrong context", template.SSHKeyName)
+	}
+
+	serverOpts := hcloud.ServerCreateOpts{
+		Name: name,
+		ServerType: &hcloud.ServerType{
+			Name: template.Type,
+		},
+		Image: &hcloud.Image{
+			Name: "ubuntu-20.04",
+		},
+	}
+
+	if len(provider.cloudInitFile) > 0 {
+		buf, err := ioutil.ReadFile(provider.cloudInitFile)
+		if err == nil {
+			serverOpts.UserData = string(buf)
+		}
+
+	}
+
+	serverOpts.SSHKeys = append(serverOpts.SSHKeys, sshKey)
+
+	return serverOpts, nil
+}
+
 // CreateEtcdNodes creates nodes with type 'etcd'
-func (provider *Provider) CreateEtcdNodes(sshKeyName string, masterServerType string, datacenters []string, count int) ([]clustermanager.Node, error) {
+func (provider *Provider) CreateEtcdNodes(sshKeyName string, masterServerType string, datacenters []string, count int, offset int) ([]clustermanager.Node, error) {
 	template := clustermanager.Node{SSHKeyName: sshKeyName, IsEtcd: true, Type: masterServerType}
-	return provider.CreateNodes("etcd", template, datacenters, count, 0)
+	return provider.CreateNodes("etcd", template, datacenters, count, offset)
 }
 
 // CreateMasterNodes creates nodes with type 'master'
-func (provider *Provider) CreateMasterNodes(sshKeyName string, masterServerType string, datacenters []string, count int, isEtcd bool) ([]clustermanager.Node, error) {
+func (provider *Provider) CreateMasterNodes(sshKeyName string, masterServerType string, datacenters []string, count int, offset int, isEtcd bool) ([]clustermanager.Node, error) {
 	template := clustermanager.Node{SSHKeyName: sshKeyName, IsMaster: true, Type: masterServerType, IsEtcd: isEtcd}
-	return provider.CreateNodes("master", template, datacenters, count, 0)
+	return provider.CreateNodes("master", template, datacenters, count, offset)
 }
 
 // CreateWorkerNodes create new worker node on provider
@@ -190,14 +268,15 @@ func (provider *Provider) GetMasterNode() (*clustermanager.Node, error) {
 	return &nodes[0], nil
 }
 
-// GetCluster returns a template for Cluster
+// GetCluster returns the cluster the provider was created for, with its current nodes
 func (provider *Provider) GetCluster() clustermanager.Cluster {
-	return clustermanager.Cluster{
-		Name:          provider.clusterName,
-		Nodes:         provider.nodes,
-		CloudInitFile: provider.cloudInitFile,
-		NodeCIDR:      provider.nodeCidr,
-	}
+	cluster := provider.cluster
+	cluster.Name = provider.clusterName
+	cluster.Nodes = provider.nodes
+	cluster.CloudInitFile = provider.cloudInitFile
+	cluster.NodeCIDR = provider.nodeCidr
+
+	return cluster
 }
 
 // GetAdditionalMasterInstallCommands return the list of node command to execute on the cluster
@@ -221,6 +300,20 @@ func (provider *Provider) Token() string {
 	return provider.token
 }
 
+// publicIPv6Address returns the first address of the IPv6 network of the server, which hetzner configures on the server
+func publicIPv6Address(server *hcloud.Server) string {
+	network := server.PublicNet.IPv6.Network
+	if network == nil {
+		return ""
+	}
+
+	address := make(net.IP, len(network.IP))
+	copy(address, network.IP)
+	address[len(address)-1] |= 1
+
+	return address.String()
+}
+
 type nodeFilter func(clustermanager.Node) bool
 
 func (provider *Provider) filterNodes(filter nodeFilter) []clustermanager.Node {
@@ -0,0 +1,27 @@
+package phases
+
+import "github.com/xetys/hetzner-kube/pkg/clustermanager"
+
+// AuditPhase defines the phase where the audit log of the api servers is configured on an existing cluster
+type AuditPhase struct {
+	clusterManager *clustermanager.Manager
+	settings       clustermanager.AuditSettings
+}
+
+// NewAuditPhase returns an instance of *AuditPhase
+func NewAuditPhase(manager *clustermanager.Manager, settings clustermanager.AuditSettings) Phase {
+	return &AuditPhase{
+		clusterManager: manager,
+		settings:       settings,
+	}
+}
+
+// ShouldRun returns if this phase should run, which is not the case if auditing is neither enabled nor disabled
+func (phase *AuditPhase) ShouldRun() bool {
+	return phase.settings.Enabled || phase.clusterManager.Cluster().Audit.Enabled
+}
+
+// Run runs the phase
+func (phase *AuditPhase) Run() error {
+	return phase.clusterManager.SetupAudit(phase.settings)
+}
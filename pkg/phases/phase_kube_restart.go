@@ -5,17 +5,19 @@ import (
 	"github.com/xetys/hetzner-kube/pkg/clustermanager"
 )
 
-// KubeRestartPhase defines a simple phase which restarts docker and kubelet
+// KubeRestartPhase defines a simple phase which restarts the container runtime and kubelet
 type KubeRestartPhase struct {
-	provider clustermanager.ClusterProvider
-	ssh      clustermanager.NodeCommunicator
+	provider         clustermanager.ClusterProvider
+	ssh              clustermanager.NodeCommunicator
+	containerRuntime string
 }
 
 // NewKubeRestartPhase returns an instance of *KubeRestartPhase
-func NewKubeRestartPhase(provider clustermanager.ClusterProvider, ssh clustermanager.NodeCommunicator) Phase {
+func NewKubeRestartPhase(provider clustermanager.ClusterProvider, ssh clustermanager.NodeCommunicator, containerRuntime string) Phase {
 	return &KubeRestartPhase{
-		provider: provider,
-		ssh:      ssh,
+		provider:         provider,
+		ssh:              ssh,
+		containerRuntime: clustermanager.ContainerRuntimeOrDefault(containerRuntime),
 	}
 }
 
@@ -33,14 +35,14 @@ func (phase *KubeRestartPhase) Run() error {
 	for _, node := range phase.provider.GetAllNodes() {
 		numProcs++
 		go func(node clustermanager.Node) {
-			fmt.Printf("restarting docker+kubelet on node '%s'\n", node.Name)
-			_, err := phase.ssh.RunCmd(node, "systemctl restart docker && systemctl restart kubelet")
+			fmt.Printf("restarting %s+kubelet on node '%s'\n", phase.containerRuntime, node.Name)
+			_, err := phase.ssh.RunCmd(node, clustermanager.RestartKubeletCommand(phase.containerRuntime))
 
 			if err != nil {
 				errChan <- err
 			}
 
-			fmt.Printf("restarted docker+kubelet on node '%s'\n", node.Name)
+			fmt.Printf("restarted %s+kubelet on node '%s'\n", phase.containerRuntime, node.Name)
 			trueChan <- true
 		}(node)
 	}